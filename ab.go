@@ -13,9 +13,12 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"net"
+	"net/http"
 	"os"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -23,13 +26,34 @@ import (
 // PLC .
 type PLC struct {
 	callback  func(service int, statut int, tag *Tag)
+	auth      *HTTPAuth
+	capMut    sync.RWMutex
+	capture   *capture
+	faults    *FaultPolicy
+	faultMut  sync.RWMutex
+	recorder  *Recorder
+	sim       simulation
+	logic     logicTask
 	closeI    bool
 	closeMut  sync.RWMutex
 	closeWMut sync.Mutex
 	closeWait *sync.Cond
 	eds       map[string]map[string]string
 	favicon   []byte
+	hist      map[string]*history
+	httpMut   sync.Mutex
+	httpSrv   []*http.Server
+	wsConns   map[*wsConn]struct{} // open WebSocket connections, closed by CloseHTTP
+	metrics   metrics
+	histAll   *history
+	persist   *persistence
 	port      uint16
+	prodMut   sync.Mutex
+	produced  map[string]*producedTag
+	ioConns   map[uint32]*ioConn // class 1 connections by O->T connection ID
+	ioAddr    *net.UDPAddr       // address receiving O->T packets, nil if not listening
+	programs  map[string]*program
+	subs      map[*Subscription]struct{}
 	symbols   *Class
 	template  *Class
 	tids      map[string]structData
@@ -38,11 +62,14 @@ type PLC struct {
 	tags      map[string]*Tag
 	timOff    time.Duration
 
-	Class       map[int]*Class
-	DumpNetwork bool // enables dumping network packets
-	Name        string
-	Verbose     bool // enables debugging output
-	Timeout     time.Duration
+	Class          map[int]*Class
+	DumpNetwork    bool   // enables dumping network packets (LogDump)
+	IOPort         int    // UDP port receiving O->T packets of class 1 connections, 0 is any free port; set before Serve
+	IOConsumerPort int    // UDP port of consumers receiving produced tags
+	Logger         Logger // receives log messages, nil is silent unless Verbose or DumpNetwork is set
+	Name           string
+	Verbose        bool // enables debugging output (LogDebug)
+	Timeout        time.Duration
 }
 
 // Init initializes library. Must be called first.
@@ -50,14 +77,20 @@ func Init(eds []byte) (*PLC, error) {
 	var p PLC
 	p.Class = make(map[int]*Class)
 	p.tags = make(map[string]*Tag)
+	p.programs = make(map[string]*program)
 	p.tids = make(map[string]structData)
+	p.hist = make(map[string]*history)
+	p.subs = make(map[*Subscription]struct{})
 	p.tidLast = 1
 	p.Timeout = 60 * time.Second
+	p.IOPort = ioPort
+	p.IOConsumerPort = ioPort
 
 	err := p.loadEDS(eds)
 	if err != nil {
 		return nil, err
 	}
+	p.addPredefinedTypes()
 
 	return &p, nil
 }
@@ -72,12 +105,6 @@ func InitEDS(eds string) (*PLC, error) {
 	return Init(edsB)
 }
 
-func (p *PLC) debug(args ...interface{}) {
-	if p.Verbose {
-		fmt.Println(args...)
-	}
-}
-
 // Callback registers function called at receiving communication with PLC.
 // tag may be nil in event of error or reset.
 func (p *PLC) Callback(function func(service int, status int, tag *Tag)) {
@@ -86,6 +113,25 @@ func (p *PLC) Callback(function func(service int, status int, tag *Tag)) {
 
 // Serve listens on the TCP network address host.
 func (p *PLC) Serve(host string) error {
+	l, err := p.Listen(host)
+	if err != nil {
+		return err
+	}
+	return p.ServeListener(l)
+}
+
+// Listen binds the TCP network address host for ServeListener, e.g. to report bind errors before serving in background.
+func (p *PLC) Listen(host string) (net.Listener, error) {
+	sock := net.ListenConfig{Control: p.sockControl}
+	return sock.Listen(context.Background(), "tcp", host)
+}
+
+// ServeListener serves on TCP listener l returned by Listen, and on UDP at the same address, until Close.
+func (p *PLC) ServeListener(l net.Listener) error {
+	serv, ok := l.(*net.TCPListener)
+	if !ok {
+		return errors.New("TCP listener expected")
+	}
 	rand.Seed(time.Now().UnixNano())
 
 	p.closeMut.Lock()
@@ -94,15 +140,29 @@ func (p *PLC) Serve(host string) error {
 
 	p.closeWait = sync.NewCond(&p.closeWMut)
 
-	sock := net.ListenConfig{}
-	sock.Control = sockControl
-	serv2, err := sock.Listen(context.Background(), "tcp", host)
-	if err != nil {
-		return err
+	addr := serv.Addr().(*net.TCPAddr)
+	host := addr.String()
+	if addr.IP.IsUnspecified() {
+		host = ":" + strconv.Itoa(addr.Port)
 	}
 	p.port = getPort(host)
-	serv := serv2.(*net.TCPListener)
-	go p.serveUDP(host)
+	var err error
+	udpDone := make(chan struct{})
+	go func() {
+		err := p.serveUDP(host)
+		if err != nil {
+			p.log(LogError, "serveUDP", "addr", host, "err", err)
+		}
+		close(udpDone)
+	}()
+	ioDone := make(chan struct{})
+	go func() {
+		err := p.serveIO(host)
+		if err != nil {
+			p.log(LogWarn, "class 1 O->T listener, Forward Open of produced tags rejected", "port", p.IOPort, "err", err)
+		}
+		close(ioDone)
+	}()
 	for {
 		err = serv.SetDeadline(time.Now().Add(time.Second))
 		if err != nil {
@@ -123,22 +183,29 @@ func (p *PLC) Serve(host string) error {
 		}
 	}
 	err = serv.Close()
+	<-udpDone
+	<-ioDone
 	if err != nil {
 		return err
 	}
-	p.debug("Serve shutdown")
+	p.log(LogDebug, "Serve shutdown")
 	p.closeWait.Signal()
 	return nil
 }
 
-// Close shutdowns server
+// Close shutdowns server, stops simulation and logic, and writes final snapshot if persistence is enabled.
 func (p *PLC) Close() {
 	p.closeMut.Lock()
 	p.closeI = true
 	p.closeMut.Unlock()
+	p.sim.stop()
+	p.StopLogic()
 	p.closeWait.L.Lock()
 	p.closeWait.Wait()
 	p.closeWait.L.Unlock()
+	if err := p.DisablePersistence(); err != nil {
+		p.log(LogError, "persistence", "err", err)
+	}
 }
 
 type req struct {
@@ -149,11 +216,13 @@ type req struct {
 	path     []pathEl
 
 	c        net.Conn
+	remote   net.Addr
 	connID   uint32
 	dataLen  int
 	lenRem   int
 	uDataLen int
 	encHead  encapsulationHeader
+	embFault *FaultRule // rule of request embedded in Multiple Service Packet acting on the whole response
 	file     map[int]*[3]uint8
 	maxData  int
 	maxFO    int
@@ -174,11 +243,11 @@ func (r *req) read(data interface{}) (bool, error) {
 	}
 	err := binary.Read(r.readBuf, binary.LittleEndian, data)
 	if err != nil {
-		fmt.Println(err)
+		r.log(LogDebug, "read", "err", err)
 	}
 	r.lenRem -= toRead
-	if r.p.DumpNetwork {
-		fmt.Printf("%#v\n", data)
+	if r.p.logEnabled(LogDump) {
+		r.log(LogDump, "read", "data", fmt.Sprintf("%#v", data))
 	}
 	return false, err
 }
@@ -186,23 +255,32 @@ func (r *req) read(data interface{}) (bool, error) {
 func (r *req) write(data interface{}) {
 	err := binary.Write(r.writeBuf, binary.LittleEndian, data)
 	if err != nil {
-		fmt.Println(err)
+		r.log(LogError, "write", "err", err)
 	}
 }
 
 func (r *req) writeCIP(data interface{}) {
 	err := binary.Write(r.wrCIPBuf, binary.LittleEndian, data)
 	if err != nil {
-		fmt.Println(err)
+		r.log(LogError, "write", "err", err)
 	}
 }
 
 func (r *req) reset() {
 	r.lenRem = -1
+	r.embFault = nil
 	r.writeBuf.Reset()
 	r.wrCIPBuf.Reset()
 }
 
+// discard skips unread data of encapsulation frame.
+func (r *req) discard() {
+	if r.lenRem > 0 {
+		io.CopyN(io.Discard, r.readBuf, int64(r.lenRem))
+		r.lenRem = 0
+	}
+}
+
 func (r *req) err(status int) bool {
 	r.resp.Status = uint8(status)
 	r.write(r.resp)
@@ -210,19 +288,38 @@ func (r *req) err(status int) bool {
 }
 
 func (p *PLC) handleRequest(conn net.Conn) {
+	p.capMut.RLock()
+	c, rec := p.capture, p.recorder
+	p.capMut.RUnlock()
+	if c != nil {
+		conn = c.conn(conn, false)
+	}
+	if rec != nil {
+		conn = rec.conn(conn)
+	}
 	r := req{}
 	r.connID = uint32(0)
 	r.c = conn
+	r.remote = conn.RemoteAddr()
 	r.file = make(map[int]*[3]uint8)
 	r.p = p
-	r.readBuf = bufio.NewReader(conn)
+	r.readBuf = bufio.NewReader(countingReader{r.c, &p.metrics})
 	r.writeBuf = new(bytes.Buffer)
 	r.wrCIPBuf = new(bytes.Buffer)
 	r.maxFO = 472
 
+	p.metrics.session(1)
+	defer func() {
+		if r.connID != 0 {
+			p.metrics.connection(-1)
+		}
+		p.metrics.session(-1)
+	}()
+
 loop:
 	for {
 		r.reset()
+		var fault *FaultRule
 
 		p.closeMut.RLock()
 		endP := p.closeI
@@ -234,11 +331,10 @@ loop:
 		timeout := time.Now().Add(p.Timeout)
 		err := conn.SetReadDeadline(timeout)
 		if err != nil {
-			fmt.Println(err)
+			r.log(LogError, "set deadline", "err", err)
 			break loop
 		}
 
-		p.debug()
 		_, err = r.read(&r.encHead)
 		if err != nil {
 			break loop
@@ -258,7 +354,7 @@ loop:
 			}
 
 		case ecUnRegisterSession:
-			p.debug("UnregisterSession")
+			r.log(LogDebug, "UnregisterSession")
 			break loop
 
 		case ecListIdentity:
@@ -272,11 +368,11 @@ loop:
 			}
 
 		case ecListInterfaces:
-			p.debug("ListInterfaces")
+			r.log(LogDebug, "ListInterfaces")
 			r.write(uint16(0)) // ItemCount
 
 		case ecSendRRData, ecSendUnitData:
-			p.debug("SendRRData/SendUnitData")
+			r.log(LogDebug, "SendRRData/SendUnitData")
 
 			var (
 				item         itemType
@@ -291,7 +387,7 @@ loop:
 				timeout = time.Now().Add(time.Duration(r.rrdata.Timeout) * time.Second)
 				err = conn.SetReadDeadline(timeout)
 				if err != nil {
-					fmt.Println(err)
+					r.log(LogError, "set deadline", "err", err)
 					break loop
 				}
 			}
@@ -301,7 +397,7 @@ loop:
 			itemserror := false
 
 			if r.rrdata.ItemCount != 2 {
-				p.debug("itemCount != 2")
+				r.log(LogDebug, "itemCount != 2")
 				r.encHead.Status = eipIncorrectData
 				break
 			}
@@ -319,7 +415,7 @@ loop:
 				}
 				cidok = true
 			} else if item.Type != itNullAddress {
-				p.debug("unkown address item:", item.Type)
+				r.log(LogWarn, "unknown address item", "type", hexField(item.Type))
 				itemserror = true
 				itemdata := make([]uint8, item.Length)
 				_, err = r.read(&itemdata)
@@ -344,7 +440,7 @@ loop:
 				r.dataLen -= 2
 				cidok = true
 			} else if item.Type != itUnconnData {
-				p.debug("unkown data item:", item.Type)
+				r.log(LogWarn, "unknown data item", "type", hexField(item.Type))
 				itemserror = true
 				itemdata := make([]uint8, item.Length)
 				_, err = r.read(&itemdata)
@@ -384,12 +480,10 @@ loop:
 				r.resp.AddStatusSize = 1
 				r.write(r.resp)
 				r.write(uint16(0))
-				r.readBuf.Reset(r.c)
+				r.readBuf.Reset(countingReader{r.c, &p.metrics})
 				goto errl
 			}
-			if p.Verbose {
-				fmt.Printf("Class %X Instance %X Attr %X %v\n", r.class, r.instance, r.attr, r.path)
-			}
+			r.log(LogDebug, "request", "path", r.path)
 
 			if r.class == ConnManager && r.instance == 1 && r.protd.Service == UnconnectedSend {
 				unc = true
@@ -428,18 +522,37 @@ loop:
 					r.resp.AddStatusSize = 1
 					r.write(r.resp)
 					r.write(uint16(0))
-					r.readBuf.Reset(r.c)
+					r.readBuf.Reset(countingReader{r.c, &p.metrics})
 					goto errl
 				}
-				if p.Verbose {
-					fmt.Printf("UNC SEND: Class %X Instance %X Attr %X %v\n", r.class, r.instance, r.attr, r.path)
+				r.log(LogDebug, "unconnected send", "path", r.path)
+			}
+
+			fault = r.fault()
+			if fault != nil {
+				if fault.Latency > 0 {
+					time.Sleep(fault.Latency)
+				}
+				if fault.Close {
+					r.log(LogInfo, "fault injected", "action", "close")
+					break loop
+				}
+				if r.faultStatus(fault) {
+					goto errl
 				}
 			}
 
 			if !r.serviceHandle() {
-				r.readBuf.Reset(r.c)
+				r.readBuf.Reset(countingReader{r.c, &p.metrics})
 				break loop
 			}
+			if fault == nil && r.embFault != nil {
+				fault = r.embFault
+				if fault.Close {
+					r.log(LogInfo, "fault injected", "action", "close")
+					break loop
+				}
+			}
 
 			if unc { // path
 				// fmt.Println(">>>", r.uDataLen)
@@ -463,7 +576,7 @@ loop:
 			}
 
 		default:
-			fmt.Println("unknown command:", r.encHead.Command)
+			r.log(LogWarn, "unknown command", "command", hexField(r.encHead.Command))
 
 			data := make([]uint8, r.encHead.Length)
 			_, err = r.read(&data)
@@ -477,37 +590,57 @@ loop:
 
 		err = conn.SetWriteDeadline(timeout)
 		if err != nil {
-			fmt.Println(err)
+			r.log(LogError, "set deadline", "err", err)
 			break loop
 		}
 
 		r.encHead.Length = uint16(r.wrCIPBuf.Len() + r.writeBuf.Len())
+		if fault != nil && fault.Drop {
+			r.log(LogInfo, "fault injected", "action", "drop")
+			continue
+		}
+		if fault != nil && fault.CorruptLength {
+			r.log(LogInfo, "fault injected", "action", "corrupt length")
+			r.encHead.Length += 16
+		}
 		var buf bytes.Buffer
 
 		err = binary.Write(&buf, binary.LittleEndian, r.encHead)
 		if err != nil {
-			fmt.Println(err)
+			r.log(LogError, "write", "err", err)
 			break loop
 		}
 		buf.Write(r.wrCIPBuf.Bytes())
 		buf.Write(r.writeBuf.Bytes())
 
-		_, err = conn.Write(buf.Bytes())
+		n, err := conn.Write(buf.Bytes())
+		p.metrics.bytes(0, n)
 		if err != nil {
-			fmt.Println(err)
+			r.log(LogWarn, "send", "err", err)
 			break loop
 		}
 	}
 	err := conn.Close()
 	if err != nil {
-		fmt.Println(err)
+		r.log(LogWarn, "close", "err", err)
 	}
 }
 
 func (r *req) serviceHandle() bool {
+	start := time.Now()
+	service, connID := r.protd.Service, r.connID
+	defer func() {
+		r.p.metrics.request(service, r.resp.Status, time.Since(start))
+		if connID == 0 && r.connID != 0 {
+			r.p.metrics.connection(1)
+		} else if connID != 0 && r.connID == 0 {
+			r.p.metrics.connection(-1)
+		}
+	}()
+
 	switch {
 	case r.class == MessageRouter && r.instance == 1 && r.protd.Service == MultiServ: // TODO errors, status 6
-		r.p.debug("MultipleServicePacket")
+		r.log(LogDebug, "MultipleServicePacket")
 
 		var (
 			count  uint16
@@ -556,11 +689,12 @@ func (r *req) serviceHandle() bool {
 			r.dataLen -= 2 + len(ePath)
 
 			r.class, r.instance, r.attr, r.member, r.path, err = r.parsePath(ePath)
-			if r.p.Verbose {
-				fmt.Printf("Class %X Instance %X Attr %X %v\n", r.class, r.instance, r.attr, r.path)
-			}
+			r.log(LogDebug, "multiple service request", "path", r.path)
 
 			svs[i] = offset + uint16(r.writeBuf.Len())
+			if f := r.fault(); f != nil && r.embeddedFault(f) {
+				continue
+			}
 			if !r.serviceHandle() {
 				return false
 			}
@@ -570,14 +704,14 @@ func (r *req) serviceHandle() bool {
 		r.write(newBuf.Bytes())
 
 	case r.protd.Service == GetAttrAll:
-		r.p.debug("GetAttributesAll")
+		r.log(LogDebug, "GetAttributesAll")
 
 		in := r.p.GetClassInstance(r.class, r.instance)
 		if in != nil {
 			r.write(r.resp)
 			r.write(in.getAttrAll())
 		} else {
-			r.p.debug("path unknown", r.path)
+			r.log(LogDebug, "path unknown", "path", r.path)
 			if r.class == FileClass {
 				r.resp.Status = ObjectNotExist
 			} else {
@@ -587,7 +721,7 @@ func (r *req) serviceHandle() bool {
 		}
 
 	case r.protd.Service == GetAttrList:
-		r.p.debug("GetAttributeList")
+		r.log(LogDebug, "GetAttributeList")
 		var (
 			count uint16
 			buf   bytes.Buffer
@@ -611,7 +745,7 @@ func (r *req) serviceHandle() bool {
 			for _, i := range attr {
 				bwrite(&buf, i)
 				if int(i) < ln && in.attr[i] != nil {
-					r.p.debug(in.attr[i].Name)
+					r.log(LogDebug, "attribute", "name", in.attr[i].Name)
 					st = Success
 					bwrite(&buf, st)
 					bwrite(&buf, in.attr[i].DataBytes())
@@ -627,7 +761,7 @@ func (r *req) serviceHandle() bool {
 			r.write(count)
 			r.write(buf.Bytes())
 		} else {
-			r.p.debug("path unknown", r.path)
+			r.log(LogDebug, "path unknown", "path", r.path)
 			if r.class == FileClass {
 				r.resp.Status = ObjectNotExist
 			} else {
@@ -637,7 +771,7 @@ func (r *req) serviceHandle() bool {
 		}
 
 	case r.protd.Service == SetAttrList:
-		r.p.debug("SetAttributeList")
+		r.log(LogDebug, "SetAttributeList")
 		var (
 			attr  uint16
 			count uint16
@@ -661,7 +795,7 @@ func (r *req) serviceHandle() bool {
 				}
 				bwrite(&buf, attr)
 				if int(attr) < ln && in.attr[attr] != nil {
-					r.p.debug(in.attr[attr].Name)
+					r.log(LogDebug, "attribute", "name", in.attr[attr].Name)
 					wrData := make([]uint8, len(in.attr[attr].data))
 					rb, err := r.read(wrData)
 					if err != nil {
@@ -685,7 +819,7 @@ func (r *req) serviceHandle() bool {
 			r.write(count)
 			r.write(buf.Bytes())
 		} else {
-			r.p.debug("path unknown", r.path)
+			r.log(LogDebug, "path unknown", "path", r.path)
 			if r.class == FileClass {
 				r.resp.Status = ObjectNotExist
 			} else {
@@ -694,8 +828,8 @@ func (r *req) serviceHandle() bool {
 			r.write(r.resp)
 		}
 
-	case r.class == SymbolClass && r.protd.Service == GetInstAttrList:
-		r.p.debug("GetInstanceAttributesList")
+	case (r.class == -1 || r.class == SymbolClass) && r.protd.Service == GetInstAttrList:
+		r.log(LogDebug, "GetInstanceAttributesList")
 		var (
 			count uint16
 			buf   bytes.Buffer
@@ -711,7 +845,13 @@ func (r *req) serviceHandle() bool {
 			return rb
 		}
 
-		li, ins := r.p.GetClassInstancesList(r.class, r.instance, 0)
+		var (
+			li  []int
+			ins []*Instance
+		)
+		if c, from := r.p.scopeSymbols(r.path); c != nil {
+			li, ins = c.list(from, 0)
+		}
 		if li != nil {
 			for a, x := range li {
 				if buf.Len() >= r.maxData-20 {
@@ -739,18 +879,18 @@ func (r *req) serviceHandle() bool {
 		}
 
 	case r.protd.Service == GetAttr:
-		r.p.debug("GetAttributeSingle")
+		r.log(LogDebug, "GetAttributeSingle")
 
 		at, aok, in := r.p.GetClassInstanceAttr(r.class, r.instance, r.attr)
 
 		r.resp.Service = r.protd.Service + 128
 
 		if in && aok {
-			r.p.debug(at.Name)
+			r.log(LogDebug, "attribute", "name", at.Name)
 			r.write(r.resp)
 			r.write(at.DataBytes())
 		} else {
-			r.p.debug("path unknown", r.path)
+			r.log(LogDebug, "path unknown", "path", r.path)
 			if in {
 				r.resp.Status = AttrNotSup
 			} else if r.class == FileClass {
@@ -762,7 +902,7 @@ func (r *req) serviceHandle() bool {
 		}
 
 	case r.protd.Service == SetAttr:
-		r.p.debug("SetAttributeSingle")
+		r.log(LogDebug, "SetAttributeSingle")
 
 		var (
 			aok bool
@@ -780,14 +920,14 @@ func (r *req) serviceHandle() bool {
 		r.resp.Service = r.protd.Service + 128
 
 		if in && aok {
-			r.p.debug(at.Name)
+			r.log(LogDebug, "attribute", "name", at.Name)
 			if r.instance == 0 {
 				r.resp.Status = ServNotSup
 			} else {
 				r.resp.Status = at.SetDataBytes(wrData)
 			}
 		} else {
-			r.p.debug("path unknown", r.path)
+			r.log(LogDebug, "path unknown", "path", r.path)
 			if in {
 				if r.instance == 0 {
 					r.resp.Status = ServNotSup
@@ -803,7 +943,7 @@ func (r *req) serviceHandle() bool {
 		r.write(r.resp)
 
 	case r.class == FileClass && r.instance != 0 && r.protd.Service == InititateUpload:
-		r.p.debug("InititateUpload")
+		r.log(LogDebug, "InititateUpload")
 		var maxSize uint8
 
 		rb, err := r.read(&maxSize)
@@ -824,7 +964,7 @@ func (r *req) serviceHandle() bool {
 		}
 
 	case r.class == FileClass && r.instance != 0 && r.protd.Service == UploadTransfer:
-		r.p.debug("UploadTransfer")
+		r.log(LogDebug, "UploadTransfer")
 		var transferNo uint8
 
 		rb, err := r.read(&transferNo)
@@ -837,7 +977,7 @@ func (r *req) serviceHandle() bool {
 		if in != nil && fok {
 			if transferNo == f[1] || transferNo == f[1]+1 || (transferNo == 0 && f[1] == 255) {
 				if transferNo == 0 && f[1] == 255 { // rollover
-					r.p.debug("rollover")
+					r.log(LogDebug, "rollover")
 					f[2]++ // FIXME retry!
 				}
 
@@ -864,7 +1004,7 @@ func (r *req) serviceHandle() bool {
 				}
 				f[1] = transferNo
 
-				r.p.debug(pos, ":", posto)
+				r.log(LogDebug, "upload", "from", pos, "to", posto)
 
 				r.write(r.resp)
 				r.write(sr)
@@ -873,7 +1013,7 @@ func (r *req) serviceHandle() bool {
 					r.write(in.getAttrData(7))
 				}
 			} else {
-				r.p.debug("transfer number error", transferNo)
+				r.log(LogWarn, "transfer number error", "transfer", transferNo)
 
 				r.resp.Status = InvalidPar
 				r.resp.AddStatusSize = 1
@@ -886,7 +1026,7 @@ func (r *req) serviceHandle() bool {
 		}
 
 	case r.class == ConnManager && r.instance == 1 && r.protd.Service == ForwardOpen:
-		r.p.debug("ForwardOpen")
+		r.log(LogDebug, "ForwardOpen")
 
 		var (
 			fodata forwardOpenData
@@ -912,14 +1052,23 @@ func (r *req) serviceHandle() bool {
 		sr.TOAPI = fodata.TORPI
 		sr.AppReplySize = 0
 
-		r.connID = fodata.TOConnectionID
-		r.maxFO = int(fodata.TOConnPar&0x1FF) - 32
+		if fodata.TransportType&0x0F == 1 {
+			io := ioRequest{serial: fodata.ConnSerialNumber, vendor: fodata.VendorID, orig: fodata.OriginatorSerialNumber,
+				otID: sr.OTConnectionID, toID: fodata.TOConnectionID, rpi: fodata.TORPI, size: int(fodata.TOConnPar & 0x1FF),
+				timeout: ioTimeout(fodata.OTRPI, fodata.ConnTimeoutMult)}
+			if !r.openIO(connPath, io) {
+				break
+			}
+		} else {
+			r.connID = fodata.TOConnectionID
+			r.maxFO = int(fodata.TOConnPar&0x1FF) - 32
+		}
 
 		r.write(r.resp)
 		r.write(sr)
 
 	case r.class == ConnManager && r.instance == 1 && r.protd.Service == LargeForwOpen:
-		r.p.debug("LargeForwardOpen")
+		r.log(LogDebug, "LargeForwardOpen")
 
 		var (
 			fodata largeForwardOpenData
@@ -945,14 +1094,23 @@ func (r *req) serviceHandle() bool {
 		sr.TOAPI = fodata.TORPI
 		sr.AppReplySize = 0
 
-		r.connID = fodata.TOConnectionID
-		r.maxFO = int(fodata.TOConnPar&0xFFFF) - 32
+		if fodata.TransportType&0x0F == 1 {
+			io := ioRequest{serial: fodata.ConnSerialNumber, vendor: fodata.VendorID, orig: fodata.OriginatorSerialNumber,
+				otID: sr.OTConnectionID, toID: fodata.TOConnectionID, rpi: fodata.TORPI, size: int(fodata.TOConnPar & 0xFFFF),
+				timeout: ioTimeout(fodata.OTRPI, fodata.ConnTimeoutMult)}
+			if !r.openIO(connPath, io) {
+				break
+			}
+		} else {
+			r.connID = fodata.TOConnectionID
+			r.maxFO = int(fodata.TOConnPar&0xFFFF) - 32
+		}
 
 		r.write(r.resp)
 		r.write(sr)
 
 	case r.class == ConnManager && r.instance == 1 && r.protd.Service == ForwardClose:
-		r.p.debug("ForwardClose")
+		r.log(LogDebug, "ForwardClose")
 
 		var (
 			fcdata forwardCloseData
@@ -974,13 +1132,15 @@ func (r *req) serviceHandle() bool {
 		sr.OriginatorSerialNumber = fcdata.OriginatorSerialNumber
 		sr.AppReplySize = 0
 
-		r.connID = 0
+		if !r.p.closeIO(fcdata.ConnSerialNumber, fcdata.VendorID, fcdata.OriginatorSerialNumber) {
+			r.connID = 0
+		}
 
 		r.write(r.resp)
 		r.write(sr)
 
 	case r.class == TemplateClass && r.protd.Service == ReadTemplate:
-		r.p.debug("ReadTemplate")
+		r.log(LogDebug, "ReadTemplate")
 
 		var rd readTemplateResponse
 
@@ -988,7 +1148,7 @@ func (r *req) serviceHandle() bool {
 		if err != nil {
 			return rb
 		}
-		r.p.debug(rd.Offset, rd.Number)
+		r.log(LogDebug, "template", "offset", rd.Offset, "number", rd.Number)
 
 		if in := r.p.GetClassInstance(r.class, r.instance); in != nil && rd.Offset < uint32(len(in.data)) {
 			data := in.data[rd.Offset:]
@@ -1003,7 +1163,7 @@ func (r *req) serviceHandle() bool {
 		}
 
 	case r.class == 0xAC && r.protd.Service == ReadTag:
-		fmt.Println("unknown service:", r.protd.Service)
+		r.log(LogWarn, "unknown service", "status", hexField(ServNotSup))
 
 		data := make([]uint8, r.dataLen)
 		rb, err := r.read(&data)
@@ -1014,7 +1174,7 @@ func (r *req) serviceHandle() bool {
 		r.err(ServNotSup)
 
 	case (r.class == -1 || r.class == SymbolClass) && r.protd.Service == ReadTag:
-		r.p.debug("ReadTag")
+		r.log(LogDebug, "ReadTag")
 
 		var tagCount uint16
 
@@ -1047,7 +1207,7 @@ func (r *req) serviceHandle() bool {
 		}
 
 	case (r.class == -1 || r.class == SymbolClass) && r.protd.Service == ReadTagFrag:
-		r.p.debug("ReadTagFragmented")
+		r.log(LogDebug, "ReadTagFragmented")
 
 		var (
 			tagCount  uint16
@@ -1088,7 +1248,7 @@ func (r *req) serviceHandle() bool {
 		}
 
 	case (r.class == -1 || r.class == SymbolClass) && r.protd.Service == ReadModifyWrite:
-		r.p.debug("ReadModifyWrite")
+		r.log(LogDebug, "ReadModifyWrite")
 
 		var maskSize uint16
 
@@ -1117,7 +1277,7 @@ func (r *req) serviceHandle() bool {
 		}
 
 	case (r.class == -1 || r.class == SymbolClass) && r.protd.Service == WriteTag:
-		r.p.debug("WriteTag")
+		r.log(LogDebug, "WriteTag")
 
 		var (
 			tagType  uint16
@@ -1157,7 +1317,7 @@ func (r *req) serviceHandle() bool {
 		}
 
 	case (r.class == -1 || r.class == SymbolClass) && r.protd.Service == WriteTagFrag:
-		r.p.debug("WriteTagFragmented")
+		r.log(LogDebug, "WriteTagFragmented")
 
 		var (
 			tagType   uint16
@@ -1202,7 +1362,7 @@ func (r *req) serviceHandle() bool {
 		}
 
 	case r.protd.Service == Reset:
-		r.p.debug("Reset")
+		r.log(LogDebug, "Reset")
 
 		data := make([]uint8, r.dataLen)
 		rb, err := r.read(&data)
@@ -1221,7 +1381,7 @@ func (r *req) serviceHandle() bool {
 		r.write(r.resp)
 
 	case r.protd.Service == NextInst:
-		r.p.debug("FindNextObjectInstance")
+		r.log(LogDebug, "FindNextObjectInstance")
 		var (
 			count uint8
 			buf   bytes.Buffer
@@ -1246,15 +1406,15 @@ func (r *req) serviceHandle() bool {
 		}
 
 	case r.protd.Service == GetMember:
-		r.p.debug("GetMember")
+		r.log(LogDebug, "GetMember")
 
-		fmt.Println(r.class, r.instance, r.attr, r.member)
+		r.log(LogDebug, "member", "member", r.member)
 
 		at, aok, in := r.p.GetClassInstanceAttr(r.class, r.instance, r.attr)
 		r.resp.Service = r.protd.Service + 128
 
 		if in && aok && at.st != nil && at.st.l > 0 {
-			r.p.debug(at.Name)
+			r.log(LogDebug, "attribute", "name", at.Name)
 			from := r.member * at.st.l
 			to := from + at.st.l
 			if to > len(at.data) {
@@ -1267,7 +1427,7 @@ func (r *req) serviceHandle() bool {
 		}
 
 	default:
-		fmt.Println("unknown service:", r.protd.Service)
+		r.log(LogWarn, "unknown service", "status", hexField(ServNotSup))
 
 		data := make([]uint8, r.dataLen)
 		rb, err := r.read(&data)
@@ -0,0 +1,61 @@
+package plcconnector
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// AddAlias adds alias tag of target tag, structure member, array element or bit, e.g. "Local:1:I.Data.0".
+// Alias has type of the target and is browsed as other tags. Reads and writes go to the base tag, also reported under its name.
+func (p *PLC) AddAlias(name string, target string) error {
+	return p.addAlias(name, target, 0)
+}
+
+// addAlias adds alias tag with symbol instance inst, or the next free one if 0.
+func (p *PLC) addAlias(name string, target string, inst int) error {
+	pth := parsePath(target)
+	if pth == nil {
+		return errors.New("invalid alias target " + target)
+	}
+	p.tMut.RLock()
+	_, exists := p.tags[strings.ToLower(name)]
+	r, err := p.resolve(pth)
+	p.tMut.RUnlock()
+	if exists {
+		return errors.New("tag " + name + " already exists")
+	}
+	if err != nil {
+		return err
+	}
+	t := r.t
+	t.Name = name
+	t.alias = pth
+	t.data = nil
+	t.offset = 0
+	t.bit = 0
+	t.prot = r.tag.prot
+	if t.Type < TypeStructHead {
+		t.Type &^= TypeArray3D
+	}
+	if inst == 0 {
+		inst = -1
+	}
+	p.addTag(t, inst)
+	return nil
+}
+
+// aliasesOf returns aliases whose target is in tag of lower case name, sorted by name. Must be called with tMut locked.
+func (p *PLC) aliasesOf(name string) []*Tag {
+	var list []*Tag
+	for _, t := range p.tags {
+		if t.alias == nil {
+			continue
+		}
+		if base, _ := p.tagName(t.alias); strings.ToLower(base) == name {
+			list = append(list, t)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
@@ -0,0 +1,133 @@
+package plcconnector
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestAddAlias(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.NewUDT("DATATYPE MOTOR DINT Speed; BOOL Run; END_DATATYPE")
+	p.CreateTag("MOTOR", "m")
+	p.NewTag(int32(0), "Data")
+	p.NewTag([]int16{1, 2, 3}, "arr")
+
+	aliases := []struct {
+		name, target string
+		typ          int
+		ok           bool
+	}{
+		{"Start", "Data.3", TypeBOOL, true},
+		{"Spd", "m.Speed", TypeDINT, true},
+		{"Run", "m.Run", TypeBOOL, true},
+		{"Second", "arr[1]", TypeINT, true},
+		{"Ref", "Spd", TypeDINT, true},
+		{"Start", "Data.1", 0, false},
+		{"X", "none", 0, false},
+		{"Y", "Data.40", 0, false},
+		{"Z", "arr[3]", 0, false},
+	}
+	for _, a := range aliases {
+		err := p.AddAlias(a.name, a.target)
+		if (err == nil) != a.ok {
+			t.Errorf("AddAlias(%s, %s): %v", a.name, a.target, err)
+			continue
+		}
+		if a.ok {
+			typ := p.tags[strings.ToLower(a.name)].in.attr[2].DataINT()[0]
+			if int(typ) != a.typ {
+				t.Errorf("%s: symbol type 0x%X, want 0x%X", a.name, typ, a.typ)
+			}
+		}
+	}
+
+	writes := []struct {
+		path string
+		typ  uint16
+		data []uint8
+	}{
+		{"Start", TypeBOOL, []uint8{1}},
+		{"Ref", TypeDINT, []uint8{7, 0, 0, 0}},
+		{"Second", TypeINT, []uint8{9, 0}},
+	}
+	for _, w := range writes {
+		if !p.saveTag(parsePath(w.path), w.typ, 1, w.data, 0) {
+			t.Errorf("write %s failed", w.path)
+		}
+	}
+	if err = p.SetValue("Run", "true"); err != nil {
+		t.Error(err)
+	}
+
+	reads := []struct {
+		path string
+		typ  uint32
+		want []uint8
+	}{
+		{"Data", TypeDINT, []uint8{8, 0, 0, 0}},
+		{"Start", TypeBOOL, []uint8{0xFF}},
+		{"m.Speed", TypeDINT, []uint8{7, 0, 0, 0}},
+		{"Spd", TypeDINT, []uint8{7, 0, 0, 0}},
+		{"m.Run", TypeBOOL, []uint8{0xFF}},
+		{"arr", TypeINT, []uint8{1, 0}},
+		{"Second", TypeINT, []uint8{9, 0}},
+	}
+	for _, r := range reads {
+		data, typ, _, ok := p.readTag(parsePath(r.path), 1)
+		if !ok || typ != r.typ || !bytes.Equal(data, r.want) {
+			t.Errorf("read %s = % X, 0x%X, want % X, 0x%X", r.path, data, typ, r.want, r.typ)
+		}
+	}
+	if p.tags["start"].data != nil {
+		t.Error("alias has own data")
+	}
+}
+
+func TestAliasRemoveRename(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.NewTag(int32(5), "d")
+	p.NewTag(int16(6), "Program:Main.x")
+	for _, a := range [][2]string{{"B", "d"}, {"Bit", "d.0"}, {"C", "B"}, {"Program:Main.y", "Program:Main.x"}} {
+		if err = p.AddAlias(a[0], a[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, n := range []string{"d", "B", "Program:Main.x"} {
+		if p.RemoveTag(n) == nil {
+			t.Errorf("RemoveTag(%s) removed aliased tag", n)
+		}
+	}
+	for _, r := range [][2]string{{"d", "e"}, {"B", "B2"}, {"Program:Main.x", "Program:Main.z"}} {
+		if err = p.RenameTag(r[0], r[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reads := []struct {
+		path string
+		want []uint8
+	}{
+		{"B2", []uint8{5, 0, 0, 0}},
+		{"C", []uint8{5, 0, 0, 0}},
+		{"Bit", []uint8{0xFF}},
+		{"Program:Main.y", []uint8{6, 0}},
+	}
+	for _, r := range reads {
+		if data, _, _, ok := p.readTag(parsePath(r.path), 1); !ok || !bytes.Equal(data, r.want) {
+			t.Errorf("read %s after rename = % X, %v", r.path, data, ok)
+		}
+	}
+
+	for _, n := range []string{"C", "Bit", "B2", "e"} {
+		if err = p.RemoveTag(n); err != nil {
+			t.Errorf("RemoveTag(%s): %v", n, err)
+		}
+	}
+}
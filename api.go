@@ -0,0 +1,470 @@
+package plcconnector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const apiPrefix = "/api/v1/tags"
+
+type apiTag struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Dims   []int  `json:"dims,omitempty"`
+	Size   int    `json:"size"`
+	Access string `json:"access"`
+}
+
+type apiValue struct {
+	Path  string      `json:"path"`
+	Type  string      `json:"type"`
+	Dims  []int       `json:"dims,omitempty"`
+	Value interface{} `json:"value"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func apiDims(t Tag) []int {
+	var d []int
+	for i := 0; i < 3 && t.Dim[i] > 0; i++ {
+		d = append(d, t.Dim[i])
+	}
+	return d
+}
+
+func apiAccess(prot uint8) string {
+	switch prot {
+	case 0:
+		return "rw"
+	case 2:
+		return "r"
+	default:
+		return "none"
+	}
+}
+
+func apiSend(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		buf.Reset()
+		status = http.StatusInternalServerError
+		json.NewEncoder(&buf).Encode(apiError{Error: err.Error()})
+	}
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+func apiFail(w http.ResponseWriter, status int, err string) {
+	apiSend(w, status, apiError{Error: err})
+}
+
+// apiHTTP serves REST API:
+//
+//	GET /api/v1/tags          list of tags
+//	GET /api/v1/tags/{path}   value of tag, member or element
+//	PUT /api/v1/tags/{path}   write value, body {"value": ...}
+func (p *PLC) apiHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == apiPrefix || r.URL.Path == apiPrefix+"/" {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			apiFail(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		p.apiList(w, r)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, apiPrefix+"/") {
+		apiFail(w, http.StatusNotFound, "not found")
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, apiPrefix+"/")
+	pth := parsePath(name)
+	if pth == nil {
+		apiFail(w, http.StatusBadRequest, "invalid path "+name)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		p.tMut.RLock()
+		ref, err := p.resolve(pth)
+		if err != nil {
+			p.tMut.RUnlock()
+			apiFail(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if !p.allowed(r, ref.tag, false) {
+			p.tMut.RUnlock()
+			apiFail(w, http.StatusForbidden, "read of "+ref.tag.Name+" not allowed")
+			return
+		}
+		v := apiValue{Path: name, Type: ref.t.TypeString(), Dims: apiDims(ref.t), Value: encodeValue(ref.t, ref.data(), ref.bit)}
+		p.tMut.RUnlock()
+		apiSend(w, http.StatusOK, v)
+	case http.MethodPut:
+		var body struct {
+			Value *json.RawMessage `json:"value"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil || body.Value == nil {
+			apiFail(w, http.StatusBadRequest, "body must be {\"value\": ...}")
+			return
+		}
+		var v interface{}
+		d := json.NewDecoder(strings.NewReader(string(*body.Value)))
+		d.UseNumber()
+		if err = d.Decode(&v); err != nil {
+			apiFail(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		status, err := p.writePath(r, pth, name, string(*body.Value), func(t Tag, data []uint8, bit int) error {
+			return decodeValue(t, data, bit, v)
+		})
+		if err != nil {
+			apiFail(w, status, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPut)
+		apiFail(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (p *PLC) apiList(w http.ResponseWriter, r *http.Request) {
+	p.tMut.RLock()
+	list := make([]apiTag, 0, len(p.tags))
+	for _, t := range p.tags {
+		if !p.allowed(r, t, false) {
+			continue
+		}
+		list = append(list, apiTag{Name: t.Name, Type: t.TypeString(), Dims: apiDims(*t), Size: len(t.data), Access: apiAccess(t.prot)})
+	}
+	p.tMut.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	apiSend(w, http.StatusOK, list)
+}
+
+// writePath resolves path of HTTP request r and lets set modify copy of the referenced data, which is then stored in the tag.
+// Value is used in audit log. It returns HTTP status on error.
+func (p *PLC) writePath(r *http.Request, path []pathEl, name string, value string, set func(t Tag, data []uint8, bit int) error) (int, error) {
+	p.tMut.Lock()
+	defer p.tMut.Unlock()
+
+	ref, err := p.resolve(path)
+	if err != nil {
+		return http.StatusNotFound, err
+	}
+	if !p.allowed(r, ref.tag, true) {
+		p.audit(r, name, value, "forbidden")
+		return http.StatusForbidden, errors.New("write to " + ref.tag.Name + " not allowed")
+	}
+	dst := ref.data()
+	buf := append([]uint8{}, dst...)
+	if err = set(ref.t, buf, ref.bit); err != nil {
+		p.audit(r, name, value, err.Error())
+		return http.StatusBadRequest, err
+	}
+	copy(dst, buf)
+	p.audit(r, name, value, "ok")
+	p.tagWritten(ref.tag, ref.off, buf, "HTTP", WriteTag, Tag{Type: ref.t.Type})
+	return http.StatusOK, nil
+}
+
+// SetValue writes JSON value to tag, member, element or bit at path, the same way as PUT of the REST API.
+func (p *PLC) SetValue(path string, value string) error {
+	pth := parsePath(path)
+	if pth == nil {
+		return errors.New("invalid path " + path)
+	}
+	var v interface{}
+	d := json.NewDecoder(strings.NewReader(value))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return err
+	}
+
+	p.tMut.Lock()
+	defer p.tMut.Unlock()
+	ref, err := p.resolve(pth)
+	if err != nil {
+		return err
+	}
+	dst := ref.data()
+	buf := append([]uint8{}, dst...)
+	if err = decodeValue(ref.t, buf, ref.bit, v); err != nil {
+		return errors.New(path + ": " + err.Error())
+	}
+	copy(dst, buf)
+	p.tagWritten(ref.tag, ref.off, buf, "SetValue", WriteTag, Tag{Type: ref.t.Type})
+	return nil
+}
+
+// elemType returns type of array element.
+func elemType(t Tag) Tag {
+	t.Dim = [3]int{}
+	if t.Type < TypeStructHead {
+		t.Type &^= TypeArray3D
+	}
+	return t
+}
+
+// encodeValue converts data of t to JSON value: bool, number, string, array or object of members.
+// bit >= 0 selects single bit of data[0].
+func encodeValue(t Tag, data []uint8, bit int) interface{} {
+	if bit >= 0 {
+		return data[0]&(1<<uint(bit)) != 0
+	}
+	if t.Dim[0] > 0 {
+		e := elemType(t)
+		n := t.Dims()
+		v := make([]interface{}, n)
+		for i := 0; i < n; i++ {
+			if t.boolArray() {
+				v[i] = encodeValue(e, data[i/8:], i%8)
+			} else {
+				l := e.ElemLen()
+				v[i] = encodeValue(e, data[i*l:(i+1)*l], -1)
+			}
+		}
+		return nestDims(v, apiDims(t))
+	}
+	if t.Type >= TypeStructHead {
+		if t.st.isString() {
+			return t.st.getString(data)
+		}
+		m := make(map[string]interface{}, len(t.st.d))
+		for _, el := range t.st.d {
+			if strings.HasPrefix(el.Name, "ZZZZZZZZZZ") {
+				continue
+			}
+			if el.BasicType() == TypeBOOL && el.Dim[0] == 0 {
+				m[el.Name] = encodeValue(el, data[el.offset:], el.bit)
+			} else {
+				m[el.Name] = encodeValue(el, data[el.offset:el.offset+el.dataLen()], -1)
+			}
+		}
+		return m
+	}
+	switch t.NumType() {
+	case TypeBOOL:
+		return data[0] != 0
+	case TypeSINT:
+		return int8(data[0])
+	case TypeUSINT:
+		return data[0]
+	case TypeINT:
+		return int16(binary.LittleEndian.Uint16(data))
+	case TypeUINT:
+		return binary.LittleEndian.Uint16(data)
+	case TypeDINT:
+		return int32(binary.LittleEndian.Uint32(data))
+	case TypeUDINT:
+		return binary.LittleEndian.Uint32(data)
+	case TypeLINT:
+		return int64(binary.LittleEndian.Uint64(data))
+	case TypeULINT:
+		return binary.LittleEndian.Uint64(data)
+	case TypeREAL:
+		f := math.Float32frombits(binary.LittleEndian.Uint32(data))
+		if s, ok := nonFinite(float64(f)); ok {
+			return s
+		}
+		return f
+	case TypeLREAL:
+		f := math.Float64frombits(binary.LittleEndian.Uint64(data))
+		if s, ok := nonFinite(f); ok {
+			return s
+		}
+		return f
+	}
+	return data
+}
+
+// nonFinite returns "NaN", "Infinity" or "-Infinity" for values JSON cannot represent as number.
+func nonFinite(f float64) (string, bool) {
+	switch {
+	case math.IsNaN(f):
+		return "NaN", true
+	case math.IsInf(f, 1):
+		return "Infinity", true
+	case math.IsInf(f, -1):
+		return "-Infinity", true
+	}
+	return "", false
+}
+
+// nestDims splits flat row-major list into nested lists.
+func nestDims(v []interface{}, dims []int) interface{} {
+	if len(dims) <= 1 {
+		return v
+	}
+	n := len(v) / dims[0]
+	r := make([]interface{}, dims[0])
+	for i := range r {
+		r[i] = nestDims(v[i*n:(i+1)*n], dims[1:])
+	}
+	return r
+}
+
+// decodeValue writes JSON value v (decoded with UseNumber) to data of t.
+func decodeValue(t Tag, data []uint8, bit int, v interface{}) error {
+	if bit >= 0 {
+		b, err := jsonBool(v)
+		if err != nil {
+			return err
+		}
+		if b {
+			data[0] |= 1 << uint(bit)
+		} else {
+			data[0] &^= 1 << uint(bit)
+		}
+		return nil
+	}
+	if t.Dim[0] > 0 {
+		e := elemType(t)
+		i := 0
+		return decodeArray(v, apiDims(t), func(v interface{}) error {
+			var err error
+			if t.boolArray() {
+				err = decodeValue(e, data[i/8:], i%8, v)
+			} else {
+				l := e.ElemLen()
+				err = decodeValue(e, data[i*l:(i+1)*l], -1, v)
+			}
+			i++
+			return err
+		})
+	}
+	if t.Type >= TypeStructHead {
+		if s, ok := v.(string); ok {
+			if !t.st.isString() {
+				return errors.New(t.TypeString() + " is not a string")
+			}
+			return t.st.setString(data, s)
+		}
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return errors.New("object expected for " + t.TypeString())
+		}
+		for n, mv := range m {
+			el := t.st.Elem(n)
+			if el == nil {
+				return errors.New("no member " + n + " in " + t.st.n)
+			}
+			var err error
+			if el.BasicType() == TypeBOOL && el.Dim[0] == 0 {
+				err = decodeValue(*el, data[el.offset:], el.bit, mv)
+			} else {
+				err = decodeValue(*el, data[el.offset:el.offset+el.dataLen()], -1, mv)
+			}
+			if err != nil {
+				return errors.New(n + ": " + err.Error())
+			}
+		}
+		return nil
+	}
+	if t.NumType() == TypeBOOL {
+		b, err := jsonBool(v)
+		if err != nil {
+			return err
+		}
+		data[0] = boolByte(b)
+		return nil
+	}
+	num, ok := v.(json.Number)
+	if s, isStr := v.(string); isStr && (t.NumType() == TypeREAL || t.NumType() == TypeLREAL) {
+		num, ok = json.Number(s), true // non-finite value
+	}
+	if !ok {
+		return errors.New("number expected for " + t.TypeString())
+	}
+	var (
+		i   int64
+		u   uint64
+		f   float64
+		err error
+	)
+	switch t.NumType() {
+	case TypeSINT:
+		i, err = strconv.ParseInt(string(num), 10, 8)
+		data[0] = uint8(i)
+	case TypeINT:
+		i, err = strconv.ParseInt(string(num), 10, 16)
+		binary.LittleEndian.PutUint16(data, uint16(i))
+	case TypeDINT:
+		i, err = strconv.ParseInt(string(num), 10, 32)
+		binary.LittleEndian.PutUint32(data, uint32(i))
+	case TypeLINT:
+		i, err = strconv.ParseInt(string(num), 10, 64)
+		binary.LittleEndian.PutUint64(data, uint64(i))
+	case TypeUSINT:
+		u, err = strconv.ParseUint(string(num), 10, 8)
+		data[0] = uint8(u)
+	case TypeUINT:
+		u, err = strconv.ParseUint(string(num), 10, 16)
+		binary.LittleEndian.PutUint16(data, uint16(u))
+	case TypeUDINT:
+		u, err = strconv.ParseUint(string(num), 10, 32)
+		binary.LittleEndian.PutUint32(data, uint32(u))
+	case TypeULINT:
+		u, err = strconv.ParseUint(string(num), 10, 64)
+		binary.LittleEndian.PutUint64(data, u)
+	case TypeREAL:
+		f, err = strconv.ParseFloat(string(num), 32)
+		binary.LittleEndian.PutUint32(data, math.Float32bits(float32(f)))
+	case TypeLREAL:
+		f, err = strconv.ParseFloat(string(num), 64)
+		binary.LittleEndian.PutUint64(data, math.Float64bits(f))
+	default:
+		return errors.New("unsupported type " + t.TypeString())
+	}
+	if err != nil {
+		return errors.New("invalid " + t.TypeString() + " value " + string(num))
+	}
+	return nil
+}
+
+// decodeArray calls set for elements of nested list v in row-major order.
+func decodeArray(v interface{}, dims []int, set func(interface{}) error) error {
+	l, ok := v.([]interface{})
+	if !ok || len(l) != dims[0] {
+		return errors.New("array of " + strconv.Itoa(dims[0]) + " elements expected")
+	}
+	for _, e := range l {
+		var err error
+		if len(dims) > 1 {
+			err = decodeArray(e, dims[1:], set)
+		} else {
+			err = set(e)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func jsonBool(v interface{}) (bool, error) {
+	switch b := v.(type) {
+	case bool:
+		return b, nil
+	case json.Number:
+		if b == "0" || b == "1" {
+			return b == "1", nil
+		}
+	}
+	return false, errors.New("BOOL value expected")
+}
@@ -0,0 +1,137 @@
+package plcconnector
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPI(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.NewUDT("DATATYPE MOTOR BOOL Run; BOOL Fault; INT Speed; STRING Name; DINT Pos[2]; END_DATATYPE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []struct {
+		name, typ string
+		dim       [3]int
+	}{
+		{"m", "MOTOR", [3]int{2}},
+		{"flags", "BOOL", [3]int{40}},
+		{"grid", "SINT", [3]int{2, 3}},
+		{"r", "REAL", [3]int{}},
+		{"u", "UINT", [3]int{}},
+	} {
+		tg, err := p.importTag(d.name, d.typ, d.dim, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.AddTag(tg)
+	}
+
+	tests := []struct {
+		method, path, body string
+		code               int
+		want               string
+	}{
+		{"PUT", "/api/v1/tags/m[1]", `{"value": {"Run": true, "Speed": -5, "Name": "pump", "Pos": [1, 2]}}`, 204, ""},
+		{"GET", "/api/v1/tags/m[1]", "", 200, `{"path":"m[1]","type":"MOTOR","value":{"Fault":false,"Name":"pump","Pos":[1,2],"Run":true,"Speed":-5}}`},
+		{"GET", "/api/v1/tags/m[1].Pos[1]", "", 200, `{"path":"m[1].Pos[1]","type":"DINT","value":2}`},
+		{"GET", "/api/v1/tags/m[0].Run", "", 200, `{"path":"m[0].Run","type":"BOOL","value":false}`},
+		{"PUT", "/api/v1/tags/m[0].Speed.3", `{"value": 1}`, 204, ""},
+		{"GET", "/api/v1/tags/m[0].Speed", "", 200, `{"path":"m[0].Speed","type":"INT","value":8}`},
+		{"PUT", "/api/v1/tags/flags[33]", `{"value": true}`, 204, ""},
+		{"GET", "/api/v1/tags/flags[33]", "", 200, `{"path":"flags[33]","type":"BOOL","value":true}`},
+		{"PUT", "/api/v1/tags/grid", `{"value": [[1, 2, 3], [4, 5, -6]]}`, 204, ""},
+		{"GET", "/api/v1/tags/grid[1][2]", "", 200, `{"path":"grid[1][2]","type":"SINT","value":-6}`},
+		{"GET", "/api/v1/tags/grid", "", 200, `{"path":"grid","type":"SINT","dims":[2,3],"value":[[1,2,3],[4,5,-6]]}`},
+		{"PUT", "/api/v1/tags/r", `{"value": 1.5}`, 204, ""},
+		{"GET", "/api/v1/tags/r", "", 200, `{"path":"r","type":"REAL","value":1.5}`},
+		{"PUT", "/api/v1/tags/r", `{"value": "NaN"}`, 204, ""},
+		{"GET", "/api/v1/tags/r", "", 200, `{"path":"r","type":"REAL","value":"NaN"}`},
+		{"PUT", "/api/v1/tags/r", `{"value": "-Infinity"}`, 204, ""},
+		{"GET", "/api/v1/tags/r", "", 200, `{"path":"r","type":"REAL","value":"-Infinity"}`},
+		{"PUT", "/api/v1/tags/u", `{"value": 70000}`, 400, `{"error":"invalid UINT value 70000"}`},
+		{"PUT", "/api/v1/tags/u", `{"value": "x"}`, 400, `{"error":"number expected for UINT"}`},
+		{"PUT", "/api/v1/tags/grid", `{"value": [1, 2]}`, 400, `{"error":"array of 3 elements expected"}`},
+		{"PUT", "/api/v1/tags/m[0]", `{"value": {"Nope": 1}}`, 400, `{"error":"no member Nope in MOTOR"}`},
+		{"PUT", "/api/v1/tags/u", `{}`, 400, `{"error":"body must be {\"value\": ...}"}`},
+		{"GET", "/api/v1/tags/nope", "", 404, `{"error":"no tag nope"}`},
+		{"GET", "/api/v1/tags/m[2]", "", 404, `{"error":"index out of range for m"}`},
+		{"DELETE", "/api/v1/tags/u", "", 405, `{"error":"method not allowed"}`},
+		{"POST", "/.tagSet", "u = 1,2", 200, "ok"},
+		{"GET", "/api/v1/tags/u", "", 200, `{"path":"u","type":"UINT","value":513}`},
+		{"POST", "/.tagSet", "u 1", 400, "expected path = value"},
+		{"POST", "/.tagSet", "nope = 1", 404, "no tag nope"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		p.handler(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+		if got := strings.TrimSpace(w.Body.String()); w.Code != tt.code || got != tt.want {
+			t.Errorf("%s %s: %d %s, want %d %s", tt.method, tt.path, w.Code, got, tt.code, tt.want)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	p.handler(w, httptest.NewRequest("GET", "/api/v1/tags", nil))
+	var list []apiTag
+	if err = json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 5 || list[0].Name != "flags" || list[0].Dims[0] != 64 || list[1].Type != "SINT" || list[1].Access != "rw" {
+		t.Errorf("list = %+v", list)
+	}
+}
+
+func TestSetValue(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.NewUDT("DATATYPE PUMP BOOL Run; INT Speed; END_DATATYPE")
+	p.CreateTag("PUMP", "pump")
+	p.NewTag([]int16{0, 0}, "ints")
+	p.NewTag(float32(0), "r")
+	p.NewTag(false, "b")
+	tests := []struct {
+		path, value string
+		ok          bool
+		get         string
+		want        string
+	}{
+		{"pump", `{"Run": true, "Speed": 12}`, true, "pump.Speed", "12"},
+		{"pump.Run", "false", true, "pump.Run", "false"},
+		{"ints[1]", "-3", true, "ints", "[0,-3]"},
+		{"ints", "[4, 5]", true, "ints", "[4,5]"},
+		{"ints[1].0", "false", true, "ints[1]", "4"},
+		{"r", "1.25", true, "r", "1.25"},
+		{"ints", "[1]", false, "ints", "[4,4]"},
+		{"ints[0]", "70000", false, "ints[0]", "4"},
+		{"pump.Nope", "1", false, "", ""},
+		{"nope", "1", false, "", ""},
+		{"pump.Speed", "x", false, "", ""},
+		{"[", "1", false, "", ""},
+	}
+	if err = p.SetValue("b", "true"); err != nil || p.tags["b"].data[0] != 0xFF {
+		t.Errorf("SetValue(b, true) stored %X: %v", p.tags["b"].data, err)
+	}
+	for _, tt := range tests {
+		if err := p.SetValue(tt.path, tt.value); (err == nil) != tt.ok {
+			t.Errorf("SetValue(%s, %s): %v", tt.path, tt.value, err)
+		}
+		if tt.get == "" {
+			continue
+		}
+		ref, err := p.resolve(parsePath(tt.get))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := jsonString(encodeValue(ref.t, ref.data(), ref.bit)); got != tt.want {
+			t.Errorf("SetValue(%s, %s): %s = %s, want %s", tt.path, tt.value, tt.get, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package plcconnector
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Role of HTTP user.
+type Role int
+
+// Roles, each includes permissions of the previous one.
+const (
+	RoleNone     Role = iota
+	RoleViewer        // reads tags
+	RoleOperator      // writes tags
+	RoleAdmin         // full access, ignores External Access and tag permissions
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleViewer:
+		return "viewer"
+	case RoleOperator:
+		return "operator"
+	case RoleAdmin:
+		return "admin"
+	default:
+		return "none"
+	}
+}
+
+// HTTPUser is user of HTTP basic authentication.
+type HTTPUser struct {
+	Hash string // bcrypt hash of password, see HashPassword
+	Role Role
+}
+
+// TagPermission sets minimal roles for tags matching Pattern (path.Match syntax, case insensitive).
+// Zero Read or Write means default: viewer for read, operator for write.
+type TagPermission struct {
+	Pattern string
+	Read    Role
+	Write   Role
+}
+
+// HTTPAuth configures authentication and authorization of HTTP server.
+type HTTPAuth struct {
+	Users       map[string]HTTPUser // basic authentication
+	Tokens      map[string]Role     // bearer tokens
+	ClientCAs   *x509.CertPool      // CAs of client certificates, used with TLS
+	CertRoles   map[string]Role     // roles of client certificates by subject common name
+	Anonymous   Role                // role of requests without credentials
+	Permissions []TagPermission     // first matching pattern applies
+	Audit       io.Writer           // log of tag writes
+
+	m sync.Mutex // Audit
+}
+
+// HashPassword returns bcrypt hash of password for HTTPUser.
+func HashPassword(password string) (string, error) {
+	h, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(h), err
+}
+
+// SetHTTPAuth enables authentication of HTTP server. Nil disables it. Must be called before ServeHTTP.
+func (p *PLC) SetHTTPAuth(a *HTTPAuth) {
+	p.auth = a
+}
+
+// TLSConfig returns TLS configuration requesting client certificates signed by ClientCAs.
+func (a *HTTPAuth) TLSConfig() *tls.Config {
+	c := &tls.Config{MinVersion: tls.VersionTLS12}
+	if a != nil && a.ClientCAs != nil {
+		c.ClientCAs = a.ClientCAs
+		c.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return c
+}
+
+type authKey struct{}
+
+type authInfo struct {
+	user string
+	role Role
+}
+
+// authenticate returns user and role of the request, ok is false for invalid credentials.
+func (a *HTTPAuth) authenticate(r *http.Request) (authInfo, bool) {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		if role, ok := a.CertRoles[cn]; ok {
+			return authInfo{user: "cert:" + cn, role: role}, true
+		}
+	}
+	h := r.Header.Get("Authorization")
+	if strings.HasPrefix(h, "Bearer ") {
+		tok := []byte(strings.TrimSpace(h[7:]))
+		for t, role := range a.Tokens {
+			if subtle.ConstantTimeCompare(tok, []byte(t)) == 1 {
+				return authInfo{user: "token", role: role}, true
+			}
+		}
+		return authInfo{}, false
+	}
+	if user, pass, ok := r.BasicAuth(); ok {
+		u, ok := a.Users[user]
+		if !ok || bcrypt.CompareHashAndPassword([]byte(u.Hash), []byte(pass)) != nil {
+			return authInfo{}, false
+		}
+		return authInfo{user: user, role: u.Role}, true
+	}
+	return authInfo{role: a.Anonymous}, true
+}
+
+// withAuth authenticates request and stores its role in the request context.
+func (p *PLC) withAuth(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		a := p.auth
+		if a == nil {
+			h(w, r)
+			return
+		}
+		if r.URL.Path == "/favicon.ico" {
+			h(w, r)
+			return
+		}
+		ai, ok := a.authenticate(r)
+		if !ok || ai.role == RoleNone {
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+p.Name+`"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h(w, r.WithContext(context.WithValue(r.Context(), authKey{}, ai)))
+	}
+}
+
+func (p *PLC) authOf(r *http.Request) authInfo {
+	if p.auth == nil {
+		return authInfo{role: RoleAdmin}
+	}
+	ai, _ := r.Context().Value(authKey{}).(authInfo)
+	return ai
+}
+
+// allowed reports whether request may read or write tag t. Admin bypasses only Permissions, not External Access of the tag.
+func (p *PLC) allowed(r *http.Request, t *Tag, write bool) bool {
+	if t.prot == 3 || (write && t.prot != 0) { // External Access applies to every role
+		return false
+	}
+	role := p.authOf(r).role
+	if role >= RoleAdmin {
+		return true
+	}
+	need := RoleViewer
+	if write {
+		need = RoleOperator
+	}
+	name := strings.ToLower(t.Name)
+	for _, pm := range p.auth.Permissions {
+		if ok, _ := path.Match(strings.ToLower(pm.Pattern), name); ok {
+			if write && pm.Write != RoleNone {
+				need = pm.Write
+			} else if !write && pm.Read != RoleNone {
+				need = pm.Read
+			}
+			break
+		}
+	}
+	return role >= need
+}
+
+// audit logs write of value to path.
+func (p *PLC) audit(r *http.Request, path string, value string, result string) {
+	a := p.auth
+	if a == nil || a.Audit == nil {
+		return
+	}
+	ai := p.authOf(r)
+	a.m.Lock()
+	fmt.Fprintf(a.Audit, "%s user=%q role=%s addr=%s path=%q value=%q result=%q\n", time.Now().Format(time.RFC3339Nano), ai.user, ai.role, r.RemoteAddr, path, value, result)
+	a.m.Unlock()
+}
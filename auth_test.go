@@ -0,0 +1,112 @@
+package plcconnector
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHTTPAuth(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.NewTag(int16(1), "a")
+	p.NewTag(int16(2), "ro")
+	p.NewTag(int16(3), "hidden")
+	p.NewTag(int16(4), "SetPoint")
+	p.tags["ro"].prot = 2
+	p.tags["hidden"].prot = 3
+
+	hash := func(pw string) string {
+		h, _ := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.MinCost)
+		return string(h)
+	}
+	var audit bytes.Buffer
+	p.SetHTTPAuth(&HTTPAuth{
+		Users: map[string]HTTPUser{
+			"view": {Hash: hash("v"), Role: RoleViewer},
+			"op":   {Hash: hash("o"), Role: RoleOperator},
+			"adm":  {Hash: hash("a"), Role: RoleAdmin},
+		},
+		Tokens:      map[string]Role{"secret": RoleOperator},
+		CertRoles:   map[string]Role{"hmi": RoleAdmin},
+		Permissions: []TagPermission{{Pattern: "set*", Write: RoleAdmin}},
+		Audit:       &audit,
+	})
+	h := p.withAuth(p.handler)
+
+	tests := []struct {
+		name, method, path, body string
+		user, pass, token, cert  string
+		code                     int
+	}{
+		{name: "anonymous", method: "GET", path: "/api/v1/tags/a", code: 401},
+		{name: "bad password", method: "GET", path: "/api/v1/tags/a", user: "view", pass: "x", code: 401},
+		{name: "bad token", method: "GET", path: "/api/v1/tags/a", token: "nope", code: 401},
+		{name: "favicon", method: "GET", path: "/favicon.ico", code: 404},
+		{name: "viewer read", method: "GET", path: "/api/v1/tags/a", user: "view", pass: "v", code: 200},
+		{name: "viewer write", method: "PUT", path: "/api/v1/tags/a", body: `{"value": 5}`, user: "view", pass: "v", code: 403},
+		{name: "operator write", method: "PUT", path: "/api/v1/tags/a", body: `{"value": 5}`, user: "op", pass: "o", code: 204},
+		{name: "token write", method: "PUT", path: "/api/v1/tags/a", body: `{"value": 6}`, token: "secret", code: 204},
+		{name: "tagSet", method: "POST", path: "/.tagSet", body: "a = 7,0", user: "view", pass: "v", code: 403},
+		{name: "read only", method: "PUT", path: "/api/v1/tags/ro", body: `{"value": 5}`, user: "op", pass: "o", code: 403},
+		{name: "read only read", method: "GET", path: "/api/v1/tags/ro", user: "view", pass: "v", code: 200},
+		{name: "no access", method: "GET", path: "/api/v1/tags/hidden", user: "op", pass: "o", code: 403},
+		{name: "no access page", method: "GET", path: "/hidden", user: "op", pass: "o", code: 403},
+		{name: "no access history", method: "GET", path: "/hidden?history", user: "op", pass: "o", code: 403},
+		{name: "admin respects PPD", method: "PUT", path: "/api/v1/tags/ro", body: `{"value": 5}`, user: "adm", pass: "a", code: 403},
+		{name: "pattern", method: "PUT", path: "/api/v1/tags/SetPoint", body: `{"value": 5}`, user: "op", pass: "o", code: 403},
+		{name: "client certificate", method: "PUT", path: "/api/v1/tags/SetPoint", body: `{"value": 5}`, cert: "hmi", code: 204},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		if tt.user != "" {
+			r.SetBasicAuth(tt.user, tt.pass)
+		}
+		if tt.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		if tt.cert != "" {
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: tt.cert}}}}}
+		}
+		w := httptest.NewRecorder()
+		h(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%s: status %d, want %d (%s)", tt.name, w.Code, tt.code, strings.TrimSpace(w.Body.String()))
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/api/v1/tags", nil)
+	r.SetBasicAuth("view", "v")
+	w := httptest.NewRecorder()
+	h(w, r)
+	if strings.Contains(w.Body.String(), "hidden") || !strings.Contains(w.Body.String(), `"ro"`) {
+		t.Errorf("list = %s", w.Body.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(audit.String()), "\n")
+	if len(lines) != 8 || !strings.Contains(lines[1], `user="op" role=operator`) || !strings.Contains(lines[1], `path="a" value="5" result="ok"`) ||
+		!strings.Contains(lines[3], `path="a" value="7,0" result="forbidden"`) {
+		t.Errorf("audit =\n%s", audit.String())
+	}
+
+	p.SetHTTPAuth(nil)
+	for _, tt := range []struct{ method, path, body string }{
+		{"PUT", "/api/v1/tags/ro", `{"value": 5}`},
+		{"GET", "/api/v1/tags/hidden", ""},
+	} {
+		w := httptest.NewRecorder()
+		p.withAuth(p.handler)(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("no auth %s %s: status %d, want 403", tt.method, tt.path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package plcconnector
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// pcapng block types
+const (
+	pcapSHB = 0x0A0D0D0A // Section Header Block
+	pcapIDB = 0x00000001 // Interface Description Block
+	pcapEPB = 0x00000006 // Enhanced Packet Block
+)
+
+// TCP flags
+const (
+	tcpFIN = 0x01
+	tcpSYN = 0x02
+	tcpPSH = 0x08
+	tcpACK = 0x10
+)
+
+const (
+	linkEthernet = 1
+	maxSegment   = 65000 // keeps IPv4 total length in range
+)
+
+// capture writes encapsulation frames as pcapng with synthetic Ethernet/IPv4/TCP/UDP headers.
+type capture struct {
+	m   sync.Mutex
+	w   io.Writer
+	err error
+	id  uint16 // IPv4 identification
+}
+
+func newCapture(w io.Writer) (*capture, error) {
+	var buf bytes.Buffer
+	pcapBlock(&buf, pcapSHB, []byte{0x4D, 0x3C, 0x2B, 0x1A, 1, 0, 0, 0, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF})
+	pcapBlock(&buf, pcapIDB, []byte{linkEthernet, 0, 0, 0, 0, 0, 0, 0}) // link type, reserved, snap length (no limit)
+	_, err := w.Write(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return &capture{w: w}, nil
+}
+
+func pcapBlock(buf *bytes.Buffer, typ uint32, body []byte) {
+	pad := (4 - len(body)%4) % 4
+	l := uint32(12 + len(body) + pad)
+	bwrite(buf, typ)
+	bwrite(buf, l)
+	buf.Write(body)
+	buf.Write(make([]byte, pad))
+	bwrite(buf, l)
+}
+
+// endpoint is IPv4 address and port of synthetic packet.
+type endpoint struct {
+	ip   [4]byte
+	port uint16
+}
+
+func addrEndpoint(a net.Addr) endpoint {
+	var (
+		e  endpoint
+		ip net.IP
+	)
+	switch a := a.(type) {
+	case *net.TCPAddr:
+		ip, e.port = a.IP, uint16(a.Port)
+	case *net.UDPAddr:
+		ip, e.port = a.IP, uint16(a.Port)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		copy(e.ip[:], ip4)
+	} else {
+		e.ip = [4]byte{127, 0, 0, 1}
+	}
+	return e
+}
+
+func (e endpoint) mac() []byte {
+	return []byte{0x02, 0x00, e.ip[0], e.ip[1], e.ip[2], e.ip[3]}
+}
+
+func checksum(data ...[]byte) uint16 {
+	var sum uint32
+	for _, d := range data {
+		for i := 0; i+1 < len(d); i += 2 {
+			sum += uint32(d[i])<<8 | uint32(d[i+1])
+		}
+		if len(d)%2 == 1 {
+			sum += uint32(d[len(d)-1]) << 8
+		}
+	}
+	for sum > 0xFFFF {
+		sum = sum&0xFFFF + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+// packet writes single frame with transport header th (checksum at csum offset) and payload.
+func (c *capture) packet(src, dst endpoint, proto uint8, th []byte, csum int, payload []byte) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.id++
+
+	l4 := len(th) + len(payload)
+	pseudo := []byte{src.ip[0], src.ip[1], src.ip[2], src.ip[3], dst.ip[0], dst.ip[1], dst.ip[2], dst.ip[3], 0, proto, uint8(l4 >> 8), uint8(l4)}
+	binary.BigEndian.PutUint16(th[csum:], checksum(pseudo, th, payload))
+
+	ip := make([]byte, 20)
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:], uint16(20+l4))
+	binary.BigEndian.PutUint16(ip[4:], c.id)
+	ip[6] = 0x40 // don't fragment
+	ip[8] = 64
+	ip[9] = proto
+	copy(ip[12:], src.ip[:])
+	copy(ip[16:], dst.ip[:])
+	binary.BigEndian.PutUint16(ip[10:], checksum(ip))
+
+	var frame bytes.Buffer
+	frame.Write(dst.mac())
+	frame.Write(src.mac())
+	frame.Write([]byte{0x08, 0x00})
+	frame.Write(ip)
+	frame.Write(th)
+	frame.Write(payload)
+
+	ts := uint64(time.Now().UnixNano() / 1000)
+	var body bytes.Buffer
+	bwrite(&body, uint32(0)) // interface
+	bwrite(&body, uint32(ts>>32))
+	bwrite(&body, uint32(ts))
+	bwrite(&body, uint32(frame.Len()))
+	bwrite(&body, uint32(frame.Len()))
+	body.Write(frame.Bytes())
+
+	var buf bytes.Buffer
+	pcapBlock(&buf, pcapEPB, body.Bytes())
+	_, c.err = c.w.Write(buf.Bytes())
+}
+
+func (c *capture) udp(src, dst net.Addr, payload []byte) {
+	s, d := addrEndpoint(src), addrEndpoint(dst)
+	th := make([]byte, 8)
+	binary.BigEndian.PutUint16(th[0:], s.port)
+	binary.BigEndian.PutUint16(th[2:], d.port)
+	binary.BigEndian.PutUint16(th[4:], uint16(8+len(payload)))
+	c.packet(s, d, 17, th, 6, payload)
+}
+
+// captureConn records TCP stream of the connection.
+type captureConn struct {
+	net.Conn
+	c        *capture
+	m        sync.Mutex
+	local    endpoint
+	remote   endpoint
+	seqLocal uint32
+	seqRem   uint32
+	closed   bool
+}
+
+// conn wraps connection; dialer tells whether the local side opened it.
+// Synthetic handshake is written so that Wireshark sees the whole stream.
+func (c *capture) conn(conn net.Conn, dialer bool) *captureConn {
+	cc := &captureConn{Conn: conn, c: c, local: addrEndpoint(conn.LocalAddr()), remote: addrEndpoint(conn.RemoteAddr()), seqLocal: 1000, seqRem: 5000}
+	if dialer {
+		cc.segment(true, tcpSYN, nil)
+		cc.segment(false, tcpSYN|tcpACK, nil)
+		cc.segment(true, tcpACK, nil)
+	} else {
+		cc.segment(false, tcpSYN, nil)
+		cc.segment(true, tcpSYN|tcpACK, nil)
+		cc.segment(false, tcpACK, nil)
+	}
+	return cc
+}
+
+func (cc *captureConn) segment(out bool, flags uint8, data []byte) {
+	cc.m.Lock()
+	defer cc.m.Unlock()
+	for {
+		chunk := data
+		if len(chunk) > maxSegment {
+			chunk = chunk[:maxSegment]
+		}
+		src, dst, seq, ack := cc.remote, cc.local, &cc.seqRem, cc.seqLocal
+		if out {
+			src, dst, seq, ack = cc.local, cc.remote, &cc.seqLocal, cc.seqRem
+		}
+		f := flags
+		if f&tcpSYN == 0 || f&tcpACK != 0 {
+			f |= tcpACK
+		} else {
+			ack = 0
+		}
+		if len(chunk) > 0 {
+			f |= tcpPSH
+		}
+		th := make([]byte, 20)
+		binary.BigEndian.PutUint16(th[0:], src.port)
+		binary.BigEndian.PutUint16(th[2:], dst.port)
+		binary.BigEndian.PutUint32(th[4:], *seq)
+		binary.BigEndian.PutUint32(th[8:], ack)
+		th[12] = 5 << 4
+		th[13] = f
+		binary.BigEndian.PutUint16(th[14:], 0xFFFF)
+		cc.c.packet(src, dst, 6, th, 16, chunk)
+
+		*seq += uint32(len(chunk))
+		if flags&(tcpSYN|tcpFIN) != 0 {
+			*seq++
+		}
+		data = data[len(chunk):]
+		if len(data) == 0 {
+			return
+		}
+	}
+}
+
+func (cc *captureConn) Read(b []byte) (int, error) {
+	n, err := cc.Conn.Read(b)
+	if n > 0 {
+		cc.segment(false, 0, b[:n])
+	}
+	return n, err
+}
+
+func (cc *captureConn) Write(b []byte) (int, error) {
+	n, err := cc.Conn.Write(b)
+	if n > 0 {
+		cc.segment(true, 0, b[:n])
+	}
+	return n, err
+}
+
+func (cc *captureConn) Close() error {
+	cc.m.Lock()
+	closed := cc.closed
+	cc.closed = true
+	cc.m.Unlock()
+	if !closed {
+		cc.segment(true, tcpFIN, nil)
+		cc.segment(false, tcpFIN, nil)
+	}
+	return cc.Conn.Close()
+}
+
+// CaptureTo starts writing all EtherNet/IP frames (TCP and UDP, both directions) to w in pcapng format.
+// Open connections keep writing to the writer set when they were accepted. Nil w stops capturing.
+func (p *PLC) CaptureTo(w io.Writer) error {
+	var (
+		c   *capture
+		err error
+	)
+	if w != nil {
+		c, err = newCapture(w)
+		if err != nil {
+			return err
+		}
+	}
+	p.capMut.Lock()
+	p.capture = c
+	p.capMut.Unlock()
+	return nil
+}
+
+func (p *PLC) capturer() *capture {
+	p.capMut.RLock()
+	defer p.capMut.RUnlock()
+	return p.capture
+}
+
+// CaptureTo starts writing frames of the connection to w in pcapng format.
+// Use ConnectCapture to record session registration too.
+func (c *Client) CaptureTo(w io.Writer) error {
+	cp, err := newCapture(w)
+	if err != nil {
+		return err
+	}
+	c.capture(cp)
+	return nil
+}
+
+func (c *Client) capture(cp *capture) {
+	if cc, ok := c.c.(*captureConn); ok {
+		c.c = cc.Conn
+	}
+	c.c = cp.conn(c.c, true)
+	c.rd = bufio.NewReader(c.c)
+}
+
+// CaptureFile is io.Writer for CaptureTo which rotates files after MaxSize bytes.
+// Each file starts with pcapng header, so it can be opened on its own.
+type CaptureFile struct {
+	m      sync.Mutex
+	f      *os.File
+	header []byte
+	size   int64
+
+	Name     string // current file, older ones are Name.1, Name.2, ...
+	MaxSize  int64
+	MaxFiles int // number of kept old files
+}
+
+// NewCaptureFile creates file name rotated at maxSize bytes, keeping maxFiles old files.
+func NewCaptureFile(name string, maxSize int64, maxFiles int) (*CaptureFile, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &CaptureFile{f: f, Name: name, MaxSize: maxSize, MaxFiles: maxFiles}, nil
+}
+
+func (cf *CaptureFile) Write(b []byte) (int, error) {
+	cf.m.Lock()
+	defer cf.m.Unlock()
+	if cf.f == nil {
+		return 0, os.ErrClosed
+	}
+	if len(b) >= 4 && binary.LittleEndian.Uint32(b) == pcapSHB {
+		cf.header = append([]byte(nil), b...)
+	} else if cf.MaxSize > 0 && cf.size+int64(len(b)) > cf.MaxSize && cf.size > int64(len(cf.header)) {
+		err := cf.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := cf.f.Write(b)
+	cf.size += int64(n)
+	return n, err
+}
+
+func (cf *CaptureFile) rotate() error {
+	err := cf.f.Close()
+	if err != nil {
+		return err
+	}
+	if cf.MaxFiles > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", cf.Name, cf.MaxFiles))
+		for i := cf.MaxFiles - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", cf.Name, i), fmt.Sprintf("%s.%d", cf.Name, i+1))
+		}
+		err = os.Rename(cf.Name, cf.Name+".1")
+		if err != nil {
+			return err
+		}
+	}
+	cf.f, err = os.Create(cf.Name)
+	if err != nil {
+		cf.f = nil
+		return err
+	}
+	n, err := cf.f.Write(cf.header)
+	cf.size = int64(n)
+	return err
+}
+
+// Close closes current file.
+func (cf *CaptureFile) Close() error {
+	cf.m.Lock()
+	defer cf.m.Unlock()
+	if cf.f == nil {
+		return os.ErrClosed
+	}
+	err := cf.f.Close()
+	cf.f = nil
+	return err
+}
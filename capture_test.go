@@ -0,0 +1,186 @@
+package plcconnector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type capPacket struct {
+	proto            uint8
+	srcPort, dstPort uint16
+	flags            uint8
+	payload          []byte
+}
+
+func readPcapng(t *testing.T, b []byte) []capPacket {
+	var pkts []capPacket
+	for len(b) > 0 {
+		if len(b) < 12 {
+			t.Fatalf("truncated block %x", b)
+		}
+		typ, l := binary.LittleEndian.Uint32(b), binary.LittleEndian.Uint32(b[4:])
+		if l%4 != 0 || int(l) > len(b) || binary.LittleEndian.Uint32(b[l-4:]) != l {
+			t.Fatalf("bad block length %d", l)
+		}
+		if typ == pcapEPB {
+			frame := b[28 : 28+binary.LittleEndian.Uint32(b[20:])]
+			ip := frame[14:]
+			if checksum(ip[:20]) != 0 {
+				t.Error("bad IPv4 checksum")
+			}
+			pk := capPacket{proto: ip[9], srcPort: binary.BigEndian.Uint16(ip[20:]), dstPort: binary.BigEndian.Uint16(ip[22:])}
+			l4 := ip[20:binary.BigEndian.Uint16(ip[2:])]
+			pseudo := append(append([]byte{}, ip[12:20]...), 0, ip[9], uint8(len(l4)>>8), uint8(len(l4)))
+			if checksum(pseudo, l4) != 0 {
+				t.Error("bad transport checksum")
+			}
+			if pk.proto == 6 {
+				pk.flags = l4[13]
+				pk.payload = l4[20:]
+			} else {
+				pk.payload = l4[8:]
+			}
+			pkts = append(pkts, pk)
+		}
+		b = b[l:]
+	}
+	return pkts
+}
+
+// stream joins payloads sent to port.
+func stream(pkts []capPacket, proto uint8, port uint16) []byte {
+	var b []byte
+	for _, pk := range pkts {
+		if pk.proto == proto && pk.dstPort == port {
+			b = append(b, pk.payload...)
+		}
+	}
+	return b
+}
+
+type syncBuffer struct {
+	m sync.Mutex
+	b bytes.Buffer
+}
+
+func (s *syncBuffer) Write(b []byte) (int, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.b.Write(b)
+}
+
+func (s *syncBuffer) Bytes() []byte {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return append([]byte(nil), s.b.Bytes()...)
+}
+
+func TestCapture(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.NewTag(int16(7), "a")
+	var (
+		srv syncBuffer
+		cli bytes.Buffer
+	)
+	if err = p.CaptureTo(&srv); err != nil {
+		t.Fatal(err)
+	}
+	addr := freeAddr(t)
+	go p.Serve(addr)
+	defer p.Close()
+
+	var c *Client
+	for i := 0; i < 50; i++ {
+		if c, err = ConnectCapture(addr, -1, &cli); err == nil {
+			break
+		}
+		cli.Reset()
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.ReadTag("a", 1); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	u, err := net.Dial("udp4", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer u.Close()
+	u.SetDeadline(time.Now().Add(time.Second))
+	var lid bytes.Buffer
+	bwrite(&lid, encapsulationHeader{Command: ecListIdentity})
+	u.Write(lid.Bytes())
+	resp := make([]byte, 512)
+	n, err := u.Read(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port, uport := uint16(getPort(addr)), uint16(u.LocalAddr().(*net.UDPAddr).Port)
+	cp := readPcapng(t, cli.Bytes())
+	if len(cp) < 7 || cp[0].flags != tcpSYN || cp[1].flags != tcpSYN|tcpACK {
+		t.Fatalf("client capture %+v", cp)
+	}
+	var sp []capPacket
+	for i := 0; i < 50; i++ {
+		sp = readPcapng(t, srv.Bytes())
+		if len(stream(sp, 17, uport)) > 0 && bytes.Equal(stream(sp, 6, cp[0].srcPort), stream(cp, 6, cp[0].srcPort)) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	for _, dir := range []uint16{port, cp[0].srcPort} {
+		s, c := stream(sp, 6, dir), stream(cp, 6, dir)
+		if len(s) == 0 || !bytes.Equal(s, c) {
+			t.Errorf("port %d: server %x, client %x", dir, s, c)
+		}
+	}
+	if !bytes.Equal(stream(sp, 17, port), lid.Bytes()) {
+		t.Errorf("UDP request %x", stream(sp, 17, port))
+	}
+	if got := stream(sp, 17, uport); !bytes.Equal(got, resp[:n]) {
+		t.Errorf("UDP response %x, want %x", got, resp[:n])
+	}
+}
+
+func TestCaptureFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "cap.pcapng")
+	cf, err := NewCaptureFile(name, 300, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := newCapture(cf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		c.udp(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 2222}, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 44818}, make([]byte, 40))
+	}
+	cf.Close()
+
+	for _, n := range []string{name, name + ".1", name + ".2"} {
+		b, err := os.ReadFile(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(b) > 300 || binary.LittleEndian.Uint32(b) != pcapSHB || len(readPcapng(t, b)) == 0 {
+			t.Errorf("%s: %d bytes", n, len(b))
+		}
+	}
+	if _, err = os.Stat(name + ".3"); err == nil {
+		t.Error("too many files kept")
+	}
+}
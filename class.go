@@ -3,6 +3,8 @@ package plcconnector
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"sort"
 	"sync"
 )
@@ -128,32 +130,35 @@ func NewClass(n string, attrs int) *Class {
 func (p *PLC) GetClassInstancesList(class int, instanceFrom int, maxInstances int) ([]int, []*Instance) {
 	c, cok := p.Class[class]
 	if cok {
-		if instanceFrom <= 0 {
-			instanceFrom = 1
-		}
-		c.m.RLock()
-		ret := make([]int, 0, len(c.inst))
-		i := 0
-		for in := range c.inst {
-			if in >= instanceFrom {
-				ret = append(ret, in)
-				i++
-				if maxInstances != 0 && i == maxInstances {
-					break
-				}
-			}
-		}
-		sort.Ints(ret)
-		ret2 := make([]*Instance, len(ret))
-		for a, b := range ret {
-			ret2[a] = c.inst[b]
-		}
-		c.m.RUnlock()
-		return ret, ret2
+		return c.list(instanceFrom, maxInstances)
 	}
 	return nil, nil
 }
 
+// list returns up to maxInstances (0 for all) instances starting from instanceFrom, sorted by number.
+func (c *Class) list(instanceFrom int, maxInstances int) ([]int, []*Instance) {
+	if instanceFrom <= 0 {
+		instanceFrom = 1
+	}
+	c.m.RLock()
+	ret := make([]int, 0, len(c.inst))
+	for in := range c.inst {
+		if in >= instanceFrom {
+			ret = append(ret, in)
+		}
+	}
+	sort.Ints(ret)
+	if maxInstances != 0 && len(ret) > maxInstances {
+		ret = ret[:maxInstances]
+	}
+	ret2 := make([]*Instance, len(ret))
+	for a, b := range ret {
+		ret2[a] = c.inst[b]
+	}
+	c.m.RUnlock()
+	return ret, ret2
+}
+
 // GetClassInstance .
 func (p *PLC) GetClassInstance(class int, instance int) *Instance {
 	c, cok := p.Class[class]
@@ -162,7 +167,7 @@ func (p *PLC) GetClassInstance(class int, instance int) *Instance {
 		defer c.m.RUnlock()
 		in, iok := c.inst[instance]
 		if iok {
-			p.debug(c.Name, instance)
+			p.log(LogDebug, "instance", "class", c.Name, "instance", instance)
 			return in
 		}
 	}
@@ -203,6 +208,62 @@ func (c *Class) SetInstance(no int, in *Instance) {
 	c.m.Unlock()
 }
 
+// setInstances replaces all instances of the class. Numbers up to lastInst are not reused.
+func (c *Class) setInstances(inst map[int]*Instance) {
+	c.m.Lock()
+	c.inst = map[int]*Instance{0: c.inst[0]}
+	maxInst := 0
+	maxAttr := 0
+	for no, in := range inst {
+		if no == 0 {
+			continue
+		}
+		c.inst[no] = in
+		if no > maxInst {
+			maxInst = no
+		}
+		if len(in.attr)-1 > maxAttr {
+			maxAttr = len(in.attr) - 1
+		}
+	}
+	if maxInst > c.lastInst {
+		c.lastInst = maxInst
+	}
+	c.inst[0].SetAttrUINT(2, uint16(maxInst))       // MaxInstance
+	c.inst[0].SetAttrUINT(3, uint16(len(c.inst)-1)) // NumInstances
+	if maxAttr > 0 {
+		c.inst[0].SetAttrUINT(7, uint16(maxAttr)) // MaxInstAttr
+	}
+	c.m.Unlock()
+}
+
+// removeInstance removes instance no. Numbers of the other instances are unchanged and lastInst is not reused.
+func (c *Class) removeInstance(no int) {
+	c.m.Lock()
+	delete(c.inst, no)
+	maxInst := 0
+	for n := range c.inst {
+		if n > maxInst {
+			maxInst = n
+		}
+	}
+	c.inst[0].SetAttrUINT(2, uint16(maxInst))       // MaxInstance
+	c.inst[0].SetAttrUINT(3, uint16(len(c.inst)-1)) // NumInstances
+	c.m.Unlock()
+}
+
+// instanceNo returns number of instance in, or 0 if it is not in the class.
+func (c *Class) instanceNo(in *Instance) int {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	for no, x := range c.inst {
+		if x == in && no != 0 {
+			return no
+		}
+	}
+	return 0
+}
+
 func defaultIdentityClass() *Class {
 	c := NewClass("Identity", 0)
 	c.inst[0].getall = []int{1, 2, 6, 7}
@@ -233,3 +294,37 @@ func defaultIdentityClass() *Class {
 
 	return c
 }
+
+// SetIdentity changes attributes of Identity Object, also reported by ListIdentity.
+// Zero fields are left unchanged, Addr, Status and State are ignored. Revision is "major.minor".
+func (p *PLC) SetIdentity(id Identity) error {
+	var rev uint16
+	if id.Revision != "" {
+		var maj, min uint8
+		if _, err := fmt.Sscanf(id.Revision, "%d.%d", &maj, &min); err != nil {
+			return errors.New("invalid revision " + id.Revision)
+		}
+		rev = uint16(maj) | uint16(min)<<8
+	}
+	if len(id.Name) > 32 {
+		return errors.New("product name longer than 32 characters")
+	}
+	in := p.Class[IdentityClass].inst[1]
+	for _, a := range []struct {
+		no int
+		v  int
+	}{{1, id.VendorID}, {2, id.DeviceType}, {3, id.ProductCode}, {4, int(rev)}} {
+		if a.v != 0 {
+			in.SetAttrUINT(a.no, uint16(a.v))
+		}
+	}
+	if id.SerialNumber != 0 {
+		in.SetAttrUDINT(6, uint32(id.SerialNumber))
+	}
+	if id.Name != "" {
+		p.Name = id.Name
+		in.SetAttr(7, TagShortString(id.Name, "ProductName"))
+		in.SetAttr(13, TagStringI(id.Name, "InternationalProductName"))
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package plcconnector
+
+import "testing"
+
+func TestSetIdentity(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := p.Class[IdentityClass].inst[1]
+	product := uint16(in.attr[3].DataINT()[0])
+	if err = p.SetIdentity(Identity{VendorID: 7, DeviceType: 14, Revision: "3.12", SerialNumber: 0xC0FFEE, Name: "Line 1"}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		attr int
+		want uint32
+	}{
+		{1, 7},
+		{2, 14},
+		{3, uint32(product)}, // zero keeps value
+		{4, 3 | 12<<8},
+		{6, 0xC0FFEE},
+	}
+	for _, tt := range tests {
+		var got uint32
+		if tt.attr == 6 {
+			got = uint32(in.attr[6].DataDINT()[0])
+		} else {
+			got = uint32(uint16(in.attr[tt.attr].DataINT()[0]))
+		}
+		if got != tt.want {
+			t.Errorf("attribute %d = %d, want %d", tt.attr, got, tt.want)
+		}
+	}
+	if p.Name != "Line 1" || in.attr[7].DataString() != "Line 1" {
+		t.Errorf("name %q, attribute 7 %q", p.Name, in.attr[7].DataString())
+	}
+
+	for _, id := range []Identity{
+		{Revision: "3"},
+		{Revision: "x.y"},
+		{Name: "name longer than thirty-two characters"},
+	} {
+		if p.SetIdentity(id) == nil {
+			t.Errorf("SetIdentity(%+v) accepted", id)
+		}
+	}
+}
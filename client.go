@@ -6,8 +6,10 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -17,17 +19,18 @@ type Client struct {
 	rd      *bufio.Reader
 	wr      *bytes.Buffer
 	wrData  *bytes.Buffer
-	bp      int
+	route   []uint8 // route path of Unconnected Send, nil sends requests directly
 	handle  uint32
 	context uint64
 
+	Logger  Logger // receives log messages, nil is silent
 	Timeout uint16
 }
 
 func (c *Client) read(data interface{}) error {
 	err := binary.Read(c.rd, binary.LittleEndian, data)
 	if err != nil {
-		fmt.Println(err)
+		c.log(LogError, "client", "err", err)
 	}
 	return err
 }
@@ -35,19 +38,32 @@ func (c *Client) read(data interface{}) error {
 func (c *Client) write(data interface{}) {
 	err := binary.Write(c.wr, binary.LittleEndian, data)
 	if err != nil {
-		fmt.Println(err)
+		c.log(LogError, "client", "err", err)
 	}
 }
 
 func (c *Client) writeData(data interface{}) {
 	err := binary.Write(c.wrData, binary.LittleEndian, data)
 	if err != nil {
-		fmt.Println(err)
+		c.log(LogError, "client", "err", err)
 	}
 }
 
 // Connect .
 func Connect(host string, backplane int) (*Client, error) {
+	return connect(host, backplane, nil)
+}
+
+// ConnectCapture connects like Connect and writes all frames of the connection to w in pcapng format.
+func ConnectCapture(host string, backplane int, w io.Writer) (*Client, error) {
+	cp, err := newCapture(w)
+	if err != nil {
+		return nil, err
+	}
+	return connect(host, backplane, cp)
+}
+
+func connect(host string, backplane int, cp *capture) (*Client, error) {
 	var (
 		c   Client
 		h   encapsulationHeader
@@ -61,8 +77,13 @@ func Connect(host string, backplane int) (*Client, error) {
 	if err != nil {
 		return nil, err
 	}
+	if cp != nil {
+		conn = cp.conn(conn, true)
+	}
 	c.c = conn
-	c.bp = backplane
+	if backplane != -1 {
+		c.route = []uint8{1, uint8(backplane)}
+	}
 	c.wr = new(bytes.Buffer)
 	c.wrData = new(bytes.Buffer)
 	c.Timeout = 20
@@ -185,7 +206,6 @@ func Discover() ([]Identity, error) {
 			return nil, err
 		}
 		if ln >= 62 {
-			var id Identity
 			rd := bytes.NewReader(buffer)
 			var (
 				head  encapsulationHeader
@@ -199,16 +219,12 @@ func Discover() ([]Identity, error) {
 			bread(rd, &data)
 			attrs := make([]byte, int(typ.Length)-binary.Size(data))
 			bread(rd, &attrs)
+			id, err := decodeIdentity(attrs)
+			if err != nil {
+				continue
+			}
 			id.Addr = net.JoinHostPort(net.IPv4(byte(data.SocketAddr), byte(data.SocketAddr>>8), byte(data.SocketAddr>>16), byte(data.SocketAddr>>24)).String(),
 				strconv.Itoa(int(htons(data.SocketPort))))
-			id.VendorID = int(attrs[0]) + int(attrs[1])<<8
-			id.DeviceType = int(attrs[2]) + int(attrs[3])<<8
-			id.ProductCode = int(attrs[4]) + int(attrs[5])<<8
-			id.Revision = fmt.Sprintf("%d.%d", attrs[6], attrs[7])
-			id.Status = int(attrs[8]) + int(attrs[9])<<8
-			id.SerialNumber = uint(attrs[10]) + uint(attrs[11])<<8 + uint(attrs[12])<<16 + uint(attrs[13])<<24
-			id.Name = string(attrs[15 : 15+attrs[14]])
-			id.State = int(attrs[len(attrs)-1])
 			ids = append(ids, id)
 		}
 	}
@@ -258,50 +274,305 @@ func (c *Client) GetAttributeSingle(class, instance, attr int) ([]byte, error) {
 	return c.sendRecv(path, GetAttr)
 }
 
-// ReadTag .
+// ReadTag reads count elements of tag. Type of structures is TypeStructHead|structure handle.
 func (c *Client) ReadTag(tag string, count int) (*Tag, error) {
 	path := constructPath(parsePath(tag))
 	if path == nil {
 		return nil, errors.New("path parse error")
 	}
 
-	defer c.reset()
-	c.writeHead(path, ReadTag, 2)
-	c.write(uint16(count))
-
-	_, err := c.c.Write(c.wr.Bytes())
+	c.writeData(uint16(count))
+	status, d, err := c.request(path, ReadTag)
 	if err != nil {
 		return nil, err
 	}
-
-	_, ln, err := c.readHead()
+	t, d, err := tagType(d)
 	if err != nil {
 		return nil, err
 	}
+	for status == PartialTransfer {
+		c.writeData(uint16(count))
+		c.writeData(uint32(len(d)))
+		var frag []uint8
+		status, frag, err = c.request(path, ReadTagFrag)
+		if err != nil {
+			return nil, err
+		}
+		_, frag, err = tagType(frag)
+		if err != nil {
+			return nil, err
+		}
+		if len(frag) == 0 {
+			return nil, errors.New("empty fragment")
+		}
+		d = append(d, frag...)
+	}
+
+	return &Tag{Name: tag, Type: t, data: d}, nil
+}
+
+// tagType splits response of Read Tag into type and data.
+func tagType(d []uint8) (int, []uint8, error) {
+	if len(d) < 2 {
+		return 0, nil, errors.New("response too short")
+	}
+	t := int(binary.LittleEndian.Uint16(d))
+	if t != TypeStructHead>>16 {
+		return t, d[2:], nil
+	}
+	if len(d) < 4 {
+		return 0, nil, errors.New("response too short")
+	}
+	return TypeStructHead | int(binary.LittleEndian.Uint16(d[2:])), d[4:], nil
+}
+
+// WriteTag writes count elements of tag. Type is the one returned by ReadTag.
+func (c *Client) WriteTag(tag string, typ int, count int, data []uint8) error {
+	path := constructPath(parsePath(tag))
+	if path == nil {
+		return errors.New("path parse error")
+	}
+
+	if typ >= TypeStructHead {
+		c.writeData(uint16(TypeStructHead >> 16))
+	}
+	c.writeData(uint16(typ))
+	c.writeData(uint16(count))
+	c.writeData(data)
+	_, err := c.sendRecv(path, WriteTag)
+	return err
+}
+
+// SetRoute sets route path of requests as comma separated port and link address pairs,
+// e.g. "1,0" for slot 0 of backplane or "1,2,2,192.168.1.10,1,0" through Ethernet module in slot 2.
+// Empty route sends requests directly to the target.
+func (c *Client) SetRoute(route string) error {
+	r, err := parseRoute(route)
+	if err != nil {
+		return err
+	}
+	c.route = r
+	return nil
+}
+
+func parseRoute(route string) ([]uint8, error) {
+	if strings.TrimSpace(route) == "" {
+		return nil, nil
+	}
+	f := strings.Split(route, ",")
+	if len(f)%2 != 0 {
+		return nil, errors.New("route needs port and link address pairs")
+	}
+	var r []uint8
+	for i := 0; i < len(f); i += 2 {
+		port, err := strconv.Atoi(strings.TrimSpace(f[i]))
+		if err != nil || port < 1 || port > 14 {
+			return nil, errors.New("invalid port " + f[i])
+		}
+		link := strings.TrimSpace(f[i+1])
+		if n, err := strconv.Atoi(link); err == nil && n >= 0 && n <= 255 {
+			r = append(r, uint8(port), uint8(n))
+			continue
+		}
+		if net.ParseIP(link) == nil {
+			return nil, errors.New("invalid link address " + link)
+		}
+		r = append(r, 0x10|uint8(port), uint8(len(link))) // extended link address
+		r = append(r, link...)
+		if len(link)&1 == 1 {
+			r = append(r, 0)
+		}
+	}
+	return r, nil
+}
 
-	var t uint16
-	err = c.read(&t)
+// Identity reads Identity Object instance 1 of the target.
+func (c *Client) Identity() (*Identity, error) {
+	d, err := c.GetAttributesAll(IdentityClass, 1)
 	if err != nil {
 		return nil, err
 	}
-	typlen := 2
-	if t == TypeStructHead>>16 {
-		err = c.read(&t)
+	id, err := decodeIdentity(d)
+	if err != nil {
+		return nil, err
+	}
+	id.Addr = c.c.RemoteAddr().String()
+	return &id, nil
+}
+
+// decodeIdentity decodes attributes 1-7 of Identity Object followed by state.
+func decodeIdentity(attrs []uint8) (Identity, error) {
+	var id Identity
+	if len(attrs) < 15 || len(attrs) < 15+int(attrs[14]) {
+		return id, errors.New("identity too short")
+	}
+	id.VendorID = int(attrs[0]) + int(attrs[1])<<8
+	id.DeviceType = int(attrs[2]) + int(attrs[3])<<8
+	id.ProductCode = int(attrs[4]) + int(attrs[5])<<8
+	id.Revision = fmt.Sprintf("%d.%d", attrs[6], attrs[7])
+	id.Status = int(attrs[8]) + int(attrs[9])<<8
+	id.SerialNumber = uint(attrs[10]) + uint(attrs[11])<<8 + uint(attrs[12])<<16 + uint(attrs[13])<<24
+	id.Name = string(attrs[15 : 15+attrs[14]])
+	if len(attrs) > 15+int(attrs[14]) {
+		id.State = int(attrs[15+attrs[14]])
+	}
+	return id, nil
+}
+
+// SymbolInfo is tag of the target listed by ListTags.
+type SymbolInfo struct {
+	Instance int
+	Name     string
+	Type     int // symbol type, TypeStruct|template instance for structures
+	Dim      [3]int
+}
+
+// ListTags reads all instances of Symbol Object. Programs are listed as Program:Name with type TypeProgram.
+func (c *Client) ListTags() ([]SymbolInfo, error) {
+	return c.listSymbols(nil)
+}
+
+// ListProgramTags reads Symbol Object instances of program. Names are without Program:Name prefix.
+func (c *Client) ListProgramTags(program string) ([]SymbolInfo, error) {
+	return c.listSymbols(constructPath([]pathEl{{typ: ansiExtended, txt: "Program:" + program}}))
+}
+
+func (c *Client) listSymbols(scope []uint8) ([]SymbolInfo, error) {
+	var syms []SymbolInfo
+	inst := 0
+	for {
+		c.writeData([]uint16{3, 1, 2, 8}) // name, type, dimensions
+		path := append(append([]uint8{}, scope...), pathCIA(SymbolClass, inst, -1, -1)...)
+		status, d, err := c.request(path, GetInstAttrList)
 		if err != nil {
 			return nil, err
 		}
-		typlen = 4
+		rd := bytes.NewReader(d)
+		for rd.Len() > 0 {
+			var (
+				id   uint32
+				ln   uint16
+				typ  uint16
+				dims [3]uint32
+			)
+			err = bread(rd, &id)
+			if err == nil {
+				err = bread(rd, &ln)
+			}
+			name := make([]uint8, ln)
+			if err == nil {
+				err = bread(rd, name)
+			}
+			if err == nil {
+				err = bread(rd, &typ)
+			}
+			if err == nil {
+				err = bread(rd, &dims)
+			}
+			if err != nil {
+				return nil, errors.New("symbol list too short")
+			}
+			syms = append(syms, SymbolInfo{Instance: int(id), Name: string(name), Type: int(typ), Dim: [3]int{int(dims[0]), int(dims[1]), int(dims[2])}})
+			inst = int(id) + 1
+		}
+		if status != PartialTransfer {
+			return syms, nil
+		}
 	}
-	d := make([]uint8, ln-typlen)
-	err = c.read(&d)
+}
+
+// Template is structure definition read from Template Object.
+type Template struct {
+	Instance int
+	Name     string
+	Handle   uint16 // structure handle used by Read Tag and Write Tag
+	Size     int    // structure size in bytes
+	Members  []TemplateMember
+}
+
+// TemplateMember is member of structure.
+type TemplateMember struct {
+	Name   string
+	Type   int // TypeStruct|template instance for structures
+	Info   int // array size, bit number for BOOL
+	Offset int
+}
+
+// ReadTemplate reads template of structure.
+func (c *Client) ReadTemplate(instance int) (*Template, error) {
+	d, err := c.GetAttributeList(TemplateClass, instance, []int{1, 2, 4, 5})
 	if err != nil {
 		return nil, err
 	}
+	var (
+		count uint16
+		attr  struct {
+			ID, Status uint16
+		}
+		tp      = Template{Instance: instance}
+		members uint16
+		defSize uint32
+		size    uint32
+	)
+	rd := bytes.NewReader(d)
+	err = bread(rd, &count)
+	for i := 0; i < int(count) && err == nil; i++ {
+		err = bread(rd, &attr)
+		if err != nil || attr.Status != Success {
+			break
+		}
+		switch attr.ID {
+		case 1:
+			err = bread(rd, &tp.Handle)
+		case 2:
+			err = bread(rd, &members)
+		case 4:
+			err = bread(rd, &defSize)
+		case 5:
+			err = bread(rd, &size)
+		}
+	}
+	if err != nil || attr.Status != Success || defSize*4 < 23 {
+		return nil, errors.New("invalid template attributes")
+	}
+	tp.Size = int(size)
 
-	// fmt.Println(typeToString(int(t)))
-	// fmt.Println(d)
+	var def []uint8
+	for {
+		rem := int(defSize)*4 - 23 - len(def) // definition size in bytes as Logix computes it
+		if rem < 0 {
+			rem = 0
+		}
+		c.writeData(uint32(len(def)))
+		c.writeData(uint16(rem))
+		status, d, err := c.request(pathCIA(TemplateClass, instance, -1, -1), ReadTemplate)
+		if err != nil {
+			return nil, err
+		}
+		def = append(def, d...)
+		if status != PartialTransfer || len(d) == 0 {
+			break
+		}
+	}
 
-	return &Tag{Name: tag, Type: int(t), data: d}, nil
+	if len(def) < int(members)*8 {
+		return nil, errors.New("template too short")
+	}
+	names := strings.Split(string(def[int(members)*8:]), "\x00")
+	if len(names) < int(members)+1 {
+		return nil, errors.New("template names missing")
+	}
+	tp.Name = strings.SplitN(names[0], ";", 2)[0]
+	for i := 0; i < int(members); i++ {
+		m := def[i*8:]
+		tp.Members = append(tp.Members, TemplateMember{
+			Name:   names[i+1],
+			Info:   int(binary.LittleEndian.Uint16(m)),
+			Type:   int(binary.LittleEndian.Uint16(m[2:])),
+			Offset: int(binary.LittleEndian.Uint32(m[4:])),
+		})
+	}
+	return &tp, nil
 }
 
 func (c *Client) reset() {
@@ -348,7 +619,7 @@ func (c *Client) readHead() (int, int, error) {
 		return 0, 0, err
 	}
 	if r.Status != Success { // TODO additional status size
-		return int(r.Status), int(i.Length) - 4, errors.New("status not Success")
+		return int(r.Status), int(i.Length) - 4, fmt.Errorf("status 0x%02X", r.Status)
 	}
 	return int(r.Status), int(i.Length) - 4, nil
 }
@@ -380,7 +651,7 @@ func (c *Client) writeHeadCM(path []uint8, service uint8, length int) {
 	c.c.SetDeadline(time.Now().Add(time.Second * time.Duration(c.Timeout)))
 
 	msrLen := 2 + len(path) + length
-	dataLen := msrLen + 14
+	dataLen := 10 + msrLen + msrLen&1 + 2 + len(c.route)
 	encLen := dataLen + 16
 
 	c.context++
@@ -406,32 +677,44 @@ func (c *Client) writeHeadCM(path []uint8, service uint8, length int) {
 }
 
 func (c *Client) sendRecv(path []uint8, service uint8) ([]uint8, error) {
+	_, d, err := c.request(path, service)
+	return d, err
+}
+
+// request sends request with data from c.wrData and returns general status and response data.
+// Status other than Success and PartialTransfer is returned as error.
+func (c *Client) request(path []uint8, service uint8) (int, []uint8, error) {
 	defer c.reset()
 
-	if c.bp == -1 {
+	if c.route == nil {
 		c.writeHead(path, service, c.wrData.Len())
 	} else {
 		c.writeHeadCM(path, service, c.wrData.Len())
 	}
 	c.write(c.wrData.Bytes())
-	if c.bp != -1 {
-		c.write([]byte{1, 0, 1, byte(c.bp)})
+	if c.route != nil {
+		if c.wrData.Len()&1 == 1 {
+			c.write(uint8(0)) // pad
+		}
+		c.write([]uint8{uint8(len(c.route) / 2), 0})
+		c.write(c.route)
 	}
 	_, err := c.c.Write(c.wr.Bytes())
 	if err != nil {
-		return nil, err
+		return 0, nil, err
 	}
 
-	_, ln, err := c.readHead()
-	if err != nil {
-		return nil, err
+	status, ln, err := c.readHead()
+	if err != nil && status == Success {
+		return status, nil, err
 	}
 
-	d := make([]byte, ln)
-	err = c.read(&d)
-	if err != nil {
-		return nil, err
+	d := make([]byte, ln) // also additional status of error, not to lose sync
+	if rerr := c.read(&d); rerr != nil {
+		return status, nil, rerr
 	}
-
-	return d, nil
+	if err != nil && status != PartialTransfer {
+		return status, d, err
+	}
+	return status, d, nil
 }
@@ -0,0 +1,174 @@
+package plcconnector
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseRoute(t *testing.T) {
+	tests := []struct {
+		route string
+		want  []uint8
+		err   bool
+	}{
+		{"", nil, false},
+		{"1,0", []uint8{1, 0}, false},
+		{" 1, 3 ,2,10", []uint8{1, 3, 2, 10}, false},
+		{"1,2,2,10.0.0.1", []uint8{1, 2, 0x12, 8, '1', '0', '.', '0', '.', '0', '.', '1'}, false},
+		{"2,10.0.0.10", []uint8{0x12, 9, '1', '0', '.', '0', '.', '0', '.', '1', '0', 0}, false},
+		{"1", nil, true},
+		{"0,1", nil, true},
+		{"1,host", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseRoute(tt.route)
+		if (err != nil) != tt.err || !bytes.Equal(got, tt.want) {
+			t.Errorf("%q: % X, %v", tt.route, got, err)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.NewUDT("DATATYPE MOTOR BOOL Run; DINT Speed; END_DATATYPE"); err != nil {
+		t.Fatal(err)
+	}
+	if err = p.CreateTag("MOTOR", "m"); err != nil {
+		t.Fatal(err)
+	}
+	p.NewTag(int16(7), "a")
+	p.NewTag(make([]int32, 300), "big")
+	if err = p.SetValue("m", `{"Speed": 7}`); err != nil {
+		t.Fatal(err)
+	}
+	if p.SetValue("m.Nope", "1") == nil || p.SetValue("a", "true") == nil {
+		t.Error("invalid value set")
+	}
+	if err = p.SetIdentity(Identity{VendorID: 7, Revision: "3.12", Name: "Test", SerialNumber: 0xC0FFEE}); err != nil {
+		t.Fatal(err)
+	}
+	addr := freeAddr(t)
+	go p.Serve(addr)
+	defer p.Close()
+
+	var c *Client
+	for i := 0; i < 50; i++ {
+		if c, err = Connect(addr, -1); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for _, route := range []string{"", "1,0", "1,2,2,10.0.0.1"} {
+		if err = c.SetRoute(route); err != nil {
+			t.Fatal(err)
+		}
+		if err = c.WriteTag("a", TypeINT, 1, []uint8{9, 0}); err != nil {
+			t.Fatalf("%q: write %v", route, err)
+		}
+		tg, err := c.ReadTag("a", 1)
+		if err != nil || tg.Type != TypeINT || tg.DataINT()[0] != 9 {
+			t.Fatalf("%q: read %+v %v", route, tg, err)
+		}
+	}
+
+	tg, err := c.ReadTag("big", 300)
+	if err != nil || len(tg.DataBytes()) != 1200 {
+		t.Fatalf("big %v", err)
+	}
+	if _, err = c.ReadTag("nope", 1); err == nil {
+		t.Error("unknown tag read")
+	}
+
+	syms, err := c.ListTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := map[string]SymbolInfo{}
+	for _, s := range syms {
+		found[s.Name] = s
+	}
+	if found["a"].Type != TypeINT || found["big"].Dim[0] != 300 || found["big"].Type != TypeDINT|TypeArray1D || found["m"].Type&TypeStruct == 0 {
+		t.Fatalf("symbols %+v", syms)
+	}
+
+	tp, err := c.ReadTemplate(found["m"].Type & TypeType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	speed := tp.Members[len(tp.Members)-1]
+	if tp.Name != "MOTOR" || speed.Name != "Speed" || speed.Type != TypeDINT {
+		t.Fatalf("template %+v", tp)
+	}
+	if tg, err = c.ReadTag("m.Speed", 1); err != nil || tg.DataDINT()[0] != 7 {
+		t.Fatalf("SetValue %+v %v", tg, err)
+	}
+	tg, err = c.ReadTag("m", 1)
+	if err != nil || tg.Type != TypeStructHead|int(tp.Handle) || len(tg.DataBytes()) != tp.Size {
+		t.Fatalf("struct %+v %v", tg, err)
+	}
+	data := append([]uint8{}, tg.DataBytes()...)
+	data[speed.Offset] = 42
+	if err = c.WriteTag("m", tg.Type, 1, data); err != nil {
+		t.Fatal(err)
+	}
+	if tg, err = c.ReadTag("m.Speed", 1); err != nil || tg.DataDINT()[0] != 42 {
+		t.Fatalf("member %+v %v", tg, err)
+	}
+
+	id, err := c.Identity()
+	if err != nil || id.Name != "Test" || id.VendorID != 7 || id.ProductCode != 1 || id.Revision != "3.12" || id.SerialNumber != 0xC0FFEE {
+		t.Errorf("identity %+v %v", id, err)
+	}
+}
+
+func TestClientErrorStatusSync(t *testing.T) {
+	cc, sc := net.Pipe()
+	defer cc.Close()
+	defer sc.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	cc.SetDeadline(deadline)
+	sc.SetDeadline(deadline)
+	c := &Client{c: cc, rd: bufio.NewReader(cc), wr: new(bytes.Buffer), wrData: new(bytes.Buffer), Timeout: 2}
+
+	// reply writes response in two parts, split after general status, as TCP may deliver it.
+	reply := func(status uint8, ext uint8, rest []uint8) {
+		var h encapsulationHeader
+		if binary.Read(sc, binary.LittleEndian, &h) != nil {
+			return
+		}
+		io.CopyN(io.Discard, sc, int64(h.Length))
+		var b bytes.Buffer
+		bwrite(&b, encapsulationHeader{Command: ecSendRRData, Length: uint16(16 + 4 + len(rest))})
+		bwrite(&b, sendData{ItemCount: 2})
+		bwrite(&b, itemType{Type: itNullAddress})
+		bwrite(&b, itemType{Type: itUnconnData, Length: uint16(4 + len(rest))})
+		bwrite(&b, response{Service: ReadTag + 128, Status: status, AddStatusSize: ext})
+		sc.Write(b.Bytes())
+		sc.Write(rest)
+	}
+	go func() {
+		reply(PrivilegeViol, 2, []uint8{0x34, 0x12, 0x78, 0x56})
+		reply(Success, 0, []uint8{0xC3, 0, 7, 0})
+	}()
+
+	if _, err := c.ReadTag("b", 1); err == nil {
+		t.Error("ReadTag(b) succeeded")
+	}
+	tg, err := c.ReadTag("a", 1)
+	if err != nil || tg.DataBytes()[0] != 7 {
+		t.Fatalf("ReadTag(a) after error = %v, %v", tg, err)
+	}
+}
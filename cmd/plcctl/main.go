@@ -0,0 +1,526 @@
+// Command plcctl is command-line client of EtherNet/IP targets, see plcctl -h for commands.
+package main
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	plc "github.com/podeszfa/plcconnector"
+)
+
+var (
+	host     = flag.String("host", "127.0.0.1", "target address, port 44818 if not given")
+	route    = flag.String("route", "", "route path as port,link pairs, e.g. 1,0 for backplane slot 0")
+	slot     = flag.Int("slot", -1, "backplane slot, shortcut for -route 1,<slot>")
+	format   = flag.String("format", "table", "output format: table, json or csv")
+	count    = flag.Int("count", 1, "number of elements to read")
+	interval = flag.Duration("interval", time.Second, "poll interval of watch")
+	timeout  = flag.Uint("timeout", 20, "request timeout in seconds")
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `usage: plcctl [flags] command [arguments]
+
+commands:
+  discover                        list targets answering ListIdentity broadcast
+  identity                        show identity of the target
+  list-tags                       list tags of the target
+  read <tag>                      read tag, -count elements
+  write <tag> <value>[,value]     write tag, one value per element, structures as hex
+  get-attr <class> <inst> <attr>  read attribute, numbers may be hex with 0x prefix
+  templates                       list structure templates used by tags
+  watch <tag>...                  poll tags every -interval and print changes
+
+flags:
+`)
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	if *format != "table" && *format != "json" && *format != "csv" {
+		fmt.Fprintln(os.Stderr, "plcctl: unknown format", *format)
+		os.Exit(2)
+	}
+	if err := run(flag.Arg(0), flag.Args()[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "plcctl:", err)
+		if err == errUsage {
+			usage()
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+var errUsage = errors.New("wrong number of arguments")
+
+func run(cmd string, args []string) error {
+	nargs := map[string]int{"discover": 0, "identity": 0, "list-tags": 0, "read": 1, "write": 2, "get-attr": 3, "templates": 0, "watch": -1}
+	n, ok := nargs[cmd]
+	if !ok {
+		return errors.New("unknown command " + cmd)
+	}
+	if n >= 0 && len(args) != n || n < 0 && len(args) == 0 {
+		return errUsage
+	}
+	if cmd == "discover" {
+		return discover()
+	}
+
+	c, err := connect()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	switch cmd {
+	case "identity":
+		return identity(c)
+	case "list-tags":
+		return listTags(c)
+	case "read":
+		return read(c, args[0])
+	case "write":
+		return write(c, args[0], args[1])
+	case "get-attr":
+		return getAttr(c, args)
+	case "templates":
+		return templates(c)
+	default:
+		return watch(c, args)
+	}
+}
+
+func connect() (*plc.Client, error) {
+	addr := *host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "44818")
+	}
+	c, err := plc.Connect(addr, -1)
+	if err != nil {
+		return nil, err
+	}
+	c.Timeout = uint16(*timeout)
+	r := *route
+	if *slot >= 0 {
+		if r != "" {
+			r += ","
+		}
+		r += "1," + strconv.Itoa(*slot)
+	}
+	if err = c.SetRoute(r); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// printer writes rows as aligned table, JSON or CSV. Streamed output is written row by row.
+type printer struct {
+	w      io.Writer
+	head   []string
+	rows   [][]string
+	stream bool
+	tw     *tabwriter.Writer
+	csv    *csv.Writer
+}
+
+func newPrinter(stream bool, head ...string) *printer {
+	pr := &printer{w: os.Stdout, head: head, stream: stream}
+	switch *format {
+	case "csv":
+		pr.csv = csv.NewWriter(pr.w)
+		pr.csv.Write(head)
+	case "table":
+		minWidth := 0
+		if stream {
+			minWidth = 14 // columns are aligned only within one flush
+		}
+		pr.tw = tabwriter.NewWriter(pr.w, minWidth, 8, 2, ' ', 0)
+		fmt.Fprintln(pr.tw, strings.ToUpper(strings.Join(head, "\t")))
+	}
+	return pr
+}
+
+func (pr *printer) row(v ...string) {
+	pr.rows = append(pr.rows, v)
+	if pr.stream {
+		pr.flush()
+	}
+}
+
+func (pr *printer) object(v []string) map[string]string {
+	m := make(map[string]string, len(v))
+	for i, h := range pr.head {
+		m[h] = v[i]
+	}
+	return m
+}
+
+func (pr *printer) flush() {
+	switch {
+	case pr.csv != nil:
+		pr.csv.WriteAll(pr.rows)
+	case pr.tw != nil:
+		for _, r := range pr.rows {
+			fmt.Fprintln(pr.tw, strings.Join(r, "\t"))
+		}
+		pr.tw.Flush()
+	case pr.stream:
+		enc := json.NewEncoder(pr.w)
+		for _, r := range pr.rows {
+			enc.Encode(pr.object(r))
+		}
+	default:
+		objs := make([]map[string]string, 0, len(pr.rows))
+		for _, r := range pr.rows {
+			objs = append(objs, pr.object(r))
+		}
+		enc := json.NewEncoder(pr.w)
+		enc.SetIndent("", "  ")
+		enc.Encode(objs)
+	}
+	pr.rows = pr.rows[:0]
+}
+
+var identityHead = []string{"addr", "name", "vendor", "device", "product", "revision", "serial", "status", "state"}
+
+func identityRow(id plc.Identity) []string {
+	return []string{id.Addr, id.Name, strconv.Itoa(id.VendorID), strconv.Itoa(id.DeviceType), strconv.Itoa(id.ProductCode), id.Revision,
+		fmt.Sprintf("%08X", id.SerialNumber), fmt.Sprintf("0x%04X", id.Status), strconv.Itoa(id.State)}
+}
+
+func discover() error {
+	ids, err := plc.Discover()
+	if err != nil {
+		return err
+	}
+	pr := newPrinter(false, identityHead...)
+	for _, id := range ids {
+		pr.row(identityRow(id)...)
+	}
+	pr.flush()
+	return nil
+}
+
+func identity(c *plc.Client) error {
+	id, err := c.Identity()
+	if err != nil {
+		return err
+	}
+	pr := newPrinter(false, identityHead...)
+	pr.row(identityRow(*id)...)
+	pr.flush()
+	return nil
+}
+
+// templateNames reads names of templates on demand.
+type templateNames struct {
+	c     *plc.Client
+	names map[int]string
+}
+
+func (tn *templateNames) typeName(typ int) string {
+	if typ&plc.TypeStruct == 0 {
+		return plc.Tag{Type: typ & plc.TypeType}.TypeString()
+	}
+	inst := typ & plc.TypeType
+	n, ok := tn.names[inst]
+	if !ok {
+		n = "STRUCT"
+		if tp, err := tn.c.ReadTemplate(inst); err == nil {
+			n = tp.Name
+		}
+		tn.names[inst] = n
+	}
+	return n
+}
+
+func listTags(c *plc.Client) error {
+	syms, err := c.ListTags()
+	if err != nil {
+		return err
+	}
+	tn := templateNames{c, make(map[int]string)}
+	pr := newPrinter(false, "instance", "name", "type", "dims")
+	for _, s := range syms {
+		pr.row(strconv.Itoa(s.Instance), s.Name, tn.typeName(s.Type), plc.Tag{Dim: s.Dim}.DimString())
+	}
+	pr.flush()
+	return nil
+}
+
+// element returns name of i-th of count elements read from tag.
+func element(tag string, i, count int) string {
+	if count == 1 {
+		return tag
+	}
+	if j := strings.LastIndex(tag, "["); j > 0 && strings.HasSuffix(tag, "]") {
+		if n, err := strconv.Atoi(tag[j+1 : len(tag)-1]); err == nil {
+			return tag[:j] + "[" + strconv.Itoa(n+i) + "]"
+		}
+	}
+	return tag + "[" + strconv.Itoa(i) + "]"
+}
+
+func typeName(typ int) string {
+	if typ >= plc.TypeStructHead {
+		return fmt.Sprintf("STRUCT(0x%04X)", typ&0xFFFF)
+	}
+	return plc.Tag{Type: typ}.TypeString()
+}
+
+// elemSize returns size of one element of n elements in data.
+func elemSize(typ int, data []uint8, n int) int {
+	if typ >= plc.TypeStructHead {
+		return len(data) / n
+	}
+	return plc.Tag{Type: typ}.ElemLen()
+}
+
+func decodeUint(d []uint8) uint64 {
+	var u uint64
+	for i := len(d) - 1; i >= 0; i-- {
+		u = u<<8 | uint64(d[i])
+	}
+	return u
+}
+
+func encodeUint(d []uint8, u uint64) {
+	for i := range d {
+		d[i] = uint8(u >> (8 * uint(i)))
+	}
+}
+
+// formatValue formats element of type typ. Other than numeric and BOOL types are shown in hex.
+func formatValue(typ int, d []uint8) string {
+	if typ >= plc.TypeStructHead {
+		return hex.EncodeToString(d)
+	}
+	u := decodeUint(d)
+	bits := uint(64 - 8*len(d))
+	switch (plc.Tag{Type: typ}).NumType() {
+	case plc.TypeBOOL:
+		return strconv.FormatBool(u != 0)
+	case plc.TypeSINT, plc.TypeINT, plc.TypeDINT, plc.TypeLINT:
+		return strconv.FormatInt(int64(u<<bits)>>bits, 10)
+	case plc.TypeUSINT, plc.TypeUINT, plc.TypeUDINT, plc.TypeULINT:
+		return strconv.FormatUint(u, 10)
+	case plc.TypeREAL:
+		return strconv.FormatFloat(float64(math.Float32frombits(uint32(u))), 'g', -1, 32)
+	case plc.TypeLREAL:
+		return strconv.FormatFloat(math.Float64frombits(u), 'g', -1, 64)
+	}
+	return hex.EncodeToString(d)
+}
+
+// parseValue encodes value of element of type typ and size bytes.
+func parseValue(typ int, size int, s string) ([]uint8, error) {
+	s = strings.TrimSpace(s)
+	d := make([]uint8, size)
+	if typ >= plc.TypeStructHead {
+		return hexValue(d, s)
+	}
+	var err error
+	switch (plc.Tag{Type: typ}).NumType() {
+	case plc.TypeBOOL:
+		var b bool
+		b, err = strconv.ParseBool(s)
+		if b {
+			d[0] = 1
+		}
+	case plc.TypeSINT, plc.TypeINT, plc.TypeDINT, plc.TypeLINT:
+		var i int64
+		i, err = strconv.ParseInt(s, 0, 8*size)
+		encodeUint(d, uint64(i))
+	case plc.TypeUSINT, plc.TypeUINT, plc.TypeUDINT, plc.TypeULINT:
+		var u uint64
+		u, err = strconv.ParseUint(s, 0, 8*size)
+		encodeUint(d, u)
+	case plc.TypeREAL:
+		var f float64
+		f, err = strconv.ParseFloat(s, 32)
+		encodeUint(d, uint64(math.Float32bits(float32(f))))
+	case plc.TypeLREAL:
+		var f float64
+		f, err = strconv.ParseFloat(s, 64)
+		encodeUint(d, math.Float64bits(f))
+	default:
+		return hexValue(d, s)
+	}
+	return d, err
+}
+
+func hexValue(d []uint8, s string) ([]uint8, error) {
+	h, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(h) != len(d) {
+		return nil, fmt.Errorf("%d bytes expected", len(d))
+	}
+	return h, nil
+}
+
+func printTag(pr *printer, tag string, t *plc.Tag, n int) {
+	data := t.DataBytes()
+	size := elemSize(t.Type, data, n)
+	for i := 0; i < n && size > 0 && (i+1)*size <= len(data); i++ {
+		pr.row(element(tag, i, n), typeName(t.Type), formatValue(t.Type, data[i*size:(i+1)*size]))
+	}
+}
+
+func read(c *plc.Client, tag string) error {
+	if *count < 1 {
+		return errors.New("count must be positive")
+	}
+	t, err := c.ReadTag(tag, *count)
+	if err != nil {
+		return err
+	}
+	pr := newPrinter(false, "tag", "type", "value")
+	printTag(pr, tag, t, *count)
+	pr.flush()
+	return nil
+}
+
+func write(c *plc.Client, tag string, value string) error {
+	vals := strings.Split(value, ",")
+	t, err := c.ReadTag(tag, len(vals))
+	if err != nil {
+		return err
+	}
+	size := elemSize(t.Type, t.DataBytes(), len(vals))
+	var data []uint8
+	for i, v := range vals {
+		d, err := parseValue(t.Type, size, v)
+		if err != nil {
+			return fmt.Errorf("%s: %v", element(tag, i, len(vals)), err)
+		}
+		data = append(data, d...)
+	}
+	if err = c.WriteTag(tag, t.Type, len(vals), data); err != nil {
+		return err
+	}
+	if t, err = c.ReadTag(tag, len(vals)); err != nil {
+		return err
+	}
+	pr := newPrinter(false, "tag", "type", "value")
+	printTag(pr, tag, t, len(vals))
+	pr.flush()
+	return nil
+}
+
+func getAttr(c *plc.Client, args []string) error {
+	var n [3]int
+	for i, a := range args {
+		v, err := strconv.ParseInt(a, 0, 32)
+		if err != nil || v < 0 {
+			return errors.New("invalid number " + a)
+		}
+		n[i] = int(v)
+	}
+	d, err := c.GetAttributeSingle(n[0], n[1], n[2])
+	if err != nil {
+		return err
+	}
+	pr := newPrinter(false, "class", "instance", "attribute", "data")
+	pr.row(fmt.Sprintf("0x%02X", n[0]), strconv.Itoa(n[1]), strconv.Itoa(n[2]), fmt.Sprintf("% X", d))
+	pr.flush()
+	return nil
+}
+
+func templates(c *plc.Client) error {
+	syms, err := c.ListTags()
+	if err != nil {
+		return err
+	}
+	var queue []int
+	seen := make(map[int]bool)
+	add := func(typ int) {
+		if typ&plc.TypeStruct != 0 && !seen[typ&plc.TypeType] {
+			seen[typ&plc.TypeType] = true
+			queue = append(queue, typ&plc.TypeType)
+		}
+	}
+	for _, s := range syms {
+		add(s.Type)
+	}
+	var tps []*plc.Template
+	for len(queue) > 0 {
+		tp, err := c.ReadTemplate(queue[0])
+		if err != nil {
+			return fmt.Errorf("template %d: %v", queue[0], err)
+		}
+		queue = queue[1:]
+		for _, m := range tp.Members {
+			add(m.Type)
+		}
+		tps = append(tps, tp)
+	}
+	sort.Slice(tps, func(i, j int) bool { return tps[i].Name < tps[j].Name })
+
+	tn := templateNames{c, make(map[int]string)}
+	for _, tp := range tps {
+		tn.names[tp.Instance] = tp.Name
+	}
+	pr := newPrinter(false, "template", "instance", "handle", "size", "member", "type", "info", "offset")
+	for _, tp := range tps {
+		for _, m := range tp.Members {
+			pr.row(tp.Name, strconv.Itoa(tp.Instance), fmt.Sprintf("0x%04X", tp.Handle), strconv.Itoa(tp.Size),
+				m.Name, tn.typeName(m.Type), strconv.Itoa(m.Info), strconv.Itoa(m.Offset))
+		}
+	}
+	pr.flush()
+	return nil
+}
+
+func watch(c *plc.Client, tags []string) error {
+	if *interval <= 0 {
+		return errors.New("interval must be positive")
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	tick := time.NewTicker(*interval)
+	defer tick.Stop()
+
+	last := make(map[string]string)
+	pr := newPrinter(true, "time", "tag", "value")
+	for {
+		for _, tag := range tags {
+			t, err := c.ReadTag(tag, 1)
+			if err != nil {
+				return fmt.Errorf("%s: %v", tag, err)
+			}
+			v := formatValue(t.Type, t.DataBytes())
+			if old, ok := last[tag]; !ok || old != v {
+				last[tag] = v
+				pr.row(time.Now().Format("15:04:05.000"), tag, v)
+			}
+		}
+		select {
+		case <-tick.C:
+		case <-sig:
+			return nil
+		}
+	}
+}
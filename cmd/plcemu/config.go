@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	plc "github.com/podeszfa/plcconnector"
+	"gopkg.in/yaml.v3"
+)
+
+// config is emulator configuration. JSON files are read as YAML. Relative file names are relative to the configuration file.
+type config struct {
+	Identity    identityConfig `yaml:"identity"`
+	EDS         string         `yaml:"eds"`
+	Listen      listenConfig   `yaml:"listen"`
+	Log         string         `yaml:"log"`     // dump, debug, info (default), warn or error
+	Imports     []string       `yaml:"imports"` // L5X, L5K or JSON symbol files
+	Memory      string         `yaml:"memory"`  // JSON memory file, applied after imports and definitions
+	UDTs        []string       `yaml:"udts"`    // DATATYPE ... END_DATATYPE
+	Tags        []tagConfig    `yaml:"tags"`
+	Simulate    []simConfig    `yaml:"simulate"`
+	Persistence *persistConfig `yaml:"persistence"`
+	Modbus      *modbusConfig  `yaml:"modbus"` // tags served on listen.modbus
+}
+
+type identityConfig struct {
+	Vendor      int    `yaml:"vendor"`
+	DeviceType  int    `yaml:"deviceType"`
+	ProductCode int    `yaml:"productCode"`
+	Revision    string `yaml:"revision"` // major.minor
+	Name        string `yaml:"name"`
+	Serial      uint   `yaml:"serial"`
+}
+
+type listenConfig struct {
+	ENIP   string `yaml:"enip"` // default 0.0.0.0:44818
+	HTTP   string `yaml:"http"`
+	HTTPS  string `yaml:"https"`
+	Cert   string `yaml:"cert"`
+	Key    string `yaml:"key"`
+	Modbus string `yaml:"modbus"` // Modbus TCP, e.g. 0.0.0.0:502
+}
+
+type tagConfig struct {
+	Name  string      `yaml:"name"`
+	Type  string      `yaml:"type"`  // e.g. DINT, REAL[10], INT[4,4] or UDT name
+	Value interface{} `yaml:"value"` // initial value in the form of REST API
+}
+
+type simConfig struct {
+	Path          string `yaml:"path"`
+	plc.Generator `yaml:",inline"`
+}
+
+// modbusConfig maps tag paths to Modbus addresses, see plc.ModbusMap.
+type modbusConfig struct {
+	Coils            []plc.ModbusTag `yaml:"coils"`
+	DiscreteInputs   []plc.ModbusTag `yaml:"discreteInputs"`
+	HoldingRegisters []plc.ModbusTag `yaml:"holdingRegisters"`
+	InputRegisters   []plc.ModbusTag `yaml:"inputRegisters"`
+}
+
+type persistConfig struct {
+	Dir      string        `yaml:"dir"`
+	Interval time.Duration `yaml:"interval"` // snapshot interval, e.g. 1m
+}
+
+func loadConfig(name string) (*config, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var cfg config
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err = dec.Decode(&cfg); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if err = cfg.check(); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	dir := filepath.Dir(name)
+	abs := func(f *string) {
+		if *f != "" && !filepath.IsAbs(*f) {
+			*f = filepath.Join(dir, *f)
+		}
+	}
+	abs(&cfg.EDS)
+	abs(&cfg.Memory)
+	abs(&cfg.Listen.Cert)
+	abs(&cfg.Listen.Key)
+	for i := range cfg.Imports {
+		abs(&cfg.Imports[i])
+	}
+	if cfg.Persistence != nil {
+		abs(&cfg.Persistence.Dir)
+	}
+	return &cfg, nil
+}
+
+func (cfg *config) check() error {
+	if cfg.Listen.ENIP == "" {
+		cfg.Listen.ENIP = "0.0.0.0:44818"
+	}
+	if (cfg.Listen.Modbus == "") != (cfg.Modbus == nil) {
+		return errors.New("listen.modbus needs modbus tags and modbus tags need listen.modbus")
+	}
+	if m := cfg.Modbus; m != nil {
+		for _, tab := range [][]plc.ModbusTag{m.Coils, m.DiscreteInputs, m.HoldingRegisters, m.InputRegisters} {
+			for _, t := range tab {
+				if t.Path == "" {
+					return errors.New("modbus tag needs path")
+				}
+			}
+		}
+	}
+	if cfg.Listen.HTTPS != "" && (cfg.Listen.Cert == "" || cfg.Listen.Key == "") {
+		return errors.New("listen.https needs cert and key")
+	}
+	if _, ok := logLevels[cfg.Log]; !ok {
+		return errors.New("unknown log level " + cfg.Log)
+	}
+	for _, f := range cfg.Imports {
+		switch strings.ToLower(filepath.Ext(f)) {
+		case ".l5x", ".l5k", ".json":
+		default:
+			return errors.New("import " + f + ": L5X, L5K or JSON file expected")
+		}
+	}
+	for _, t := range cfg.Tags {
+		if t.Name == "" || t.Type == "" {
+			return errors.New("tag needs name and type")
+		}
+	}
+	if cfg.Persistence != nil && cfg.Persistence.Dir == "" {
+		return errors.New("persistence needs dir")
+	}
+	return nil
+}
+
+var logLevels = map[string]plc.LogLevel{"": plc.LogInfo, "dump": plc.LogDump, "debug": plc.LogDebug, "info": plc.LogInfo, "warn": plc.LogWarn, "error": plc.LogError}
+
+// onlySimulation reports whether configurations differ only in simulation rules, which can be applied to running PLC.
+func (cfg *config) onlySimulation(n *config) bool {
+	a, b := *cfg, *n
+	a.Simulate, b.Simulate = nil, nil
+	return reflect.DeepEqual(a, b)
+}
+
+// onlyTags reports whether configurations differ only in tags, data types and simulation rules,
+// which can be reloaded without dropping clients.
+func (cfg *config) onlyTags(n *config) bool {
+	a, b := *cfg, *n
+	a.Imports, a.Memory, a.UDTs, a.Tags, a.Simulate = nil, "", nil, nil, nil
+	b.Imports, b.Memory, b.UDTs, b.Tags, b.Simulate = nil, "", nil, nil, nil
+	return reflect.DeepEqual(a, b)
+}
+
+func (cfg *config) logger() plc.Logger {
+	return plc.NewTextLogger(os.Stderr, logLevels[cfg.Log])
+}
+
+// build creates PLC with identity and tags of the configuration.
+func (cfg *config) build(logger plc.Logger) (*plc.PLC, error) {
+	var (
+		p   *plc.PLC
+		err error
+	)
+	if cfg.EDS != "" {
+		p, err = plc.InitEDS(cfg.EDS)
+	} else {
+		p, err = plc.Init(nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cfg.logging(p, logger)
+
+	for _, f := range cfg.Imports {
+		switch strings.ToLower(filepath.Ext(f)) {
+		case ".l5x":
+			err = p.ImportL5X(f)
+		case ".l5k":
+			err = p.ImportL5K(f)
+		default:
+			err = p.ImportSymbols(f)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("import %s: %v", f, err)
+		}
+	}
+	for _, u := range cfg.UDTs {
+		if err = p.NewUDT(u); err != nil {
+			return nil, fmt.Errorf("udt %.40s: %v", u, err)
+		}
+	}
+	for _, t := range cfg.Tags {
+		if err = p.CreateTag(t.Type, t.Name); err != nil {
+			return nil, fmt.Errorf("tag %s: %v", t.Name, err)
+		}
+	}
+	if cfg.Memory != "" {
+		if err = p.ImportMemory(cfg.Memory); err != nil {
+			return nil, fmt.Errorf("memory %s: %v", cfg.Memory, err)
+		}
+	}
+	for _, t := range cfg.Tags {
+		if t.Value == nil {
+			continue
+		}
+		v, err := json.Marshal(t.Value)
+		if err == nil {
+			err = p.SetValue(t.Name, string(v))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tag %s: %v", t.Name, err)
+		}
+	}
+	if err = cfg.identity(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (cfg *config) logging(p *plc.PLC, logger plc.Logger) {
+	l := logLevels[cfg.Log]
+	p.Logger = logger
+	p.Verbose = l <= plc.LogDebug
+	p.DumpNetwork = l == plc.LogDump
+}
+
+func (cfg *config) identity(p *plc.PLC) error {
+	id := cfg.Identity
+	err := p.SetIdentity(plc.Identity{VendorID: id.Vendor, DeviceType: id.DeviceType, ProductCode: id.ProductCode, Revision: id.Revision, Name: id.Name, SerialNumber: id.Serial})
+	if err != nil {
+		return fmt.Errorf("identity: %v", err)
+	}
+	return nil
+}
+
+// simulate replaces generators of p by the configured ones.
+func (cfg *config) simulate(p *plc.PLC) error {
+	for path := range p.Simulations() {
+		p.StopSimulation(path)
+	}
+	for _, s := range cfg.Simulate {
+		if err := p.Simulate(s.Path, s.Generator); err != nil {
+			return fmt.Errorf("simulate %s: %v", s.Path, err)
+		}
+	}
+	return nil
+}
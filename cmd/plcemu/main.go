@@ -0,0 +1,200 @@
+// Command plcemu runs PLC emulator described by YAML or JSON configuration file.
+//
+// SIGINT and SIGTERM stop the emulator, writing final snapshot if persistence is enabled.
+// SIGHUP reloads the configuration: changed simulation rules are applied to the running emulator,
+// changed tags and data types are reloaded keeping client connections and values of unchanged tags,
+// other changes restart it with new configuration, keeping the old one if the new one is invalid.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	plc "github.com/podeszfa/plcconnector"
+)
+
+// emulator is PLC serving one configuration.
+type emulator struct {
+	cfg    *config
+	p      *plc.PLC
+	log    plc.Logger
+	served chan error // result of Serve
+	modbus net.Listener
+}
+
+func newEmulator(cfg *config) (*emulator, error) {
+	log := cfg.logger()
+	p, err := cfg.build(log)
+	if err != nil {
+		return nil, err
+	}
+	return &emulator{cfg: cfg, p: p, log: log, served: make(chan error, 1)}, nil
+}
+
+// start enables persistence and simulation and starts servers. EtherNet/IP and Modbus addresses are bound before it returns.
+func (em *emulator) start() error {
+	l := em.cfg.Listen
+	enip, err := em.p.Listen(l.ENIP)
+	if err != nil {
+		return fmt.Errorf("EtherNet/IP server: %v", err)
+	}
+	if l.Modbus != "" {
+		if em.modbus, err = net.Listen("tcp", l.Modbus); err != nil {
+			enip.Close()
+			return fmt.Errorf("Modbus server: %v", err)
+		}
+	}
+	closeListeners := func() {
+		enip.Close()
+		if em.modbus != nil {
+			em.modbus.Close()
+		}
+	}
+	if ps := em.cfg.Persistence; ps != nil {
+		if err = em.p.EnablePersistence(ps.Dir, ps.Interval); err != nil {
+			closeListeners()
+			return fmt.Errorf("persistence: %v", err)
+		}
+	}
+	if err = em.cfg.simulate(em.p); err != nil {
+		closeListeners()
+		em.p.DisablePersistence()
+		return err
+	}
+	go func() {
+		em.served <- em.p.ServeListener(enip)
+	}()
+	if em.modbus != nil {
+		m := plc.ModbusMap(*em.cfg.Modbus)
+		go func() {
+			if err := em.p.ServeModbus(em.modbus, m); err != nil {
+				em.log.Log(plc.LogError, "Modbus server", "err", err)
+			}
+		}()
+	}
+	if l.HTTP != "" {
+		em.p.ServeHTTP(l.HTTP)
+	}
+	if l.HTTPS != "" {
+		em.p.ServeHTTPS(l.HTTPS, l.Cert, l.Key)
+	}
+	em.log.Log(plc.LogInfo, "emulator started", "enip", l.ENIP, "http", l.HTTP, "https", l.HTTPS, "modbus", l.Modbus)
+	return nil
+}
+
+// stop shutdowns servers, simulation and persistence.
+func (em *emulator) stop() {
+	select {
+	case err := <-em.served:
+		em.served <- err
+	default:
+		em.p.Close()
+	}
+	em.p.CloseHTTP()
+	if em.modbus != nil {
+		em.modbus.Close()
+	}
+	for path := range em.p.Simulations() {
+		em.p.StopSimulation(path)
+	}
+	if err := em.p.DisablePersistence(); err != nil {
+		em.log.Log(plc.LogError, "persistence", "err", err)
+	}
+	em.log.Log(plc.LogInfo, "emulator stopped")
+}
+
+// reload applies configuration in file name, returning emulator to use from now on.
+func (em *emulator) reload(name string) *emulator {
+	cfg, err := loadConfig(name)
+	if err != nil {
+		em.log.Log(plc.LogError, "reload", "err", err)
+		return em
+	}
+	if em.cfg.onlySimulation(cfg) {
+		if err = cfg.simulate(em.p); err != nil {
+			em.log.Log(plc.LogError, "reload", "err", err)
+			em.cfg.simulate(em.p)
+			return em
+		}
+		em.cfg = cfg
+		em.log.Log(plc.LogInfo, "simulation reloaded")
+		return em
+	}
+	if em.cfg.onlyTags(cfg) {
+		staging, err := cfg.build(em.log)
+		if err != nil {
+			em.log.Log(plc.LogError, "reload", "err", err)
+			return em
+		}
+		em.p.ReloadTags(staging)
+		if err = cfg.simulate(em.p); err != nil {
+			em.log.Log(plc.LogError, "reload", "err", err)
+		}
+		em.cfg = cfg
+		return em
+	}
+
+	n, err := newEmulator(cfg)
+	if err != nil {
+		em.log.Log(plc.LogError, "reload", "err", err)
+		return em
+	}
+	em.stop()
+	if err = n.start(); err != nil {
+		em.log.Log(plc.LogError, "reload, restoring previous configuration", "err", err)
+		if n, err = newEmulator(em.cfg); err == nil {
+			err = n.start()
+		}
+		if err != nil {
+			em.log.Log(plc.LogError, "restore", "err", err)
+			os.Exit(1)
+		}
+	}
+	return n
+}
+
+func main() {
+	name := flag.String("config", "plcemu.yaml", "configuration file, YAML or JSON")
+	flag.Parse()
+
+	cfg, err := loadConfig(*name)
+	if err == nil {
+		var em *emulator
+		em, err = newEmulator(cfg)
+		if err == nil {
+			err = em.run(*name)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "plcemu:", err)
+		os.Exit(1)
+	}
+}
+
+func (em *emulator) run(name string) error {
+	if err := em.start(); err != nil {
+		return err
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for {
+		select {
+		case err := <-em.served:
+			em.served <- err
+			em.stop()
+			return fmt.Errorf("EtherNet/IP server: %v", err)
+		case s := <-sig:
+			if s != syscall.SIGHUP {
+				em.log.Log(plc.LogInfo, "signal", "signal", s)
+				em.stop()
+				return nil
+			}
+			em.log.Log(plc.LogInfo, "reloading configuration", "file", name)
+			em = em.reload(name)
+		}
+	}
+}
@@ -39,7 +39,7 @@ func (p *PLC) getEDS(section string, item string) (string, error) {
 	if ok {
 		v, vok := s[item]
 		if vok {
-			fmt.Println(section, item, v)
+			p.log(LogDebug, "EDS", "section", section, "item", item, "value", v)
 			return v, nil
 		}
 	}
@@ -116,7 +116,7 @@ func (p *PLC) loadEDS(eds []byte) error {
 				p.favicon = f[i : i+icoSize]
 				i += icoSize
 
-				fmt.Printf("ICO: %d icon(s), %d bytes\n", icons, icoSize)
+				p.log(LogDebug, "EDS icon", "icons", icons, "bytes", icoSize)
 			} else {
 				return errBadICO
 			}
@@ -301,14 +301,9 @@ func (p *PLC) loadEDS(eds []byte) error {
 	in.attr[10] = &Tag{Name: "Attr10", Type: TypeDINT, data: []uint8{0xF8, 0xDE, 0x47, 0xB8}}
 	p.Class[0xAC].SetInstance(1, in)
 
-	p.Class[ProgramClass] = NewClass("Program", 0)
-	in = NewInstance(1)
-	in.attr[1] = TagString("main", "Program Name")
-	p.Class[ProgramClass].SetInstance(1, in)
+	p.Class[ProgramClass] = NewClass("Program", 0) // instances added by AddProgram
 
-	p.Class[SymbolClass] = NewClass("Symbol", 8)
-	p.Class[SymbolClass].inst[0].SetAttrUINT(1, 4)
-	p.Class[SymbolClass].inst[0].attr[8] = TagUDINT(0, "Symbol UID")
+	p.Class[SymbolClass] = newSymbolClass()
 	p.symbols = p.Class[SymbolClass]
 
 	p.Class[TemplateClass] = NewClass("Template", 0)
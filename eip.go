@@ -130,6 +130,25 @@ func parsePath(p string) []pathEl {
 	return e
 }
 
+// pathString returns path in the format of parsePath.
+func pathString(p []pathEl) string {
+	var b strings.Builder
+	for i, e := range p {
+		switch e.typ {
+		case ansiExtended:
+			if i > 0 {
+				b.WriteByte('.')
+			}
+			b.WriteString(e.txt)
+		case pathMember:
+			b.WriteString("[" + strconv.Itoa(e.val) + "]")
+		case pathBit:
+			b.WriteString("." + strconv.Itoa(e.val))
+		}
+	}
+	return b.String()
+}
+
 func constructPath(p []pathEl) []uint8 {
 	if p == nil {
 		return nil
@@ -194,7 +213,7 @@ func (r *req) parsePath(path []uint8) (int, int, int, int, []pathEl, error) {
 				el = int(path[i+2]) + (int(path[i+3]) << 8) + (int(path[i+4]) << 16) + (int(path[i+5]) << 24)
 				i += 5
 			default:
-				r.p.debug("path size error")
+				r.log(LogDebug, "path size error")
 				return 0, 0, 0, 0, nil, errPath
 			}
 			switch typ {
@@ -221,11 +240,11 @@ func (r *req) parsePath(path []uint8) (int, int, int, int, []pathEl, error) {
 				}
 				pth = append(pth, pathEl{typ: pathMember, val: el})
 			default:
-				r.p.debug("path segment type error")
+				r.log(LogDebug, "path segment type error")
 				return 0, 0, 0, 0, nil, errPath
 			}
 		} else {
-			r.p.debug("path type error", path[i])
+			r.log(LogDebug, "path type error", "segment", hexField(path[i]))
 			return 0, 0, 0, 0, nil, errPath
 		}
 		x++
@@ -234,7 +253,7 @@ func (r *req) parsePath(path []uint8) (int, int, int, int, []pathEl, error) {
 }
 
 func (r *req) eipNOP() error {
-	r.p.debug("NOP")
+	r.log(LogDebug, "NOP")
 
 	data := make([]byte, r.encHead.Length)
 	_, err := r.read(&data)
@@ -245,7 +264,7 @@ func (r *req) eipNOP() error {
 }
 
 func (r *req) eipRegisterSession() error {
-	r.p.debug("RegisterSession")
+	r.log(LogDebug, "RegisterSession")
 
 	var data registerSessionData
 	_, err := r.read(&data)
@@ -0,0 +1,54 @@
+package plcconnector
+
+import "time"
+
+// TagEvent describes change of tag data.
+type TagEvent struct {
+	Tag    string
+	Offset int     // offset of changed data in the tag
+	Data   []uint8 // changed data
+	Source string  // write path, as in HistoryEntry
+	Time   time.Time
+}
+
+// Subscription receives tag change events on C until closed.
+type Subscription struct {
+	C <-chan TagEvent
+
+	c chan TagEvent
+	p *PLC
+}
+
+// Subscribe returns subscription to changes of all tags. Events are dropped when buffer of size buf is full.
+func (p *PLC) Subscribe(buf int) *Subscription {
+	c := make(chan TagEvent, buf)
+	s := &Subscription{C: c, c: c, p: p}
+	p.tMut.Lock()
+	p.subs[s] = struct{}{}
+	p.tMut.Unlock()
+	return s
+}
+
+// Close stops delivery of events and closes C.
+func (s *Subscription) Close() {
+	s.p.tMut.Lock()
+	if _, ok := s.p.subs[s]; ok {
+		delete(s.p.subs, s)
+		close(s.c)
+	}
+	s.p.tMut.Unlock()
+}
+
+// notify sends change event to subscribers. Must be called with tMut locked.
+func (p *PLC) notify(t *Tag, offset int, data []uint8, source string) {
+	if len(p.subs) == 0 {
+		return
+	}
+	e := TagEvent{Tag: t.Name, Offset: offset, Data: append([]uint8{}, data...), Source: source, Time: time.Now()}
+	for s := range p.subs {
+		select {
+		case s.c <- e:
+		default:
+		}
+	}
+}
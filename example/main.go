@@ -5,6 +5,7 @@ import (
 	"math"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	plc "github.com/podeszfa/plcconnector"
@@ -87,7 +88,13 @@ func main() {
 	}
 
 	if len(os.Args) >= 3 {
-		err = p.ImportSymbols(os.Args[2])
+		if strings.HasSuffix(strings.ToLower(os.Args[2]), ".l5x") {
+			err = p.ImportL5X(os.Args[2])
+		} else if strings.HasSuffix(strings.ToLower(os.Args[2]), ".l5k") {
+			err = p.ImportL5K(os.Args[2])
+		} else {
+			err = p.ImportSymbols(os.Args[2])
+		}
 		if err != nil {
 			fmt.Println(err)
 			return
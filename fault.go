@@ -0,0 +1,213 @@
+package plcconnector
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// FaultRule makes the server misbehave for matching CIP requests. Empty match fields match anything.
+type FaultRule struct {
+	Service     int     `json:"service,omitempty"` // CIP service, embedded one for Unconnected Send
+	Class       int     `json:"class,omitempty"`
+	Tag         string  `json:"tag,omitempty"`         // path.Match pattern, case insensitive
+	Client      string  `json:"client,omitempty"`      // IP address or CIDR
+	Probability float64 `json:"probability,omitempty"` // chance of applying the rule, 0 means always
+
+	Latency           time.Duration `json:"latency,omitempty"` // delay before processing, nanoseconds in JSON
+	Drop              bool          `json:"drop,omitempty"`    // request is processed, response is not sent
+	Close             bool          `json:"close,omitempty"`   // TCP connection is closed without response
+	Status            uint8         `json:"status,omitempty"`  // general status returned instead of processing
+	ExtStatus         []uint16      `json:"extStatus,omitempty"`
+	CorruptLength     bool          `json:"corruptLength,omitempty"`     // encapsulation length of response is wrong
+	RejectForwardOpen bool          `json:"rejectForwardOpen,omitempty"` // rule matches only Forward Open, which fails with ConnFailure, extended status 0x0113 unless ExtStatus is set
+}
+
+// FaultPolicy is list of fault rules, the first matching one is applied.
+type FaultPolicy struct {
+	Rules []FaultRule `json:"rules"`
+}
+
+// SetFaultPolicy replaces fault policy. Nil disables fault injection.
+func (p *PLC) SetFaultPolicy(fp *FaultPolicy) error {
+	if fp != nil {
+		for _, r := range fp.Rules {
+			if r.Client != "" && net.ParseIP(r.Client) == nil {
+				if _, _, err := net.ParseCIDR(r.Client); err != nil {
+					return errors.New("invalid client " + r.Client)
+				}
+			}
+			if _, err := path.Match(r.Tag, ""); err != nil {
+				return errors.New("invalid tag pattern " + r.Tag)
+			}
+		}
+		c := *fp
+		c.Rules = append([]FaultRule(nil), fp.Rules...)
+		fp = &c
+	}
+	p.faultMut.Lock()
+	p.faults = fp
+	p.faultMut.Unlock()
+	return nil
+}
+
+// FaultPolicy returns copy of current fault policy.
+func (p *PLC) FaultPolicy() FaultPolicy {
+	p.faultMut.RLock()
+	defer p.faultMut.RUnlock()
+	if p.faults == nil {
+		return FaultPolicy{Rules: []FaultRule{}}
+	}
+	return FaultPolicy{Rules: append([]FaultRule(nil), p.faults.Rules...)}
+}
+
+// pathTag returns tag name addressed by path or "".
+func (p *PLC) pathTag(pth []pathEl) string {
+	p.tMut.RLock()
+	defer p.tMut.RUnlock()
+	name, _ := p.tagName(pth)
+	return name
+}
+
+func (f *FaultRule) matchClient(addr net.Addr) bool {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip = a.IP
+	case *net.UDPAddr:
+		ip = a.IP
+	}
+	if ip == nil {
+		return false
+	}
+	if _, n, err := net.ParseCIDR(f.Client); err == nil {
+		return n.Contains(ip)
+	}
+	return net.ParseIP(f.Client).Equal(ip)
+}
+
+func (r *req) forwardOpen() bool {
+	return r.class == ConnManager && (r.protd.Service == ForwardOpen || r.protd.Service == LargeForwOpen)
+}
+
+// fault returns rule to apply to current request or nil.
+func (r *req) fault() *FaultRule {
+	r.p.faultMut.RLock()
+	fp := r.p.faults
+	r.p.faultMut.RUnlock()
+	if fp == nil {
+		return nil
+	}
+	tag := ""
+	for i := range fp.Rules {
+		f := &fp.Rules[i]
+		if f.Service != 0 && f.Service != int(r.protd.Service) || f.Class != 0 && f.Class != r.class {
+			continue
+		}
+		if f.RejectForwardOpen && !r.forwardOpen() {
+			continue
+		}
+		if f.Client != "" && !f.matchClient(r.remote) {
+			continue
+		}
+		if f.Tag != "" {
+			if tag == "" {
+				tag = strings.ToLower(r.p.pathTag(r.path))
+			}
+			if ok, _ := path.Match(strings.ToLower(f.Tag), tag); !ok || tag == "" {
+				continue
+			}
+		}
+		if f.Probability > 0 && rand.Float64() >= f.Probability {
+			continue
+		}
+		return f
+	}
+	return nil
+}
+
+// faultStatus writes error response of the rule if it replaces processing of request.
+func (r *req) faultStatus(f *FaultRule) bool {
+	status, ext := f.Status, f.ExtStatus
+	if f.RejectForwardOpen {
+		status = ConnFailure
+		if len(ext) == 0 {
+			ext = []uint16{0x0113}
+		}
+	}
+	if status == Success {
+		return false
+	}
+	r.log(LogInfo, "fault injected", "status", hexField(status))
+	r.discard()
+	r.resp.Status = status
+	r.resp.AddStatusSize = uint8(len(ext))
+	r.write(r.resp)
+	r.write(ext)
+	return true
+}
+
+// embeddedFault applies rule to request embedded in Multiple Service Packet, reporting whether it replaced processing.
+// Drop, Close and CorruptLength act on the whole response after the packet is processed.
+func (r *req) embeddedFault(f *FaultRule) bool {
+	if f.Latency > 0 {
+		time.Sleep(f.Latency)
+	}
+	if f.Drop || f.Close || f.CorruptLength {
+		if r.embFault == nil {
+			r.embFault = f
+		}
+	}
+	if f.Status == Success {
+		return false
+	}
+	r.log(LogInfo, "fault injected", "status", hexField(f.Status), "embedded", true)
+	data := make([]uint8, r.dataLen)
+	r.read(&data)
+	r.resp.Status = f.Status
+	r.resp.AddStatusSize = uint8(len(f.ExtStatus))
+	r.write(r.resp)
+	r.write(f.ExtStatus)
+	r.resp.AddStatusSize = 0
+	return true
+}
+
+// faultsHTTP serves fault policy:
+//
+//	GET    /api/v1/faults   current policy
+//	PUT    /api/v1/faults   replace policy
+//	DELETE /api/v1/faults   disable fault injection
+func (p *PLC) faultsHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.authOf(r).role < RoleAdmin {
+		apiFail(w, http.StatusForbidden, "admin role required")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		apiSend(w, http.StatusOK, p.FaultPolicy())
+	case http.MethodPut:
+		var fp FaultPolicy
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		err := dec.Decode(&fp)
+		if err == nil {
+			err = p.SetFaultPolicy(&fp)
+		}
+		if err != nil {
+			apiFail(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		p.SetFaultPolicy(nil)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		apiFail(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,251 @@
+package plcconnector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFaultMatch(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.NewTag(int16(1), "Speed")
+	p.NewTag(int16(2), "Program:Main.x")
+
+	remote := &net.TCPAddr{IP: net.IPv4(10, 1, 2, 3), Port: 1234}
+	tests := []struct {
+		rule    FaultRule
+		service uint8
+		class   int
+		path    string
+		want    bool
+	}{
+		{FaultRule{}, ReadTag, 0, "Speed", true},
+		{FaultRule{Service: ReadTag}, ReadTag, 0, "Speed", true},
+		{FaultRule{Service: WriteTag}, ReadTag, 0, "Speed", false},
+		{FaultRule{Class: IdentityClass}, GetAttrAll, IdentityClass, "", true},
+		{FaultRule{Class: IdentityClass}, GetAttrAll, ConnManager, "", false},
+		{FaultRule{Tag: "sp*"}, ReadTag, 0, "Speed", true},
+		{FaultRule{Tag: "sp*"}, ReadTag, 0, "Speed.member", true},
+		{FaultRule{Tag: "sp*"}, GetAttrAll, IdentityClass, "", false},
+		{FaultRule{Tag: "program:main.*"}, ReadTag, 0, "Program:Main.x", true},
+		{FaultRule{Client: "10.1.2.3"}, ReadTag, 0, "Speed", true},
+		{FaultRule{Client: "10.0.0.0/8"}, ReadTag, 0, "Speed", true},
+		{FaultRule{Client: "192.168.0.0/16"}, ReadTag, 0, "Speed", false},
+		{FaultRule{RejectForwardOpen: true}, ReadTag, 0, "Speed", false},
+		{FaultRule{RejectForwardOpen: true}, LargeForwOpen, ConnManager, "", true},
+		{FaultRule{Probability: 1e-9, Status: 1}, ReadTag, 0, "Speed", false},
+	}
+	for i, tt := range tests {
+		if err := p.SetFaultPolicy(&FaultPolicy{Rules: []FaultRule{tt.rule}}); err != nil {
+			t.Fatal(err)
+		}
+		r := req{p: p, remote: remote, class: tt.class}
+		r.protd.Service = tt.service
+		if tt.path != "" {
+			r.path = parsePath(tt.path)
+		}
+		if got := r.fault() != nil; got != tt.want {
+			t.Errorf("%d: %+v = %v, want %v", i, tt.rule, got, tt.want)
+		}
+	}
+	if p.SetFaultPolicy(&FaultPolicy{Rules: []FaultRule{{Client: "nope"}}}) == nil {
+		t.Error("invalid client accepted")
+	}
+}
+
+func rrRequest(service uint8, path []uint8, data []uint8) []byte {
+	var b bytes.Buffer
+	bwrite(&b, encapsulationHeader{Command: ecSendRRData, Length: uint16(16 + 2 + len(path) + len(data))})
+	bwrite(&b, sendData{ItemCount: 2})
+	bwrite(&b, itemType{Type: itNullAddress})
+	bwrite(&b, itemType{Type: itUnconnData, Length: uint16(2 + len(path) + len(data))})
+	bwrite(&b, protocolData{Service: service, PathSize: uint8(len(path) / 2)})
+	b.Write(path)
+	b.Write(data)
+	return b.Bytes()
+}
+
+func TestFaultInjection(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.NewTag(int16(7), "a")
+	conn, srv := net.Pipe()
+	go p.handleRequest(srv)
+	defer conn.Close()
+
+	readTag := rrRequest(ReadTag, constructPath(parsePath("a")), []uint8{1, 0})
+	var fo bytes.Buffer
+	bwrite(&fo, forwardOpenData{TOConnectionID: 5, TOConnPar: 500, ConnPathSize: 2})
+	bwrite(&fo, []uint8{0x20, 0x02, 0x24, 0x01})
+	forwardOpen := rrRequest(ForwardOpen, pathCIA(ConnManager, 1, -1, -1), fo.Bytes())
+
+	// roundTrip returns general status, additional status and declared minus actual encapsulation length.
+	roundTrip := func(f []byte) (int, []uint16, int, error) {
+		conn.SetDeadline(time.Now().Add(200 * time.Millisecond))
+		if _, err := conn.Write(f); err != nil {
+			return 0, nil, 0, err
+		}
+		head := make([]byte, encHeadSize)
+		if _, err := conn.Read(head); err != nil {
+			return 0, nil, 0, err
+		}
+		body := make([]byte, 512)
+		n, err := conn.Read(body)
+		if err != nil {
+			return 0, nil, 0, err
+		}
+		resp := append(head, body[:n]...)
+		o := cipOffset(resp)
+		ext := make([]uint16, resp[o+3])
+		binary.Read(bytes.NewReader(resp[o+4:]), binary.LittleEndian, ext)
+		return int(resp[o+2]), ext, int(binary.LittleEndian.Uint16(head[2:])) - n, nil
+	}
+
+	tests := []struct {
+		name   string
+		rule   *FaultRule
+		req    []byte
+		status int
+		ext    []uint16
+		diff   int
+		err    bool
+		delay  time.Duration
+	}{
+		{name: "none", req: readTag},
+		{name: "status", rule: &FaultRule{Tag: "a", Status: PrivilegeViol, ExtStatus: []uint16{0x1234}}, req: readTag, status: PrivilegeViol, ext: []uint16{0x1234}},
+		{name: "other tag", rule: &FaultRule{Tag: "b", Status: PrivilegeViol}, req: readTag},
+		{name: "forward open", rule: &FaultRule{RejectForwardOpen: true}, req: forwardOpen, status: ConnFailure, ext: []uint16{0x0113}},
+		{name: "latency", rule: &FaultRule{Latency: 50 * time.Millisecond}, req: readTag, delay: 50 * time.Millisecond},
+		{name: "corrupt length", rule: &FaultRule{CorruptLength: true}, req: readTag, diff: 16},
+		{name: "drop", rule: &FaultRule{Drop: true}, req: readTag, err: true},
+		{name: "after drop", req: readTag},
+		{name: "close", rule: &FaultRule{Close: true}, req: readTag, err: true},
+	}
+	for _, tt := range tests {
+		var fp *FaultPolicy
+		if tt.rule != nil {
+			fp = &FaultPolicy{Rules: []FaultRule{*tt.rule}}
+		}
+		p.SetFaultPolicy(fp)
+		start := time.Now()
+		status, ext, diff, err := roundTrip(tt.req)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: err %v", tt.name, err)
+			continue
+		}
+		if err == nil && (status != tt.status || len(ext) != len(tt.ext) || diff != tt.diff) {
+			t.Errorf("%s: status 0x%02X %04X length diff %d", tt.name, status, ext, diff)
+		}
+		for i := range ext {
+			if ext[i] != tt.ext[i] {
+				t.Errorf("%s: ext %04X", tt.name, ext)
+			}
+		}
+		if time.Since(start) < tt.delay {
+			t.Errorf("%s: no delay", tt.name)
+		}
+	}
+}
+
+func TestFaultHTTP(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetHTTPAuth(&HTTPAuth{Tokens: map[string]Role{"adm": RoleAdmin, "op": RoleOperator}})
+	h := p.withAuth(p.handler)
+
+	tests := []struct {
+		method, token, body string
+		code                int
+		want                string
+	}{
+		{"GET", "op", "", 403, ""},
+		{"PUT", "op", `{"rules":[{"status":1}]}`, 403, ""},
+		{"GET", "adm", "", 200, `{"rules":[]}`},
+		{"PUT", "adm", `{"rules":[{"tag":"a*","status":8,"latency":1000000}]}`, 204, ""},
+		{"GET", "adm", "", 200, `{"rules":[{"tag":"a*","latency":1000000,"status":8}]}`},
+		{"PUT", "adm", `{"rules":[{"client":"x"}]}`, 400, ""},
+		{"PUT", "adm", `{"rules":[{"bogus":1}]}`, 400, ""},
+		{"DELETE", "adm", "", 204, ""},
+		{"GET", "adm", "", 200, `{"rules":[]}`},
+		{"POST", "adm", "", 405, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/api/v1/faults", strings.NewReader(tt.body))
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		w := httptest.NewRecorder()
+		h(w, req)
+		if w.Code != tt.code || tt.want != "" && strings.TrimSpace(w.Body.String()) != tt.want {
+			t.Errorf("%s %s: %d %s", tt.method, tt.body, w.Code, w.Body.String())
+		}
+	}
+	if fp := p.FaultPolicy(); len(fp.Rules) != 0 {
+		t.Errorf("policy %+v", fp)
+	}
+}
+
+func TestFaultMultiServ(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.NewTag(int16(7), "a")
+	p.NewTag(int16(8), "b")
+	p.SetFaultPolicy(&FaultPolicy{Rules: []FaultRule{{Tag: "b", Status: PrivilegeViol, ExtStatus: []uint16{0x1234}}}})
+	conn, srv := net.Pipe()
+	go p.handleRequest(srv)
+	defer conn.Close()
+
+	var reqs [][]byte
+	for _, n := range []string{"b", "a"} {
+		var b bytes.Buffer
+		path := constructPath(parsePath(n))
+		bwrite(&b, protocolData{Service: ReadTag, PathSize: uint8(len(path) / 2)})
+		b.Write(path)
+		b.Write([]uint8{1, 0})
+		reqs = append(reqs, b.Bytes())
+	}
+	var data bytes.Buffer
+	bwrite(&data, []uint16{2, 6, uint16(6 + len(reqs[0]))})
+	data.Write(reqs[0])
+	data.Write(reqs[1])
+
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if _, err = conn.Write(rrRequest(MultiServ, pathCIA(MessageRouter, 1, -1, -1), data.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	resp := make([]byte, 512)
+	n, err := io.ReadAtLeast(conn, resp, encHeadSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n < encHeadSize+int(binary.LittleEndian.Uint16(resp[2:])) {
+		m, err := conn.Read(resp[n:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		n += m
+	}
+	o := cipOffset(resp[:n]) + 4
+	rd := func(i int) []byte {
+		off := int(binary.LittleEndian.Uint16(resp[o+2+2*i:]))
+		return resp[o+off:]
+	}
+	if b := rd(0); b[2] != PrivilegeViol || b[3] != 1 || binary.LittleEndian.Uint16(b[4:]) != 0x1234 {
+		t.Errorf("b: % X", b[:6])
+	}
+	if a := rd(1); a[2] != Success || binary.LittleEndian.Uint16(a[4:]) != TypeINT || a[6] != 7 {
+		t.Errorf("a: % X", a[:8])
+	}
+}
@@ -1,3 +1,8 @@
 module github.com/podeszfa/plcconnector
 
 go 1.16
+
+require (
+	golang.org/x/crypto v0.0.0-20211117183948-ae814b36b871
+	gopkg.in/yaml.v3 v3.0.1
+)
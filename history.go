@@ -0,0 +1,108 @@
+package plcconnector
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// HistoryEntry is tag value recorded after write.
+type HistoryEntry struct {
+	Time   time.Time
+	Source string // write path: WriteTag, ReadModifyWrite, UpdateTag, SetString, init
+	Data   []uint8
+}
+
+// history is ring buffer of tag values.
+type history struct {
+	depth  int
+	window time.Duration
+	e      []HistoryEntry
+	start  int
+}
+
+func (h *history) add(e HistoryEntry) {
+	if len(h.e) < h.depth {
+		h.e = append(h.e, e)
+		return
+	}
+	h.e[h.start] = e
+	h.start = (h.start + 1) % h.depth
+}
+
+// EnableHistory records up to depth last values of the tag, not older than window (0 means no time limit).
+// Empty tag enables history of all tags.
+func (p *PLC) EnableHistory(tag string, depth int, window time.Duration) error {
+	if depth <= 0 {
+		return errors.New("history depth must be positive")
+	}
+	p.tMut.Lock()
+	defer p.tMut.Unlock()
+
+	if tag == "" {
+		p.histAll = &history{depth: depth, window: window}
+		for n, t := range p.tags {
+			if p.hist[n] == nil {
+				p.addHistory(t, "init")
+			}
+		}
+		return nil
+	}
+	t, ok := p.tags[strings.ToLower(tag)]
+	if !ok {
+		return errors.New("no tag " + tag)
+	}
+	p.hist[strings.ToLower(t.Name)] = &history{depth: depth, window: window}
+	p.addHistory(t, "init")
+	return nil
+}
+
+// DisableHistory stops recording and removes history of the tag. Empty tag disables history of all tags.
+func (p *PLC) DisableHistory(tag string) {
+	p.tMut.Lock()
+	if tag == "" {
+		p.histAll = nil
+		p.hist = make(map[string]*history)
+	} else {
+		delete(p.hist, strings.ToLower(tag))
+	}
+	p.tMut.Unlock()
+}
+
+// addHistory records current value of the tag. Must be called with tMut locked.
+func (p *PLC) addHistory(t *Tag, source string) {
+	name := strings.ToLower(t.Name)
+	h := p.hist[name]
+	if h == nil {
+		if p.histAll == nil {
+			return
+		}
+		h = &history{depth: p.histAll.depth, window: p.histAll.window}
+		p.hist[name] = h
+	}
+	h.add(HistoryEntry{Time: time.Now(), Source: source, Data: append([]uint8{}, t.data...)})
+}
+
+// History returns recorded values of the tag between from and to. Zero to means now.
+func (p *PLC) History(tag string, from, to time.Time) []HistoryEntry {
+	p.tMut.RLock()
+	defer p.tMut.RUnlock()
+
+	h := p.hist[strings.ToLower(tag)]
+	if h == nil {
+		return nil
+	}
+	now := time.Now()
+	var r []HistoryEntry
+	for i := 0; i < len(h.e); i++ {
+		e := h.e[(h.start+i)%len(h.e)]
+		if e.Time.Before(from) || (!to.IsZero() && e.Time.After(to)) {
+			continue
+		}
+		if h.window > 0 && now.Sub(e.Time) > h.window {
+			continue
+		}
+		r = append(r, e)
+	}
+	return r
+}
@@ -0,0 +1,67 @@
+package plcconnector
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.NewTag(int16(1), "a")
+	p.NewTag(int32(0), "b")
+	if err = p.EnableHistory("a", 3, 0); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	p.saveTag(parsePath("a"), TypeINT, 1, []uint8{2, 0}, 0)
+	p.UpdateTag("a", 0, []uint8{3, 0})
+	p.readModWriteTag(parsePath("a"), []uint8{4, 0}, []uint8{0xFF, 0xFF})
+	p.saveTag(parsePath("b"), TypeDINT, 1, []uint8{2, 0, 0, 0}, 0)
+
+	h := p.History("a", time.Time{}, time.Time{})
+	if len(h) != 3 {
+		t.Fatalf("len(History) = %d, want 3", len(h))
+	}
+	want := []struct {
+		src  string
+		data []uint8
+	}{{"WriteTag", []uint8{2, 0}}, {"UpdateTag", []uint8{3, 0}}, {"ReadModifyWrite", []uint8{7, 0}}}
+	for i, w := range want {
+		if h[i].Source != w.src || !reflect.DeepEqual(h[i].Data, w.data) {
+			t.Errorf("History[%d] = %s %v, want %s %v", i, h[i].Source, h[i].Data, w.src, w.data)
+		}
+	}
+	if h := p.History("a", time.Now(), time.Time{}); len(h) != 0 {
+		t.Errorf("History from now = %d entries", len(h))
+	}
+	if h := p.History("a", start, time.Time{}); len(h) != 3 {
+		t.Errorf("History from start = %d entries", len(h))
+	}
+	if h := p.History("b", time.Time{}, time.Time{}); h != nil {
+		t.Error("b has no history")
+	}
+
+	w := httptest.NewRecorder()
+	p.handler(w, httptest.NewRequest("GET", "/a?history&format=json", nil))
+	var js []historyJSON
+	if err = json.Unmarshal(w.Body.Bytes(), &js); err != nil || len(js) != 3 || js[2].Value[0] != 7 {
+		t.Errorf("JSON history = %s, %v", w.Body.String(), err)
+	}
+	w = httptest.NewRecorder()
+	p.handler(w, httptest.NewRequest("GET", "/a?history&format=csv", nil))
+	if lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n"); len(lines) != 4 || !strings.HasSuffix(lines[3], ",ReadModifyWrite,7") {
+		t.Errorf("CSV history = %q", w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	p.handler(w, httptest.NewRequest("GET", "/nope?history", nil))
+	if w.Code != 404 {
+		t.Errorf("status = %d, want 404", w.Code)
+	}
+}
@@ -9,8 +9,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
+	"encoding/csv"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -48,14 +50,16 @@ func (p *PLC) tagsIndexHTML(w http.ResponseWriter, r *http.Request) {
 	arr := make([]string, 0, len(p.tags))
 
 	for _, t := range p.tags {
-		arr = append(arr, t.Name)
+		if p.allowed(r, t, false) {
+			arr = append(arr, t.Name)
+		}
 	}
 
 	sort.Strings(arr)
 
 	for _, n := range arr {
 		t := p.tags[strings.ToLower(n)]
-		toSend.WriteString("<tr class=\"" + iif(t.prot != 0, "pr", "rw") + "\"><td><a href=\"/" + n + "\" id=\"" + n + "\">" + n + "</a></td><td>" + strconv.Itoa(t.Dims()*t.Len()) + " B</td><td>" + t.TypeString() + t.DimString() + "</td><td>" + iif(t.prot != 0, "☐", "☑") + "</td><td>")
+		toSend.WriteString("<tr class=\"" + iif(t.prot != 0, "pr", "rw") + "\"><td><a href=\"/" + n + "\" id=\"" + n + "\">" + n + "</a></td><td>" + strconv.Itoa(len(t.data)) + " B</td><td>" + t.TypeString() + t.DimString() + "</td><td>" + iif(t.prot != 0, "☐", "☑") + "</td><td>")
 		var ascii strings.Builder
 		if t.BasicType() != TypeREAL && t.BasicType() != TypeLREAL && t.BasicType() != TypeBOOL {
 			ascii.Grow(t.Dims())
@@ -109,11 +113,35 @@ type tagJSON struct {
 	ASCII []string  `json:"ascii,omitempty"`
 }
 
-func tagToJSON(t *Tag) string {
+func tagToJSON(t *Tag) (string, error) {
 	var tj tagJSON
 	tj.Count = one(t.Dim[0])
+	tj.Data, tj.ASCII = tagValues(t)
+	tj.Typ = t.TypeString()
+
+	b, err := json.Marshal(tj)
+	if err != nil {
+		return "{}", err
+	}
+	return string(b), nil
+}
+
+// tagValues returns numeric values of elements of basic type tag and their ASCII codes.
+func tagValues(t *Tag) ([]float64, []string) {
+	var tj tagJSON
 	ln := t.ElemLen()
-	for i := 0; i < len(t.data); i += ln {
+	end := len(t.data)
+	if t.boolArray() {
+		for _, b := range t.DataBOOL() {
+			if b {
+				tj.Data = append(tj.Data, 1)
+			} else {
+				tj.Data = append(tj.Data, 0)
+			}
+		}
+		end = 0
+	}
+	for i := 0; i < end; i += ln {
 		tmp := int64(t.data[i])
 		for j := 1; j < ln; j++ {
 			tmp += int64(t.data[i+j]) << uint(8*j)
@@ -153,14 +181,7 @@ func tagToJSON(t *Tag) string {
 			}
 		}
 	}
-	tj.Typ = t.TypeString()
-
-	b, err := json.Marshal(tj)
-	if err != nil {
-		fmt.Println(err)
-		return "{}"
-	}
-	return string(b)
+	return tj.Data, tj.ASCII
 }
 
 func bytesToBinString(bs []byte) string {
@@ -214,10 +235,19 @@ func structToHTML(t *Tag, data []uint8, n int, N bool, prevName string, b *strin
 				structToHTML(&t.st.d[i], data[t.st.d[i].offset+off:t.st.d[i].offset+off+ln], 0, false, prevName+t.PathString(n)+".", &val)
 			}
 			val.WriteString("</table>")
-		} else if t.st.d[i].BasicType() == TypeBOOL { // FIXME: array of BOOL
+		} else if t.st.d[i].boolArray() {
+			val.WriteString("<td>")
+			for x := 0; x < t.st.d[i].Dim[0]; x++ {
+				if x != 0 {
+					val.WriteString(", ")
+				}
+				clic := prevName + t.PathString(n) + "." + t.st.d[i].PathString(x)
+				fmt.Fprintf(&val, "<span onclick=clicBOOL(event) class=clic tag='%s'>%d</span>", clic, (data[t.st.d[i].offset+off+x/8]>>(x%8))&1)
+			}
+		} else if t.st.d[i].BasicType() == TypeBOOL {
 			clic := prevName + t.PathString(n) + "." + t.st.d[i].Name
 			fmt.Fprintf(&val, "<td onclick=clicBOOL(event) class=clic tag='%s'>", clic)
-			if (data[t.st.d[i].offset+off]>>t.st.d[i].Dim[0])&1 == 1 {
+			if (data[t.st.d[i].offset+off]>>t.st.d[i].bit)&1 == 1 {
 				val.WriteString("1")
 			} else {
 				val.WriteString("0")
@@ -282,7 +312,7 @@ func tagToHTML(t *Tag) string {
 
 	ln := t.ElemLen()
 
-	toSend.WriteString("<!DOCTYPE html>\n<html><style>" + mainCSS + "</style><script>" + tagJS + "</script><title>" + t.Name + "</title><a href=\"/#" + t.Name + "\">powrót</a> <a href=\"\">odśwież</a><h3>" + t.Name + "</h3>")
+	toSend.WriteString("<!DOCTYPE html>\n<html><style>" + mainCSS + "</style><script>" + tagJS + "</script><title>" + t.Name + "</title><a href=\"/#" + t.Name + "\">powrót</a> <a href=\"\">odśwież</a> <a href=\"?history\">historia</a><h3>" + t.Name + "</h3>")
 	if t.Type > TypeStructHead {
 		if t.Dim[0] > 0 {
 			toSend.WriteString("<h4>" + t.TypeString() + t.DimString() + "</h4><table><tr><th>N</th><th>Nazwa</th><th>Typ</th><th>Wartość</th></tr>")
@@ -313,6 +343,14 @@ func tagToHTML(t *Tag) string {
 		fmt.Fprintf(&toSend, "<td></td><td></td><td></td><td>%s</td></tr>\n", hexTr(ln))
 	}
 
+	if t.boolArray() {
+		for n, b := range t.DataBOOL() {
+			fmt.Fprintf(&toSend, "<tr><td>%d</td><td onclick=clicBOOL(event) class=clic tag='%s'>%v</td></tr>\n", n, t.PathString(n), iif(b, "1", "0"))
+		}
+		toSend.WriteString("</table></html>")
+		return toSend.String()
+	}
+
 	n := 0
 	for i := 0; i < len(t.data); i += ln {
 		tmp := int64(t.data[i])
@@ -395,45 +433,42 @@ func (p *PLC) handler(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "image/vnd.microsoft.icon")
 		w.Header().Set("X-Content-Type-Options", "nosniff")
 		w.Write(p.favicon)
+	} else if r.URL.Path == "/metrics" {
+		p.metricsHTTP(w, r)
+	} else if r.URL.Path == "/api/v1/events" {
+		p.eventsHTTP(w, r)
+	} else if r.URL.Path == "/api/v1/faults" {
+		p.faultsHTTP(w, r)
+	} else if strings.HasPrefix(r.URL.Path, "/api/") {
+		p.apiHTTP(w, r)
 	} else if r.URL.Path == "/.tagSet" && r.Method == http.MethodPost {
 		w.Header().Set("Cache-Control", "no-store")
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		w.Header().Set("X-Content-Type-Options", "nosniff")
 
-		b, err := io.ReadAll(r.Body)
+		status, err := p.tagSet(r)
 		if err != nil {
-			http.Error(w, "tagSet error", http.StatusBadRequest)
+			w.WriteHeader(status)
+			io.WriteString(w, err.Error())
 			return
 		}
-		ps := string(b)
-		ind := strings.Index(ps, "=")
-		name := strings.TrimSpace(ps[:ind])
-		pth := parsePath(name)
-
-		val := strings.FieldsFunc(strings.TrimSpace(ps[ind+1:]), func(r rune) bool { return r == ',' })
-		arr := make([]byte, len(val))
-
-		for i, s := range val {
-			x, _ := strconv.Atoi(strings.TrimSpace(s))
-			arr[i] = byte(x)
-		}
-
-		ok := p.saveTag(pth, 0, 0, arr, 0)
-
-		if ok {
-			io.WriteString(w, "ok")
-		} else {
-			io.WriteString(w, "fail")
-		}
-		// fmt.Println(ps, pth, ok, len(arr))
+		io.WriteString(w, "ok")
+	} else if _, ok := r.URL.Query()["history"]; ok {
+		p.historyHTTP(w, r, path.Base(r.URL.Path))
 	} else {
 		p.tMut.RLock()
 		t, ok := p.tags[strings.ToLower(path.Base(r.URL.Path))]
-		if ok {
+		if ok && !p.allowed(r, t, false) {
+			p.tMut.RUnlock()
+			http.Error(w, "forbidden", http.StatusForbidden)
+		} else if ok {
 			_, json := r.URL.Query()["json"]
 			if json {
-				str := tagToJSON(t)
+				str, err := tagToJSON(t)
 				p.tMut.RUnlock()
+				if err != nil {
+					p.log(LogWarn, "tag JSON", "tag", t.Name, "err", err)
+				}
 				w.Header().Set("Cache-Control", "no-store")
 				w.Header().Set("Content-Type", "application/json; charset=utf-8")
 				w.Header().Set("X-Content-Type-Options", "nosniff")
@@ -457,28 +492,199 @@ func (p *PLC) handler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-var server *http.Server
+// tagSet writes raw bytes given as "path = b1,b2,...". For BOOL the value is 0 or 1.
+func (p *PLC) tagSet(r *http.Request) (int, error) {
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	ps := string(b)
+	ind := strings.Index(ps, "=")
+	if ind == -1 {
+		return http.StatusBadRequest, errors.New("expected path = value")
+	}
+	name := strings.TrimSpace(ps[:ind])
+	pth := parsePath(name)
+	if pth == nil {
+		return http.StatusBadRequest, errors.New("invalid path " + name)
+	}
+	val := strings.FieldsFunc(strings.TrimSpace(ps[ind+1:]), func(r rune) bool { return r == ',' })
+	arr := make([]byte, len(val))
+	for i, s := range val {
+		x, err := strconv.ParseUint(strings.TrimSpace(s), 10, 8)
+		if err != nil {
+			return http.StatusBadRequest, errors.New("invalid byte " + s)
+		}
+		arr[i] = byte(x)
+	}
+	return p.writePath(r, pth, name, strings.TrimSpace(ps[ind+1:]), func(t Tag, data []uint8, bit int) error {
+		if bit >= 0 {
+			if len(arr) != 1 || arr[0] > 1 {
+				return errors.New("BOOL value expected")
+			}
+			data[0] = data[0]&^(1<<uint(bit)) | arr[0]<<uint(bit)
+			return nil
+		}
+		if len(arr) == 0 || len(arr) > len(data) {
+			return errors.New("invalid data length")
+		}
+		copy(data, arr)
+		return nil
+	})
+}
+
+type historyJSON struct {
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+	Data   rxBytes   `json:"data"`
+	Value  []float64 `json:"value,omitempty"`
+}
+
+// historyHTTP sends history of the tag as HTML table, CSV (format=csv) or JSON (format=json).
+// Optional from and to are in RFC 3339 format.
+func (p *PLC) historyHTTP(w http.ResponseWriter, r *http.Request, name string) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	p.tMut.RLock()
+	tg, ok := p.tags[strings.ToLower(name)]
+	var t Tag
+	allowed := false
+	if ok {
+		t = *tg
+		allowed = p.allowed(r, tg, false)
+	}
+	p.tMut.RUnlock()
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if !allowed {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	var from, to time.Time
+	var err error
+	q := r.URL.Query()
+	if v := q.Get("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "invalid from", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "invalid to", http.StatusBadRequest)
+			return
+		}
+	}
+
+	hist := p.History(name, from, to)
+	js := make([]historyJSON, len(hist))
+	for i, e := range hist {
+		js[i] = historyJSON{Time: e.Time, Source: e.Source, Data: e.Data}
+		if t.Type < TypeStructHead {
+			t.data = e.Data
+			js[i].Value, _ = tagValues(&t)
+		}
+	}
+	value := func(h historyJSON) string {
+		if h.Value == nil {
+			return hex.EncodeToString(h.Data)
+		}
+		v := make([]string, len(h.Value))
+		for i := range h.Value {
+			v[i] = strconv.FormatFloat(h.Value[i], 'g', -1, 64)
+		}
+		return strings.Join(v, " ")
+	}
+
+	switch q.Get("format") {
+	case "json":
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(js)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"time", "source", "value"})
+		for _, h := range js {
+			cw.Write([]string{h.Time.Format(time.RFC3339Nano), h.Source, value(h)})
+		}
+		cw.Flush()
+	default:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		var b strings.Builder
+		b.WriteString("<!DOCTYPE html>\n<html><style>" + mainCSS + "</style><title>" + t.Name + "</title><a href=\"/" + t.Name + "\">powrót</a> <a href=\"?history&format=csv\">CSV</a> <a href=\"?history&format=json\">JSON</a><h3>" + t.Name + " – historia</h3>")
+		b.WriteString("<table><tr><th>Czas</th><th>Źródło</th><th>Wartość</th></tr>\n")
+		for i := len(js) - 1; i >= 0; i-- {
+			fmt.Fprintf(&b, "<tr><td>%s</td><td>%s</td><td>%s</td></tr>\n", js[i].Time.Format("2006-01-02 15:04:05.000"), js[i].Source, value(js[i]))
+		}
+		b.WriteString("</table></html>")
+		io.WriteString(w, b.String())
+	}
+}
+
+// Handler returns HTTP handler of the web interface and REST API, for use in own server.
+// Paths are absolute, so it must be mounted at root.
+func (p *PLC) Handler() http.Handler {
+	return p.withAuth(p.handler)
+}
+
+func (p *PLC) addServer(host string) *http.Server {
+	srv := &http.Server{Addr: host, Handler: p.Handler()}
+	p.httpMut.Lock()
+	p.httpSrv = append(p.httpSrv, srv)
+	p.httpMut.Unlock()
+	return srv
+}
 
 // ServeHTTP listens on the TCP network address host.
 func (p *PLC) ServeHTTP(host string) *http.Server {
-	server = &http.Server{Addr: host, Handler: http.HandlerFunc(p.handler)}
+	srv := p.addServer(host)
 	go func() {
-		err := server.ListenAndServe()
-		if err != nil {
-			fmt.Println("plcconnector ServeHTTP: ", err)
+		err := srv.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			p.log(LogError, "ServeHTTP", "addr", host, "err", err)
+		}
+	}()
+	return srv
+}
+
+// ServeHTTPS listens on the TCP network address host using TLS with certificate and key from files.
+// Client certificates are requested if HTTPAuth.ClientCAs is set.
+func (p *PLC) ServeHTTPS(host string, certFile string, keyFile string) *http.Server {
+	srv := p.addServer(host)
+	srv.TLSConfig = p.auth.TLSConfig()
+	go func() {
+		err := srv.ListenAndServeTLS(certFile, keyFile)
+		if err != nil && err != http.ErrServerClosed {
+			p.log(LogError, "ServeHTTPS", "addr", host, "err", err)
 		}
 	}()
-	return server
+	return srv
 }
 
-// CloseHTTP shutdowns the HTTP server
+// CloseHTTP shutdowns HTTP servers started by ServeHTTP and ServeHTTPS.
 func (p *PLC) CloseHTTP() error {
+	p.httpMut.Lock()
+	srvs := p.httpSrv
+	p.httpSrv = nil
+	for ws := range p.wsConns { // hijacked, not closed by Shutdown
+		ws.Close()
+	}
+	p.httpMut.Unlock()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 	var err error
-	if err = server.Shutdown(ctx); err != nil {
-		fmt.Println("plcconnector CloseHTTP: ", err)
+	for _, srv := range srvs {
+		if e := srv.Shutdown(ctx); e != nil {
+			p.log(LogError, "CloseHTTP", "addr", srv.Addr, "err", e)
+			if err == nil {
+				err = e
+			}
+		}
 	}
-	p.debug("server.Shutdown")
+	p.log(LogDebug, "HTTP server shutdown")
 	return err
 }
@@ -0,0 +1,119 @@
+package plcconnector
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func writeCert(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kb, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, keyf := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyf, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kb}), 0600)
+	return cert, keyf
+}
+
+func get(c *http.Client, url string) (string, error) {
+	var err error
+	for i := 0; i < 50; i++ {
+		var resp *http.Response
+		resp, err = c.Get(url)
+		if err == nil {
+			b, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return string(b), nil
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return "", err
+}
+
+func TestServeHTTP(t *testing.T) {
+	plc := func(name string) *PLC {
+		p, err := Init(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.NewTag(int16(1), name)
+		return p
+	}
+	p1, p2 := plc("one"), plc("two")
+	a1, a2, a3 := freeAddr(t), freeAddr(t), freeAddr(t)
+	p1.ServeHTTP(a1)
+	p2.ServeHTTP(a2)
+	cert, key := writeCert(t, t.TempDir())
+	p2.ServeHTTPS(a3, cert, key)
+
+	tc := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	for _, tt := range []struct {
+		c    *http.Client
+		url  string
+		want string
+	}{
+		{http.DefaultClient, "http://" + a1 + "/api/v1/tags", `"one"`},
+		{http.DefaultClient, "http://" + a2 + "/api/v1/tags", `"two"`},
+		{tc, "https://" + a3 + "/api/v1/tags", `"two"`},
+	} {
+		body, err := get(tt.c, tt.url)
+		if err != nil || !strings.Contains(body, tt.want) {
+			t.Errorf("%s = %s, %v", tt.url, body, err)
+		}
+	}
+
+	if err := p1.CloseHTTP(); err != nil {
+		t.Error(err)
+	}
+	if _, err := http.Get("http://" + a1 + "/"); err == nil {
+		t.Error("server one still running")
+	}
+	if body, err := get(http.DefaultClient, "http://"+a2+"/api/v1/tags"); err != nil || !strings.Contains(body, `"two"`) {
+		t.Errorf("server two: %s, %v", body, err)
+	}
+	if err := p2.CloseHTTP(); err != nil {
+		t.Error(err)
+	}
+	if _, err := tc.Get("https://" + a3 + "/"); err == nil {
+		t.Error("HTTPS server still running")
+	}
+}
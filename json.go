@@ -3,8 +3,9 @@ package plcconnector
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -16,6 +17,8 @@ type jsSymbols struct {
 	TypeInt  int    `json:"type_int"`
 	TypeSize int    `json:"type_size"`
 	Dim      []int  `json:"dim"`
+	PPD      uint8  `json:"ppd,omitempty"`
+	Alias    string `json:"alias,omitempty"` // target of alias tag
 }
 
 type jsMember struct {
@@ -28,9 +31,10 @@ type jsMember struct {
 }
 
 type jsTemplates struct {
-	Handle int        `json:"handle"`
-	Size   int        `json:"size"`
-	Member []jsMember `json:"member"`
+	Instance int        `json:"instance,omitempty"`
+	Handle   int        `json:"handle"`
+	Size     int        `json:"size"`
+	Member   []jsMember `json:"member"`
 }
 
 // JS .
@@ -48,37 +52,51 @@ func (p *PLC) UseSymbols(symbols string) error {
 		return err
 	}
 
-	tt := db.Templates
-	for len(tt) > 0 {
-		newtt := make(map[string]jsTemplates)
-		for name, t := range tt {
-			var tmpl []udtT
-			sis := false
-			for _, m := range t.Member {
-				var tx udtT
-				tx.N = m.Name
-				tx.T = m.Type
-				tx.C = m.Size
-				tx.O = m.Offset
-				if m.TypeInt > TypeStruct {
-					_, ok := p.tids[m.Type]
-					if !ok {
-						sis = true
-						break
-					}
+	var defs []udtDef
+	for name, t := range db.Templates {
+		d := udtDef{n: name, h: t.Handle, l: t.Size, i: t.Instance}
+		for _, m := range t.Member {
+			var tx udtT
+			tx.N = m.Name
+			tx.T = m.Type
+			tx.C = m.Size
+			tx.O = m.Offset
+			if m.Type == "BOOL" {
+				if m.TypeInt&TypeArray3D == 0 {
+					tx.T = "BIT" // size is bit number
+				} else {
+					tx.C = m.Size * 32 // size in DWORDs
 				}
-				tmpl = append(tmpl, tx)
-			}
-			if sis {
-				newtt[name] = t
-			} else {
-				p.newUDT(tmpl, name, t.Handle, t.Size)
 			}
+			d.u = append(d.u, tx)
 		}
-		tt = newtt
+		defs = append(defs, d)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].i < defs[j].i })
+	if d, err := p.newUDTs(defs); err != nil {
+		return errors.New(d.n + ": " + err.Error())
 	}
 
-	for name, s := range db.Symbols {
+	// controller scope tags first, programs take the next free symbol instances
+	names := make([]string, 0, len(db.Symbols))
+	for name := range db.Symbols {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		pi, _ := splitScope(strings.ToLower(names[i]))
+		pj, _ := splitScope(strings.ToLower(names[j]))
+		if (pi == "") != (pj == "") {
+			return pi == ""
+		}
+		return names[i] < names[j]
+	})
+	var aliases []aliasDef
+	for _, name := range names {
+		s := db.Symbols[name]
+		if s.Alias != "" {
+			aliases = append(aliases, aliasDef{name: name, target: s.Alias, inst: s.Instance})
+			continue
+		}
 		var tag Tag
 		if len(s.Dim) != 3 {
 			return errors.New("dim.length != 3")
@@ -87,13 +105,20 @@ func (p *PLC) UseSymbols(symbols string) error {
 		tag.Dim[1] = s.Dim[1]
 		tag.Dim[2] = s.Dim[2]
 		tag.Name = name
+		tag.prot = s.PPD
 		if s.TypeInt < TypeStruct {
 			tag.Type = s.TypeInt & TypeType
+			if s.Type == "BOOL" {
+				tag.Type = TypeBOOL
+			}
 			tag.data = make([]uint8, s.TypeSize*tag.Dims())
+			if tag.boolArray() {
+				tag.data = nil
+			}
 		} else {
 			st, ok := p.tids[s.Type]
 			if !ok {
-				panic("symbols " + s.Type)
+				return errors.New("unknown type " + s.Type + " of " + name)
 			}
 			tag.st = &st
 			tag.Type = int(st.h) | TypeStructHead
@@ -101,6 +126,7 @@ func (p *PLC) UseSymbols(symbols string) error {
 		}
 		p.addTag(tag, s.Instance)
 	}
+	p.addAliases(aliases)
 
 	in := p.Class[0xAC].inst[1]
 	in.SetAttrINT(1, int16(db.AC[0]))
@@ -113,6 +139,89 @@ func (p *PLC) UseSymbols(symbols string) error {
 	return nil
 }
 
+// ExportSymbols returns symbols and templates in the format of UseSymbols.
+func (p *PLC) ExportSymbols() (string, error) {
+	var db JS
+	in := p.Class[0xAC].inst[1]
+	db.AC[0] = int(in.attr[1].DataINT()[0])
+	db.AC[1] = int(in.attr[2].DataINT()[0])
+	db.AC[2] = int(in.attr[3].DataDINT()[0])
+	db.AC[3] = int(in.attr[4].DataDINT()[0])
+	db.AC[4] = int(in.attr[10].DataDINT()[0])
+
+	p.tMut.RLock()
+	defer p.tMut.RUnlock()
+
+	db.Templates = make(map[string]jsTemplates)
+	for name, st := range p.tids {
+		t := jsTemplates{Instance: st.i, Handle: int(st.h), Size: st.l, Member: []jsMember{}}
+		for _, x := range st.d {
+			m := jsMember{Name: x.Name, Offset: x.offset, TypeSize: x.ElemLen()}
+			switch {
+			case x.boolArray():
+				m.Type = "BOOL"
+				m.TypeInt = TypeArray1D | TypeDWORD
+				m.Size = x.Dim[0] / 32
+			case x.BasicType() == TypeBOOL:
+				m.Type = "BOOL"
+				m.TypeInt = TypeBOOL
+				m.Size = x.bit
+			case x.Type >= TypeStructHead:
+				m.Type = x.st.n
+				m.TypeInt = TypeStruct | x.st.i
+				m.Size = x.Dim[0]
+			default:
+				m.Type = typeToString(x.BasicType())
+				m.TypeInt = x.Type
+				if x.Dim[0] > 0 {
+					m.Size = x.Dims()
+					m.TypeInt = x.BasicType() | TypeArray1D
+				}
+			}
+			t.Member = append(t.Member, m)
+		}
+		db.Templates[name] = t
+	}
+
+	inst := make(map[*Instance]int)
+	for i, x := range p.symbols.inst {
+		inst[x] = i
+	}
+	for _, pr := range p.programs {
+		for i, x := range pr.symbols.inst {
+			inst[x] = i
+		}
+	}
+	db.Symbols = make(map[string]jsSymbols)
+	for _, t := range p.tags {
+		s := jsSymbols{
+			Instance: inst[t.in],
+			Array:    t.Dim[0] > 0,
+			Struct:   t.Type >= TypeStructHead,
+			TypeSize: t.ElemLen(),
+			Dim:      []int{t.Dim[0], t.Dim[1], t.Dim[2]},
+			PPD:      t.prot,
+		}
+		if t.alias != nil {
+			s.Alias = pathString(t.alias)
+		}
+		if t.in != nil {
+			s.TypeInt = int(uint16(t.in.attr[2].DataINT()[0]))
+		}
+		if s.Struct {
+			s.Type = t.st.n
+		} else if t.boolArray() {
+			s.Type = "BOOL"
+		} else {
+			s.Type = typeToString(t.BasicType())
+		}
+		db.Symbols[t.Name] = s
+	}
+
+	b, err := json.Marshal(db)
+	return string(b), err
+}
+
 // ImportSymbols .
 func (p *PLC) ImportSymbols(file string) error {
 	data, err := os.ReadFile(file)
@@ -122,9 +231,25 @@ func (p *PLC) ImportSymbols(file string) error {
 	return p.UseSymbols(string(data))
 }
 
+// rxBytes is marshalled as array of numbers instead of base64.
+type rxBytes []uint8
+
+func (b rxBytes) MarshalJSON() ([]byte, error) {
+	buf := make([]byte, 0, 4*len(b)+2)
+	buf = append(buf, '[')
+	for i, x := range b {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = strconv.AppendUint(buf, uint64(x), 10)
+	}
+	return append(buf, ']'), nil
+}
+
 type memJS struct {
-	Rx   []uint8 `json:"rx"`
-	Read bool    `json:"read"`
+	Rx    rxBytes `json:"rx"`
+	Read  bool    `json:"read"`
+	Write bool    `json:"write,omitempty"`
 }
 
 // UseMemory .
@@ -139,15 +264,13 @@ func (p *PLC) UseMemory(memory string) error {
 		if !ok {
 			return errors.New("no tag " + n)
 		}
-		if c.Read && tag.prot == 0 {
+		if c.Read && !c.Write && tag.prot == 0 {
 			tag.prot = 2
 			tag.in.attr[10] = TagUSINT(tag.prot, "External Acces")
 		}
 		if c.Read {
 			if len(c.Rx) != len(tag.data) {
-				if p.Verbose {
-					fmt.Println("memory JSON data length mismatch", n)
-				}
+				p.log(LogWarn, "memory JSON data length mismatch", "tag", n)
 				continue
 				// return errors.New("data length mismatch " + n)
 			}
@@ -158,6 +281,22 @@ func (p *PLC) UseMemory(memory string) error {
 	return nil
 }
 
+// ExportMemory returns tags data in the format of UseMemory.
+func (p *PLC) ExportMemory() (string, error) {
+	db := make(map[string]memJS)
+	p.tMut.RLock()
+	for _, t := range p.tags {
+		if t.data == nil {
+			continue
+		}
+		db[t.Name] = memJS{Rx: append([]uint8{}, t.data...), Read: true, Write: t.prot == 0}
+	}
+	p.tMut.RUnlock()
+
+	b, err := json.Marshal(db)
+	return string(b), err
+}
+
 // ImportMemory .
 func (p *PLC) ImportMemory(file string) error {
 	data, err := os.ReadFile(file)
@@ -0,0 +1,86 @@
+package plcconnector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExportRoundTrip(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.NewUDT("DATATYPE FLAGS BOOL A; BOOL B; DINT N; BOOL C; SINT S[3]; END_DATATYPE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.NewUDT("DATATYPE NEST FLAGS F[2]; BOOL Bits[40]; LREAL X; END_DATATYPE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.CreateTag("NEST[2]", "nest"); err != nil {
+		t.Fatal(err)
+	}
+	p.NewTag([]bool{true, false, true}, "bools")
+	p.NewTag([]int16{1, -2, 3}, "ints")
+	p.NewTag("Hello", "msg")
+	p.NewTag(struct {
+		A int32
+		B float32
+	}{7, 1.5}, "gostruct")
+	p.saveTag(parsePath("nest[1].F[1].C"), TypeBOOL, 1, []uint8{1}, 0)
+	p.saveTag(parsePath("nest[1].Bits[39]"), TypeBOOL, 1, []uint8{1}, 0)
+	p.tags["ints"].prot = 2
+	for _, a := range [][2]string{{"aliasC", "nest[1].F[1].C"}, {"aliasBit", "ints[1].1"}, {"aliasOfAlias", "aliasC"}} {
+		if err = p.AddAlias(a[0], a[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sym, err := p.ExportSymbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem, err := p.ExportMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = q.UseSymbols(sym); err != nil {
+		t.Fatal(err)
+	}
+	if err = q.UseMemory(mem); err != nil {
+		t.Fatal(err)
+	}
+	sym2, _ := q.ExportSymbols()
+	mem2, _ := q.ExportMemory()
+	if sym != sym2 {
+		t.Errorf("symbols differ:\n%s\n%s", sym, sym2)
+	}
+	if mem != mem2 {
+		t.Errorf("memory differ:\n%s\n%s", mem, mem2)
+	}
+
+	for _, path := range []string{"nest[1].F[1].C", "nest[1].Bits[39]", "bools[2]", "aliasOfAlias", "aliasBit"} {
+		data, _, _, ok := q.readTag(parsePath(path), 1)
+		if !ok || !reflect.DeepEqual(data, []uint8{0xFF}) {
+			t.Errorf("readTag(%s) = %v, want 0xFF", path, data)
+		}
+	}
+	if q.tags["aliasofalias"].alias == nil {
+		t.Error("aliasOfAlias imported as tag")
+	}
+	if s, _ := q.GetString("msg"); s != "Hello" {
+		t.Errorf("GetString(msg) = %q", s)
+	}
+	if q.tags["ints"].prot != 2 || q.tags["bools"].prot != 0 {
+		t.Errorf("protection lost: ints %d, bools %d", q.tags["ints"].prot, q.tags["bools"].prot)
+	}
+	if !reflect.DeepEqual(p.template.inst[p.tids["NEST"].i].data, q.template.inst[q.tids["NEST"].i].data) {
+		t.Error("NEST template differs")
+	}
+}
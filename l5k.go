@@ -0,0 +1,972 @@
+package plcconnector
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// l5kValue is parsed L5K data value: atom or bracketed list.
+type l5kValue struct {
+	list   []l5kValue
+	atom   string
+	isList bool
+}
+
+// parseL5KData parses L5K initial value, e.g. [1,2.5,[3,4],'txt'].
+func parseL5KData(s string) (l5kValue, error) {
+	v, rest, err := parseL5KValue(strings.TrimSpace(s))
+	if err != nil {
+		return v, err
+	}
+	if strings.TrimSpace(rest) != "" {
+		return v, errors.New("unexpected " + rest)
+	}
+	return v, nil
+}
+
+func parseL5KValue(s string) (l5kValue, string, error) {
+	var v l5kValue
+	s = strings.TrimLeft(s, " \t\r\n")
+	if s == "" {
+		return v, s, errors.New("missing value")
+	}
+	switch s[0] {
+	case '[':
+		v.isList = true
+		s = s[1:]
+		for {
+			s = strings.TrimLeft(s, " \t\r\n")
+			if strings.HasPrefix(s, "]") {
+				return v, s[1:], nil
+			}
+			e, rest, err := parseL5KValue(s)
+			if err != nil {
+				return v, rest, err
+			}
+			v.list = append(v.list, e)
+			s = strings.TrimLeft(rest, " \t\r\n")
+			if strings.HasPrefix(s, ",") {
+				s = s[1:]
+			} else if !strings.HasPrefix(s, "]") {
+				return v, s, errors.New("missing ]")
+			}
+		}
+	case '\'', '"':
+		for i := 1; i < len(s); i++ {
+			if s[i] == '$' {
+				i++
+			} else if s[i] == s[0] {
+				v.atom = s[:i+1]
+				return v, s[i+1:], nil
+			}
+		}
+		return v, "", errors.New("unterminated string")
+	}
+	i := strings.IndexAny(s, ",]")
+	if i == -1 {
+		i = len(s)
+	}
+	v.atom = strings.TrimSpace(s[:i])
+	if v.atom == "" {
+		return v, s, errors.New("missing value")
+	}
+	return v, s[i:], nil
+}
+
+func isL5KString(s string) bool {
+	return len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0]
+}
+
+// unquoteL5K removes quotes and resolves $ escapes.
+func unquoteL5K(s string) (string, error) {
+	if !isL5KString(s) {
+		return "", errors.New("not a string " + s)
+	}
+	s = s[1 : len(s)-1]
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'L', 'l', 'N', 'n':
+			b.WriteByte('\n')
+		case 'P', 'p':
+			b.WriteByte('\f')
+		case 'R', 'r':
+			b.WriteByte('\r')
+		case 'T', 't':
+			b.WriteByte('\t')
+		default:
+			if i+1 < len(s) {
+				if x, err := strconv.ParseUint(s[i:i+2], 16, 8); err == nil {
+					b.WriteByte(byte(x))
+					i++
+					continue
+				}
+			}
+			b.WriteByte(s[i]) // $$ $' $"
+		}
+	}
+	return b.String(), nil
+}
+
+// parseL5KInt parses decimal, 16#, 8#, 2# or ASCII ('c') integer.
+func parseL5KInt(s string) (int64, error) {
+	if isL5KString(s) {
+		u, err := unquoteL5K(s)
+		if err != nil || len(u) == 0 || len(u) > 8 {
+			return 0, errors.New("invalid value " + s)
+		}
+		var x int64
+		for i := 0; i < len(u); i++ {
+			x = x<<8 | int64(u[i])
+		}
+		return x, nil
+	}
+	s = strings.Replace(s, "_", "", -1)
+	neg := strings.HasPrefix(s, "-")
+	if neg {
+		s = s[1:]
+	}
+	base := 10
+	if i := strings.Index(s, "#"); i != -1 {
+		b, err := strconv.Atoi(s[:i])
+		if err != nil {
+			return 0, errors.New("invalid value " + s)
+		}
+		base = b
+		s = s[i+1:]
+	}
+	u, err := strconv.ParseUint(s, base, 64)
+	if err != nil {
+		f, ferr := strconv.ParseFloat(s, 64)
+		if base != 10 || ferr != nil {
+			return 0, errors.New("invalid value " + s)
+		}
+		u = uint64(f)
+	}
+	if neg {
+		return -int64(u), nil
+	}
+	return int64(u), nil
+}
+
+// parseL5KFloat parses REAL value including 1.#QNAN and 1.#INF.
+func parseL5KFloat(s string) (float64, error) {
+	s = strings.Replace(s, "_", "", -1)
+	switch {
+	case strings.Contains(s, "#QNAN") || strings.Contains(s, "#SNAN") || strings.Contains(s, "#IND"):
+		return math.NaN(), nil
+	case strings.HasPrefix(s, "-") && strings.Contains(s, "#INF"):
+		return math.Inf(-1), nil
+	case strings.Contains(s, "#INF"):
+		return math.Inf(1), nil
+	case strings.Contains(s, "#"):
+		i, err := parseL5KInt(s)
+		return float64(i), err
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, errors.New("invalid value " + s)
+	}
+	return f, nil
+}
+
+// setL5KValue writes atom v of basic type typ to data. bit -1 means BOOL tag, otherwise bit of data[0].
+func setL5KValue(data []uint8, typ int, bit int, v string) error {
+	if typ == TypeREAL || typ == TypeLREAL {
+		f, err := parseL5KFloat(v)
+		if err != nil {
+			return err
+		}
+		if typ == TypeREAL {
+			binary.LittleEndian.PutUint32(data, math.Float32bits(float32(f)))
+		} else {
+			binary.LittleEndian.PutUint64(data, math.Float64bits(f))
+		}
+		return nil
+	}
+	i, err := parseL5KInt(v)
+	if err != nil {
+		return err
+	}
+	switch typeLen(uint16(typ)) {
+	case 1:
+		if typ != TypeBOOL {
+			data[0] = uint8(i)
+		} else if bit == -1 {
+			data[0] = 0
+			if i != 0 {
+				data[0] = 0xFF
+			}
+		} else if i != 0 {
+			data[0] |= 1 << uint(bit)
+		} else {
+			data[0] &^= 1 << uint(bit)
+		}
+	case 2:
+		binary.LittleEndian.PutUint16(data, uint16(i))
+	case 4:
+		binary.LittleEndian.PutUint32(data, uint32(i))
+	case 8:
+		binary.LittleEndian.PutUint64(data, uint64(i))
+	default:
+		return errors.New("unsupported type " + typeToString(typ))
+	}
+	return nil
+}
+
+// flattenL5K returns list of n array elements.
+func flattenL5K(v l5kValue, n int) []l5kValue {
+	l := v.list
+	for len(l) != n {
+		var f []l5kValue
+		for _, e := range l {
+			if !e.isList {
+				return l
+			}
+			f = append(f, e.list...)
+		}
+		if len(f) == len(l) {
+			return l
+		}
+		l = f
+	}
+	return l
+}
+
+// assignL5K writes value v to data of tag or struct member t.
+func assignL5K(data []uint8, t *Tag, v l5kValue, member bool) error {
+	if t.Dim[0] > 0 {
+		n := t.Dims()
+		if !v.isList {
+			if t.BasicType() == TypeSINT && isL5KString(v.atom) {
+				u, err := unquoteL5K(v.atom)
+				if err != nil {
+					return err
+				}
+				if len(u) > n {
+					return errors.New("string too long for " + t.Name)
+				}
+				copy(data, u)
+				return nil
+			}
+			return errors.New("array value expected for " + t.Name)
+		}
+		l := flattenL5K(v, n)
+		if t.boolArray() && len(l) == t.dataLen()/4 && len(l) != n {
+			for i := range l {
+				err := setL5KValue(data[i*4:], TypeDINT, 0, l[i].atom) // packed DWORDs
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if len(l) > n {
+			return errors.New("too many values for " + t.Name)
+		}
+		e := *t
+		e.Dim = [3]int{}
+		if e.Type < TypeStructHead {
+			e.Type &^= TypeArray3D
+		}
+		el := e.ElemLen()
+		for i := range l {
+			var err error
+			if t.boolArray() {
+				err = setL5KValue(data[i/8:], TypeBOOL, i%8, l[i].atom)
+			} else {
+				err = assignL5K(data[i*el:], &e, l[i], false)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if t.Type >= TypeStructHead && t.st != nil {
+		st := t.st
+		if !v.isList {
+			if st.isString() && isL5KString(v.atom) {
+				u, err := unquoteL5K(v.atom)
+				if err != nil {
+					return err
+				}
+				return st.setString(data, u)
+			}
+			return errors.New("structure value expected for " + t.Name)
+		}
+		var all, noBits, noHidden []int
+		for i := range st.d {
+			all = append(all, i)
+			if st.d[i].BasicType() != TypeBOOL || st.d[i].Dim[0] > 0 {
+				noBits = append(noBits, i)
+			}
+			if !strings.HasPrefix(st.d[i].Name, "ZZZZZZZZZZ") {
+				noHidden = append(noHidden, i)
+			}
+		}
+		var m []int
+		switch len(v.list) {
+		case len(all):
+			m = all
+		case len(noBits):
+			m = noBits
+		case len(noHidden):
+			m = noHidden
+		default:
+			return errors.New("wrong number of values for " + st.n)
+		}
+		for i, j := range m {
+			el := &st.d[j]
+			err := assignL5K(data[el.offset:], el, v.list[i], true)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if v.isList {
+		return errors.New("scalar value expected for " + t.Name)
+	}
+	bit := -1
+	if member {
+		bit = t.bit
+	}
+	return setL5KValue(data, t.BasicType(), bit, v.atom)
+}
+
+// importTag creates empty tag of named data type.
+func (p *PLC) importTag(name string, dataType string, dim [3]int, access string) (Tag, error) {
+	var t Tag
+	t.Name = name
+	t.Dim = dim
+	t.Type = p.stringToType(dataType)
+	if t.Type == 0 {
+		return t, errors.New(name + ": unknown type " + dataType)
+	}
+	if t.Type >= TypeStructHead {
+		st := p.tids[dataType]
+		t.st = &st
+	}
+	if t.boolArray() {
+		t.Dim[0] = (t.Dim[0] + 31) &^ 31
+	}
+	t.data = make([]uint8, t.dataLen())
+	switch strings.ToLower(access) {
+	case "read only":
+		t.prot = 2
+	case "none":
+		t.prot = 3
+	}
+	return t, nil
+}
+
+// l5kStmt is single L5K statement with its line number.
+type l5kStmt struct {
+	line int
+	text string
+}
+
+// l5kBlocks are keywords starting L5K blocks, which are terminated by the end of line.
+var l5kBlocks = map[string]bool{
+	"CONTROLLER":                    true,
+	"DATATYPE":                      true,
+	"ADD_ON_INSTRUCTION_DEFINITION": true,
+	"PARAMETERS":                    true,
+	"LOCAL_TAGS":                    true,
+	"TAG":                           true,
+	"PROGRAM":                       true,
+	"MODULE":                        true,
+	"TASK":                          true,
+	"ROUTINE":                       true,
+	"FBD_ROUTINE":                   true,
+	"SFC_ROUTINE":                   true,
+	"ST_ROUTINE":                    true,
+	"CONFIG":                        true,
+	"TREND":                         true,
+	"QUICK_WATCH":                   true,
+	"MOTION_GROUP":                  true,
+	"AXIS":                          true,
+	"COORDINATE_SYSTEM":             true,
+	"PRIMARY_MODULE":                true,
+	"CONNECTION":                    true,
+	"SHEET":                         true,
+	"STEP":                          true,
+	"TRANSITION":                    true,
+	"ENCODED_DATA":                  true,
+}
+
+func l5kKeyword(s string) string {
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return !(r == '_' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	})
+	if i == -1 {
+		i = len(s)
+	}
+	return s[:i]
+}
+
+func l5kBlock(s string) bool {
+	k := l5kKeyword(s)
+	return l5kBlocks[k] || strings.HasPrefix(k, "END_")
+}
+
+// scanL5K splits L5K text into statements terminated by ; or by the end of block line. Comments are removed.
+func scanL5K(s string) ([]l5kStmt, error) {
+	var (
+		st    []l5kStmt
+		cur   strings.Builder
+		line  = 1
+		start = 1
+		depth int
+		quote byte
+	)
+	end := func() {
+		t := strings.TrimSpace(cur.String())
+		if t != "" {
+			st = append(st, l5kStmt{line: start, text: t})
+		}
+		cur.Reset()
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if strings.TrimSpace(cur.String()) == "" {
+			start = line
+		}
+		if quote != 0 {
+			switch {
+			case c == '\n':
+				quote = 0 // strings do not span lines
+				line++
+			case c == '$' && i+1 < len(s) && s[i+1] != '\n':
+				cur.WriteByte(c)
+				i++
+				c = s[i]
+			case c == quote:
+				quote = 0
+			}
+			cur.WriteByte(c)
+			continue
+		}
+		switch c {
+		case '(':
+			if i+1 < len(s) && s[i+1] == '*' {
+				j := strings.Index(s[i+2:], "*)")
+				if j == -1 {
+					return nil, fmt.Errorf("line %d: unterminated comment", line)
+				}
+				line += strings.Count(s[i:i+2+j], "\n")
+				i += j + 3
+				cur.WriteByte(' ')
+				continue
+			}
+			depth++
+		case ')', ']':
+			if depth > 0 {
+				depth--
+			}
+		case '[':
+			depth++
+		case '\'', '"':
+			quote = c
+		case ';':
+			if depth == 0 {
+				end()
+				continue
+			}
+		case '\n':
+			if depth == 0 && l5kBlock(strings.TrimSpace(cur.String())) {
+				end()
+			}
+			line++
+		}
+		cur.WriteByte(c)
+	}
+	end()
+	return st, nil
+}
+
+// splitL5K splits statement at first top level occurrence of sep.
+func splitL5K(s string, sep string) (string, string, bool) {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '$' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case depth == 0 && strings.HasPrefix(s[i:], sep):
+			return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+len(sep):]), true
+		}
+	}
+	return strings.TrimSpace(s), "", false
+}
+
+// l5kClose returns index of parenthesis closing the one at s[i] or -1.
+func l5kClose(s string, i int) int {
+	depth := 0
+	var quote byte
+	for ; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '$' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// l5kAttrs removes attribute list (a := b, ...) from statement and returns attributes with lower case names.
+func l5kAttrs(s string) (string, map[string]string, string, error) {
+	attrs := make(map[string]string)
+	i := strings.IndexByte(s, '(')
+	if i == -1 {
+		return strings.TrimSpace(s), attrs, "", nil
+	}
+	j := l5kClose(s, i)
+	if j == -1 {
+		return "", nil, "", errors.New("missing )")
+	}
+	in := strings.TrimSpace(s[i+1 : j])
+	for in != "" {
+		var a string
+		a, in, _ = splitL5K(in, ",")
+		k, v, ok := splitL5K(a, ":=")
+		if !ok {
+			return "", nil, "", errors.New("invalid attribute " + a)
+		}
+		if isL5KString(v) && v[0] == '"' {
+			v, _ = unquoteL5K(v)
+		}
+		attrs[strings.ToLower(k)] = v
+	}
+	return strings.TrimSpace(s[:i]), attrs, strings.TrimSpace(s[j+1:]), nil
+}
+
+// l5kName splits name[1,2,3] into name and dimensions.
+func l5kName(s string) (string, [3]int, error) {
+	var d [3]int
+	s = strings.TrimSpace(s)
+	i := strings.IndexByte(s, '[')
+	if i == -1 {
+		return s, d, nil
+	}
+	if !strings.HasSuffix(s, "]") {
+		return "", d, errors.New("invalid dimensions " + s)
+	}
+	f := strings.Split(s[i+1:len(s)-1], ",")
+	if len(f) > 3 {
+		return "", d, errors.New("too many dimensions " + s)
+	}
+	for j := range f {
+		x, err := strconv.Atoi(strings.TrimSpace(f[j]))
+		if err != nil || x < 0 {
+			return "", d, errors.New("invalid dimensions " + s)
+		}
+		d[j] = x
+	}
+	return strings.TrimSpace(s[:i]), d, nil
+}
+
+// l5kMember parses DATATYPE member: TYPE Name[n] (attrs) or BIT Name Host : n (attrs).
+func l5kMember(s string) (udtT, error) {
+	var u udtT
+	s, _, _, err := l5kAttrs(s)
+	if err != nil {
+		return u, err
+	}
+	f := strings.Fields(strings.Replace(s, ":", " : ", 1))
+	if len(f) > 1 && f[0] == "BIT" {
+		if len(f) != 5 || f[3] != ":" {
+			return u, errors.New("invalid BIT member " + s)
+		}
+		n, err := strconv.Atoi(f[4])
+		if err != nil || n < 0 {
+			return u, errors.New("invalid bit number " + f[4])
+		}
+		return udtT{N: f[1], T: "BIT", C: n, H: f[2]}, nil
+	}
+	i := strings.IndexFunc(s, unicode.IsSpace)
+	if i == -1 {
+		return u, errors.New("missing member name in " + s)
+	}
+	n, d, err := l5kName(s[i:])
+	if err != nil {
+		return u, err
+	}
+	if n == "" || strings.IndexFunc(n, unicode.IsSpace) != -1 {
+		return u, errors.New("invalid member " + s)
+	}
+	return udtT{N: n, T: s[:i], C: d[0], C2: d[1], C3: d[2], O: -1}, nil
+}
+
+// l5kHeader parses block header KEYWORD Name (attrs) and returns text following it.
+func l5kHeader(s string) (string, map[string]string, string, error) {
+	s = strings.TrimSpace(s[len(l5kKeyword(s)):])
+	i := strings.IndexFunc(s, func(r rune) bool { return unicode.IsSpace(r) || r == '(' })
+	if i == -1 {
+		return s, map[string]string{}, "", nil
+	}
+	name := s[:i]
+	s = strings.TrimSpace(s[i:])
+	if !strings.HasPrefix(s, "(") {
+		return name, map[string]string{}, s, nil
+	}
+	_, attrs, rest, err := l5kAttrs(s)
+	return name, attrs, strings.TrimSpace(rest), err
+}
+
+type l5kTag struct {
+	line  int
+	name  string
+	typ   string
+	dim   [3]int
+	attrs map[string]string
+	value string
+	alias string
+}
+
+// aliasDef is alias tag of imported project.
+type aliasDef struct {
+	name   string
+	target string
+	scope  string // "Program:Name." for program tags
+	line   int    // source line
+	inst   int    // symbol instance, 0 for the next free one
+}
+
+// l5kTagDecl parses Name : TYPE[n] (attrs) := value or Name OF Target (attrs).
+func l5kTagDecl(st l5kStmt) (l5kTag, error) {
+	t := l5kTag{line: st.line}
+	s, value, _ := splitL5K(st.text, ":=")
+	t.value = value
+	s, attrs, _, err := l5kAttrs(s)
+	if err != nil {
+		return t, err
+	}
+	t.attrs = attrs
+	f := strings.Fields(s)
+	if len(f) == 3 && f[1] == "OF" {
+		t.name = f[0]
+		t.alias = f[2]
+		return t, nil
+	}
+	n, typ, ok := splitL5K(s, ":")
+	if !ok || n == "" || typ == "" {
+		return t, errors.New("invalid tag declaration " + s)
+	}
+	t.name = n
+	t.typ, t.dim, err = l5kName(typ)
+	return t, err
+}
+
+// l5kReader reads L5K statements.
+type l5kReader struct {
+	st      []l5kStmt
+	i       int
+	types   []udtDef
+	tags    []l5kTag
+	aliases []aliasDef
+	progs   []string
+	name    string
+	attrs   map[string]string
+}
+
+func (r *l5kReader) errorf(line int, format string, a ...interface{}) error {
+	return fmt.Errorf("line %d: "+format, append([]interface{}{line}, a...)...)
+}
+
+// push inserts text following block header as next statement.
+func (r *l5kReader) push(line int, rest string) {
+	if rest == "" {
+		return
+	}
+	r.st = append(r.st, l5kStmt{})
+	copy(r.st[r.i+2:], r.st[r.i+1:])
+	r.st[r.i+1] = l5kStmt{line: line, text: rest}
+}
+
+// skip skips statements until END_ of the current block.
+func (r *l5kReader) skip() {
+	k := l5kKeyword(r.st[r.i].text)
+	for j := r.i + 1; j < len(r.st); j++ {
+		if l5kKeyword(r.st[j].text) == "END_"+k {
+			r.i = j
+			return
+		}
+	}
+}
+
+func (r *l5kReader) read() error {
+	for ; r.i < len(r.st); r.i++ {
+		s := r.st[r.i]
+		var err error
+		switch l5kKeyword(s.text) {
+		case "CONTROLLER":
+			var rest string
+			r.name, r.attrs, rest, err = l5kHeader(s.text)
+			r.push(s.line, rest)
+		case "DATATYPE":
+			err = r.datatype()
+		case "ADD_ON_INSTRUCTION_DEFINITION":
+			err = r.aoi()
+		case "TAG":
+			err = r.tagBlock("")
+		case "PROGRAM":
+			err = r.program()
+		case "END_CONTROLLER":
+		default:
+			if l5kBlock(s.text) && !strings.HasPrefix(s.text, "END_") {
+				r.skip()
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *l5kReader) datatype() error {
+	s := r.st[r.i]
+	name, _, rest, err := l5kHeader(s.text)
+	if err != nil {
+		return r.errorf(s.line, "%v", err)
+	}
+	if name == "" {
+		return r.errorf(s.line, "missing data type name")
+	}
+	r.push(s.line, rest)
+	d := udtDef{n: name, line: s.line}
+	for r.i++; r.i < len(r.st); r.i++ {
+		m := r.st[r.i]
+		if l5kKeyword(m.text) == "END_DATATYPE" {
+			r.push(m.line, strings.TrimSpace(m.text[len("END_DATATYPE"):]))
+			r.types = append(r.types, d)
+			return nil
+		}
+		if strings.HasPrefix(m.text, "(") {
+			continue // attributes in the next line
+		}
+		u, err := l5kMember(m.text)
+		if err != nil {
+			return r.errorf(m.line, "%v", err)
+		}
+		d.u = append(d.u, u)
+	}
+	return r.errorf(s.line, "missing END_DATATYPE for %s", name)
+}
+
+func (r *l5kReader) aoi() error {
+	s := r.st[r.i]
+	name, _, rest, err := l5kHeader(s.text)
+	if err != nil {
+		return r.errorf(s.line, "%v", err)
+	}
+	r.push(s.line, rest)
+	d := udtDef{n: name, line: s.line}
+	section := ""
+	for r.i++; r.i < len(r.st); r.i++ {
+		m := r.st[r.i]
+		k := l5kKeyword(m.text)
+		switch {
+		case k == "END_ADD_ON_INSTRUCTION_DEFINITION":
+			r.types = append(r.types, d)
+			return nil
+		case k == "PARAMETERS" || k == "LOCAL_TAGS":
+			section = k
+		case k == "END_PARAMETERS" || k == "END_LOCAL_TAGS":
+			section = ""
+		case section == "" && l5kBlock(m.text):
+			r.skip()
+		case section != "":
+			t, err := l5kTagDecl(m)
+			if err != nil {
+				return r.errorf(m.line, "%v", err)
+			}
+			if strings.EqualFold(t.attrs["usage"], "InOut") {
+				continue // passed by reference
+			}
+			d.u = append(d.u, udtT{N: t.name, T: t.typ, C: t.dim[0], C2: t.dim[1], C3: t.dim[2], O: -1})
+		}
+	}
+	return r.errorf(s.line, "missing END_ADD_ON_INSTRUCTION_DEFINITION for %s", name)
+}
+
+func (r *l5kReader) tagBlock(scope string) error {
+	s := r.st[r.i]
+	for r.i++; r.i < len(r.st); r.i++ {
+		m := r.st[r.i]
+		if l5kKeyword(m.text) == "END_TAG" {
+			return nil
+		}
+		t, err := l5kTagDecl(m)
+		if err != nil {
+			return r.errorf(m.line, "%v", err)
+		}
+		t.name = scope + t.name
+		if t.alias != "" {
+			r.aliases = append(r.aliases, aliasDef{name: t.name, target: t.alias, scope: scope, line: m.line})
+			continue
+		}
+		r.tags = append(r.tags, t)
+	}
+	return r.errorf(s.line, "missing END_TAG")
+}
+
+func (r *l5kReader) program() error {
+	s := r.st[r.i]
+	name, _, rest, err := l5kHeader(s.text)
+	if err != nil {
+		return r.errorf(s.line, "%v", err)
+	}
+	if name == "" {
+		return r.errorf(s.line, "missing program name")
+	}
+	r.progs = append(r.progs, name)
+	r.push(s.line, rest)
+	for r.i++; r.i < len(r.st); r.i++ {
+		m := r.st[r.i]
+		switch k := l5kKeyword(m.text); {
+		case k == "END_PROGRAM":
+			return nil
+		case k == "TAG":
+			err = r.tagBlock("Program:" + name + ".")
+			if err != nil {
+				return err
+			}
+		case l5kBlock(m.text):
+			r.skip()
+		}
+	}
+	return r.errorf(s.line, "missing END_PROGRAM for %s", name)
+}
+
+// addAliases adds aliases, which may refer to other aliases. Aliases of missing tags, e.g. of module I/O
+// not defined in the project, are skipped with warning.
+func (p *PLC) addAliases(aliases []aliasDef) {
+	for len(aliases) > 0 {
+		var (
+			rest []aliasDef
+			errs []error
+		)
+		for _, a := range aliases {
+			target := a.target
+			if a.scope != "" {
+				base := target
+				if i := strings.IndexAny(base, ".["); i != -1 {
+					base = base[:i]
+				}
+				p.tMut.RLock()
+				_, ok := p.tags[strings.ToLower(a.scope+base)]
+				p.tMut.RUnlock()
+				if ok {
+					target = a.scope + target
+				}
+			}
+			if err := p.addAlias(a.name, target, a.inst); err != nil {
+				rest = append(rest, a)
+				errs = append(errs, err)
+			}
+		}
+		if len(rest) == len(aliases) {
+			for i, a := range rest {
+				p.log(LogWarn, "alias skipped", "alias", a.scope+a.name, "target", a.target, "line", a.line, "err", errs[i])
+			}
+			return
+		}
+		aliases = rest
+	}
+}
+
+// UseL5K imports data types, Add-On Instructions and tags from RSLogix 5000 L5K export.
+func (p *PLC) UseL5K(l5k string) error {
+	st, err := scanL5K(l5k)
+	if err != nil {
+		return err
+	}
+	r := l5kReader{st: st}
+	err = r.read()
+	if err != nil {
+		return err
+	}
+
+	if d, err := p.newUDTs(r.types); err != nil {
+		return r.errorf(d.line, "%s: %v", d.n, err)
+	}
+	if err = p.addPrograms(r.progs); err != nil {
+		return err
+	}
+	for _, x := range r.tags {
+		t, err := p.importTag(x.name, x.typ, x.dim, x.attrs["externalaccess"])
+		if err != nil {
+			return r.errorf(x.line, "%v", err)
+		}
+		if x.value != "" {
+			v, err := parseL5KData(x.value)
+			if err == nil {
+				err = assignL5K(t.data, &t, v, false)
+			}
+			if err != nil {
+				return r.errorf(x.line, "%s: %v", x.name, err)
+			}
+		}
+		p.AddTag(t)
+	}
+	p.addAliases(r.aliases)
+
+	if r.name != "" {
+		p.Name = r.name
+	}
+	if v, ok := r.attrs["processortype"]; ok {
+		p.Class[IdentityClass].inst[1].attr[7] = TagShortString(v, "ProductName")
+	}
+	if v, err := strconv.Atoi(r.attrs["major"]); err == nil {
+		minor, _ := strconv.Atoi(r.attrs["minor"])
+		p.Class[IdentityClass].inst[1].SetAttrUINT(4, uint16(v+minor<<8))
+	}
+	return nil
+}
+
+// ImportL5K imports RSLogix 5000 L5K file.
+func (p *PLC) ImportL5K(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return p.UseL5K(string(data))
+}
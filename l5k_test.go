@@ -0,0 +1,140 @@
+package plcconnector
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testL5K = `IE_VER := 2.25;
+
+CONTROLLER Line1 (ProcessorType := "1756-L83E",
+                  Major := 32,
+                  TimeSlice := 20)
+	DATATYPE Motor (FamilyType := NoFamily)
+		SINT ZZZZZZZZZZMotor0 (Hidden := 1);
+		BIT Run ZZZZZZZZZZMotor0 : 0 (Radix := Decimal);
+		BIT Fault ZZZZZZZZZZMotor0 : 1 (Radix := Decimal);
+		REAL Speed (Description := "Speed (rpm); set by HMI",
+		            Radix := Float);
+		Sub Extra;
+	END_DATATYPE
+
+	DATATYPE Sub (FamilyType := NoFamily)
+		INT Arr[3] (Radix := Hex);
+	END_DATATYPE
+
+	DATATYPE STR10 (FamilyType := StringFamily)
+		DINT LEN;
+		SINT DATA[10] (Radix := ASCII);
+	END_DATATYPE
+
+	MODULE Local (Parent := "Local", ParentModPortId := 1)
+		ConfigData  := [0,1];
+	END_MODULE
+
+	(* comment with END_TAG; inside *)
+	TAG
+		M1 : Motor (Description := "Main motor") := [1,5.00000000e-001,[[16#1,2_0,'A']]];
+		Counts : DINT[2,3] (ExternalAccess := Read Only) := [1,2,3,4,5,6];
+		Flags : BOOL[32] := [2#1010];
+		Title : STR10 := [4,'Test$00$00$00$00$00$00'];
+		Speed OF M1.Speed (RADIX := Float);
+		Row OF Counts[1,0];
+	END_TAG
+
+	PROGRAM Main (MAIN := "MainRoutine", MODE := 0)
+		TAG
+			Step : INT := 7;
+			Local OF Step;
+		END_TAG
+
+		ROUTINE MainRoutine
+			N: XIC(M1.Run)OTE(M1.Fault);
+		END_ROUTINE
+	END_PROGRAM
+END_CONTROLLER
+`
+
+func TestL5K(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.UseL5K(testL5K)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "Line1" {
+		t.Errorf("Name = %q", p.Name)
+	}
+
+	tests := []struct {
+		path string
+		data []uint8
+	}{
+		{"M1.Run", []uint8{0xFF}},
+		{"M1.Fault", []uint8{0}},
+		{"M1.Speed", []uint8{0, 0, 0, 0x3F}},
+		{"M1.Extra.Arr[2]", []uint8{'A', 0}},
+		{"Counts[1,0]", []uint8{4, 0, 0, 0}},
+		{"Flags[3]", []uint8{0xFF}},
+		{"Flags[2]", []uint8{0}},
+		{"Speed", []uint8{0, 0, 0, 0x3F}},
+		{"Row", []uint8{4, 0, 0, 0}},
+		{"Program:Main.Step", []uint8{7, 0}},
+		{"Program:Main.Local", []uint8{7, 0}},
+	}
+	for _, tt := range tests {
+		data, _, _, ok := p.readTag(parsePath(tt.path), 1)
+		if !ok || !reflect.DeepEqual(data, tt.data) {
+			t.Errorf("readTag(%s) = %v, want %v", tt.path, data, tt.data)
+		}
+	}
+	if s, err := p.GetString("Title"); err != nil || s != "Test" {
+		t.Errorf("GetString(Title) = %q, %v", s, err)
+	}
+	if p.tags["counts"].prot != 2 {
+		t.Error("Counts should be read only")
+	}
+}
+
+func TestL5KErrors(t *testing.T) {
+	tests := []struct {
+		l5k  string
+		want string
+	}{
+		{"DATATYPE A\n\tDINT x;\n\tFOO y;\nEND_DATATYPE", "line 1: A: unknown type FOO"},
+		{"DATATYPE A\n\tDINT x;\n\tBIT b x 3;\nEND_DATATYPE", "line 3: invalid BIT member"},
+		{"TAG\n\tx : DINT;\n\ty : DINT := [1,2];\nEND_TAG", "line 3: y: scalar value expected"},
+		{"TAG\n\tx : DINT;\n", "line 1: missing END_TAG"},
+		{"(* comment\n", "line 1: unterminated comment"},
+	}
+	for _, tt := range tests {
+		p, err := Init(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = p.UseL5K(tt.l5k)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("UseL5K(%q) = %v, want %s", tt.l5k, err, tt.want)
+		}
+	}
+}
+
+func TestL5KUnresolvedAlias(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.UseL5K("TAG\n\tStart OF Local:1:I.Data.0;\n\tx : DINT;\n\ty OF x;\nEND_TAG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.tags["start"]; ok {
+		t.Error("alias of missing module tag added")
+	}
+	if _, ok := p.tags["y"]; !ok {
+		t.Error("alias y not added")
+	}
+}
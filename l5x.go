@@ -0,0 +1,297 @@
+package plcconnector
+
+import (
+	"encoding/xml"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type l5xContent struct {
+	XMLName    xml.Name      `xml:"RSLogix5000Content"`
+	Controller l5xController `xml:"Controller"`
+}
+
+type l5xController struct {
+	Name          string        `xml:"Name,attr"`
+	ProcessorType string        `xml:"ProcessorType,attr"`
+	MajorRev      int           `xml:"MajorRev,attr"`
+	MinorRev      int           `xml:"MinorRev,attr"`
+	DataTypes     []l5xDataType `xml:"DataTypes>DataType"`
+	AOIs          []l5xAOI      `xml:"AddOnInstructionDefinitions>AddOnInstructionDefinition"`
+	Tags          []l5xTag      `xml:"Tags>Tag"`
+	Programs      []l5xProgram  `xml:"Programs>Program"`
+}
+
+type l5xMember struct {
+	Name      string `xml:"Name,attr"`
+	DataType  string `xml:"DataType,attr"`
+	Dimension int    `xml:"Dimension,attr"`
+	Hidden    bool   `xml:"Hidden,attr"`
+	Target    string `xml:"Target,attr"`
+	BitNumber int    `xml:"BitNumber,attr"`
+}
+
+type l5xDataType struct {
+	Name    string      `xml:"Name,attr"`
+	Members []l5xMember `xml:"Members>Member"`
+}
+
+type l5xParameter struct {
+	Name       string `xml:"Name,attr"`
+	DataType   string `xml:"DataType,attr"`
+	Usage      string `xml:"Usage,attr"`
+	Dimensions string `xml:"Dimensions,attr"`
+}
+
+type l5xAOI struct {
+	Name       string         `xml:"Name,attr"`
+	Parameters []l5xParameter `xml:"Parameters>Parameter"`
+	LocalTags  []l5xParameter `xml:"LocalTags>LocalTag"`
+}
+
+type l5xTag struct {
+	Name           string    `xml:"Name,attr"`
+	TagType        string    `xml:"TagType,attr"`
+	DataType       string    `xml:"DataType,attr"`
+	Dimensions     string    `xml:"Dimensions,attr"`
+	AliasFor       string    `xml:"AliasFor,attr"`
+	ExternalAccess string    `xml:"ExternalAccess,attr"`
+	Data           []l5xNode `xml:"Data"`
+}
+
+type l5xProgram struct {
+	Name string   `xml:"Name,attr"`
+	Tags []l5xTag `xml:"Tags>Tag"`
+}
+
+// l5xNode is generic XML element used for Data contents.
+type l5xNode struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Content string     `xml:",chardata"`
+	Nodes   []l5xNode  `xml:",any"`
+}
+
+func (n l5xNode) attr(name string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// UseL5X imports data types, Add-On Instructions and tags from Studio 5000 L5X export.
+func (p *PLC) UseL5X(l5x string) error {
+	var db l5xContent
+	err := xml.Unmarshal([]byte(l5x), &db)
+	if err != nil {
+		return err
+	}
+	c := db.Controller
+
+	var types []udtDef
+	for _, dt := range c.DataTypes {
+		var u []udtT
+		for _, m := range dt.Members {
+			if m.DataType == "BIT" {
+				u = append(u, udtT{N: m.Name, T: "BIT", C: m.BitNumber, H: m.Target})
+			} else {
+				u = append(u, udtT{N: m.Name, T: m.DataType, C: m.Dimension, O: -1})
+			}
+		}
+		types = append(types, udtDef{n: dt.Name, u: u})
+	}
+	for _, aoi := range c.AOIs {
+		var u []udtT
+		for _, m := range append(aoi.Parameters, aoi.LocalTags...) {
+			if m.Usage == "InOut" {
+				continue // passed by reference
+			}
+			dim, err := l5xDims(m.Dimensions)
+			if err != nil {
+				return err
+			}
+			u = append(u, udtT{N: m.Name, T: m.DataType, C: dim[0], O: -1})
+		}
+		types = append(types, udtDef{n: aoi.Name, u: u})
+	}
+
+	if d, err := p.newUDTs(types); err != nil {
+		return errors.New(d.n + ": " + err.Error())
+	}
+
+	var aliases []aliasDef
+	for _, t := range c.Tags {
+		if t.TagType == "Alias" {
+			aliases = append(aliases, aliasDef{name: t.Name, target: t.AliasFor})
+			continue
+		}
+		err = p.l5xTag(t, t.Name)
+		if err != nil {
+			return err
+		}
+	}
+	for _, pr := range c.Programs {
+		if err = p.addPrograms([]string{pr.Name}); err != nil {
+			return err
+		}
+		scope := "Program:" + pr.Name + "."
+		for _, t := range pr.Tags {
+			if t.TagType == "Alias" {
+				aliases = append(aliases, aliasDef{name: scope + t.Name, target: t.AliasFor, scope: scope})
+				continue
+			}
+			err = p.l5xTag(t, scope+t.Name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	p.addAliases(aliases)
+
+	if c.Name != "" {
+		p.Name = c.Name
+	}
+	i := p.Class[IdentityClass].inst[1]
+	if c.MajorRev > 0 {
+		i.SetAttrUINT(4, uint16(c.MajorRev+c.MinorRev<<8))
+	}
+	if c.ProcessorType != "" {
+		i.attr[7] = TagShortString(c.ProcessorType, "ProductName")
+	}
+	return nil
+}
+
+// ImportL5X imports Studio 5000 L5X file.
+func (p *PLC) ImportL5X(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return p.UseL5X(string(data))
+}
+
+func l5xDims(s string) ([3]int, error) {
+	var d [3]int
+	f := strings.Fields(s)
+	if len(f) > 3 {
+		return d, errors.New("too many dimensions " + s)
+	}
+	for i := range f {
+		x, err := strconv.Atoi(f[i])
+		if err != nil {
+			return d, errors.New("invalid dimensions " + s)
+		}
+		d[i] = x
+	}
+	return d, nil
+}
+
+func (p *PLC) l5xTag(x l5xTag, name string) error {
+	dim, err := l5xDims(x.Dimensions)
+	if err != nil {
+		return errors.New(name + ": " + err.Error())
+	}
+	t, err := p.importTag(name, x.DataType, dim, x.ExternalAccess)
+	if err != nil {
+		return err
+	}
+
+	var l5k, str *l5xNode
+	for i := range x.Data {
+		d := &x.Data[i]
+		switch d.attr("Format") {
+		case "Decorated":
+			if len(d.Nodes) > 0 {
+				err = assignDecorated(t.data, &t, d.Nodes[0], false)
+				if err != nil {
+					return errors.New(name + ": " + err.Error())
+				}
+				p.AddTag(t)
+				return nil
+			}
+		case "L5K":
+			l5k = d
+		case "String":
+			str = d
+		}
+	}
+	if l5k != nil {
+		v, err := parseL5KData(l5k.Content)
+		if err == nil {
+			err = assignL5K(t.data, &t, v, false)
+		}
+		if err != nil {
+			return errors.New(name + ": " + err.Error())
+		}
+	} else if str != nil && t.st.isString() && t.Dim[0] == 0 {
+		u, err := unquoteL5K(strings.TrimSpace(str.Content))
+		if err == nil {
+			err = t.st.setString(t.data, u)
+		}
+		if err != nil {
+			return errors.New(name + ": " + err.Error())
+		}
+	}
+	p.AddTag(t)
+	return nil
+}
+
+// assignDecorated writes Decorated data n to data of tag or struct member t.
+func assignDecorated(data []uint8, t *Tag, n l5xNode, member bool) error {
+	switch n.XMLName.Local {
+	case "DataValue", "DataValueMember":
+		v := n.attr("Value")
+		if v == "" {
+			v = strings.TrimSpace(n.Content)
+		}
+		return assignL5K(data, t, l5kValue{atom: v}, member)
+	case "Structure", "StructureMember":
+		if t.st == nil {
+			return errors.New(t.Name + " is not a structure")
+		}
+		for _, c := range n.Nodes {
+			el := t.st.Elem(c.attr("Name"))
+			if el == nil {
+				return errors.New("no member " + c.attr("Name") + " in " + t.st.n)
+			}
+			err := assignDecorated(data[el.offset:], el, c, true)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case "Array", "ArrayMember":
+		e := *t
+		e.Dim = [3]int{}
+		if e.Type < TypeStructHead {
+			e.Type &^= TypeArray3D
+		}
+		el := e.ElemLen()
+		for _, c := range n.Nodes {
+			ix, err := l5xDims(strings.Replace(strings.Trim(c.attr("Index"), "[]"), ",", " ", -1))
+			if err != nil {
+				return err
+			}
+			i := (ix[0]*one(t.Dim[1])+ix[1])*one(t.Dim[2]) + ix[2]
+			if i >= t.Dims() {
+				return errors.New("index " + c.attr("Index") + " out of range for " + t.Name)
+			}
+			if t.boolArray() {
+				err = setL5KValue(data[i/8:], TypeBOOL, i%8, c.attr("Value"))
+			} else if len(c.Nodes) > 0 {
+				err = assignDecorated(data[i*el:], &e, c.Nodes[0], false)
+			} else {
+				err = assignL5K(data[i*el:], &e, l5kValue{atom: c.attr("Value")}, false)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return errors.New("unknown element " + n.XMLName.Local)
+}
@@ -0,0 +1,101 @@
+package plcconnector
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testL5X = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<RSLogix5000Content SchemaRevision="1.0" SoftwareRevision="32.00" TargetName="Line1" TargetType="Controller">
+<Controller Use="Target" Name="Line1" ProcessorType="1756-L83E" MajorRev="32" MinorRev="11">
+<DataTypes>
+<DataType Name="Motor" Family="NoFamily" Class="User">
+<Members>
+<Member Name="ZZZZZZZZZZMotor0" DataType="SINT" Dimension="0" Radix="Decimal" Hidden="true" ExternalAccess="Read/Write"/>
+<Member Name="Run" DataType="BIT" Dimension="0" Radix="Decimal" Hidden="false" Target="ZZZZZZZZZZMotor0" BitNumber="0" ExternalAccess="Read/Write"/>
+<Member Name="Fault" DataType="BIT" Dimension="0" Radix="Decimal" Hidden="false" Target="ZZZZZZZZZZMotor0" BitNumber="1" ExternalAccess="Read/Write"/>
+<Member Name="Speed" DataType="REAL" Dimension="0" Radix="Float" Hidden="false" ExternalAccess="Read/Write"/>
+<Member Name="Delay" DataType="TIMER" Dimension="0" Radix="NullType" Hidden="false" ExternalAccess="Read/Write"/>
+</Members>
+</DataType>
+</DataTypes>
+<Tags>
+<Tag Name="M1" TagType="Base" DataType="Motor" Constant="false" ExternalAccess="Read/Write">
+<Data Format="L5K"><![CDATA[[2,1.50000000e+000,[0,500,0]]]]></Data>
+</Tag>
+<Tag Name="Counts" TagType="Base" DataType="DINT" Dimensions="2 3" Radix="Decimal" Constant="false" ExternalAccess="Read Only">
+<Data Format="Decorated">
+<Array DataType="DINT" Dimensions="2,3" Radix="Decimal">
+<Element Index="[0,0]" Value="1"/><Element Index="[0,1]" Value="2"/><Element Index="[0,2]" Value="3"/>
+<Element Index="[1,0]" Value="16#10"/><Element Index="[1,1]" Value="5"/><Element Index="[1,2]" Value="6"/>
+</Array>
+</Data>
+</Tag>
+<Tag Name="Title" TagType="Base" DataType="STRING" Constant="false" ExternalAccess="Read/Write">
+<Data Format="String" Length="5"><![CDATA['Hello']]></Data>
+</Tag>
+<Tag Name="Ref" TagType="Alias" AliasFor="M1.Speed" ExternalAccess="Read/Write"/>
+<Tag Name="Start" TagType="Alias" AliasFor="Local:1:I.Data.0" ExternalAccess="Read/Write"/>
+</Tags>
+<Programs>
+<Program Name="Main">
+<Tags>
+<Tag Name="Step" TagType="Base" DataType="INT" Radix="Decimal" Constant="false" ExternalAccess="Read/Write">
+<Data Format="Decorated"><DataValue DataType="INT" Radix="Decimal" Value="7"/></Data>
+</Tag>
+</Tags>
+</Program>
+</Programs>
+</Controller>
+</RSLogix5000Content>`
+
+func TestL5X(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.UseL5X(testL5X)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.tags["start"]; ok {
+		t.Error("alias of module I/O tag not in project added")
+	}
+	if p.Name != "Line1" {
+		t.Errorf("Name = %q", p.Name)
+	}
+
+	st := p.tids["Motor"]
+	if st.l != 20 || st.Elem("Speed").offset != 4 || st.Elem("Delay").offset != 8 || st.Elem("Fault").bit != 1 {
+		t.Errorf("Motor layout: size %d, Speed %d, Delay %d", st.l, st.Elem("Speed").offset, st.Elem("Delay").offset)
+	}
+
+	tests := []struct {
+		path string
+		data []uint8
+	}{
+		{"M1.Fault", []uint8{0xFF}},
+		{"M1.Run", []uint8{0}},
+		{"M1.Speed", []uint8{0, 0, 0xC0, 0x3F}},
+		{"M1.Delay.PRE", []uint8{0xF4, 1, 0, 0}},
+		{"Counts[1,0]", []uint8{16, 0, 0, 0}},
+		{"Program:Main.Step", []uint8{7, 0}},
+	}
+	for _, tt := range tests {
+		data, _, _, ok := p.readTag(parsePath(tt.path), 1)
+		if !ok || !reflect.DeepEqual(data, tt.data) {
+			t.Errorf("readTag(%s) = %v, want %v", tt.path, data, tt.data)
+		}
+	}
+	if s, err := p.GetString("Title"); err != nil || s != "Hello" {
+		t.Errorf("GetString(Title) = %q, %v", s, err)
+	}
+	if p.tags["counts"].prot != 2 {
+		t.Error("Counts should be read only")
+	}
+	p.saveTag(parsePath("M1.Speed"), TypeREAL, 1, []uint8{0, 0, 0x20, 0x40}, 0)
+	data, typ, _, ok := p.readTag(parsePath("Ref"), 1)
+	if !ok || typ != TypeREAL || !reflect.DeepEqual(data, []uint8{0, 0, 0x20, 0x40}) {
+		t.Errorf("readTag(Ref) = %v, 0x%X, want alias of M1.Speed", data, typ)
+	}
+}
@@ -0,0 +1,132 @@
+package plcconnector
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogLevel is severity of log message.
+type LogLevel int
+
+// Log levels. LogDump is enabled by PLC.DumpNetwork and LogDebug by PLC.Verbose.
+const (
+	LogDump LogLevel = iota
+	LogDebug
+	LogInfo
+	LogWarn
+	LogError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogDump:
+		return "DUMP"
+	case LogDebug:
+		return "DEBUG"
+	case LogInfo:
+		return "INFO"
+	case LogWarn:
+		return "WARN"
+	default:
+		return "ERROR"
+	}
+}
+
+// Logger receives log messages. Fields are alternating keys and values, e.g. "remote", addr, "service", 0x4C.
+type Logger interface {
+	Log(level LogLevel, msg string, fields ...interface{})
+}
+
+type textLogger struct {
+	m   sync.Mutex
+	w   io.Writer
+	min LogLevel
+}
+
+// NewTextLogger returns Logger writing messages of level min and above to w, one per line.
+func NewTextLogger(w io.Writer, min LogLevel) Logger {
+	return &textLogger{w: w, min: min}
+}
+
+func (l *textLogger) Log(level LogLevel, msg string, fields ...interface{}) {
+	if level < l.min {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(time.Now().Format("2006-01-02T15:04:05.000Z07:00"))
+	b.WriteRune(' ')
+	b.WriteString(level.String())
+	b.WriteRune(' ')
+	b.WriteString(msg)
+	for i := 0; i < len(fields); i += 2 {
+		b.WriteRune(' ')
+		b.WriteString(fmt.Sprint(fields[i]))
+		b.WriteRune('=')
+		if i+1 < len(fields) {
+			v := fmt.Sprint(fields[i+1])
+			if v == "" || strings.ContainsAny(v, " \"=\n") {
+				v = fmt.Sprintf("%q", v)
+			}
+			b.WriteString(v)
+		}
+	}
+	b.WriteRune('\n')
+	l.m.Lock()
+	io.WriteString(l.w, b.String())
+	l.m.Unlock()
+}
+
+// stdLogger is used when Verbose or DumpNetwork is set without Logger.
+var stdLogger = NewTextLogger(os.Stdout, LogDump)
+
+// hexField is logged as hexadecimal number.
+type hexField uint32
+
+func (h hexField) String() string {
+	return fmt.Sprintf("0x%02X", uint32(h))
+}
+
+func (p *PLC) logEnabled(level LogLevel) bool {
+	if level == LogDump && !p.DumpNetwork || level == LogDebug && !p.Verbose {
+		return false
+	}
+	return p.Logger != nil || p.Verbose || p.DumpNetwork
+}
+
+func (p *PLC) log(level LogLevel, msg string, fields ...interface{}) {
+	if !p.logEnabled(level) {
+		return
+	}
+	l := p.Logger
+	if l == nil {
+		l = stdLogger
+	}
+	l.Log(level, msg, fields...)
+}
+
+// log adds remote address, session and CIP request fields.
+func (r *req) log(level LogLevel, msg string, fields ...interface{}) {
+	if !r.p.logEnabled(level) {
+		return
+	}
+	f := make([]interface{}, 0, 12+len(fields))
+	if r.remote != nil {
+		f = append(f, "remote", r.remote.String())
+	}
+	f = append(f, "session", hexField(r.encHead.SessionHandle))
+	if r.protd.Service != 0 {
+		f = append(f, "service", hexField(r.protd.Service), "class", hexField(r.class), "instance", r.instance, "attr", r.attr)
+	}
+	r.p.log(level, msg, append(f, fields...)...)
+}
+
+func (c *Client) log(level LogLevel, msg string, fields ...interface{}) {
+	if c.Logger == nil {
+		return
+	}
+	c.Logger.Log(level, msg, append([]interface{}{"remote", c.c.RemoteAddr().String(), "session", hexField(c.handle)}, fields...)...)
+}
@@ -0,0 +1,82 @@
+package plcconnector
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+type recLogger struct {
+	lines []string
+}
+
+func (l *recLogger) Log(level LogLevel, msg string, fields ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprint(level, " ", msg, fields))
+}
+
+func TestLogLevels(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		verbose, dump, logger bool
+		want                  []LogLevel
+	}{
+		{false, false, false, nil},
+		{false, false, true, []LogLevel{LogInfo, LogWarn, LogError}},
+		{true, false, true, []LogLevel{LogDebug, LogInfo, LogWarn, LogError}},
+		{true, true, true, []LogLevel{LogDump, LogDebug, LogInfo, LogWarn, LogError}},
+		{false, true, false, []LogLevel{LogDump, LogInfo, LogWarn, LogError}},
+	}
+	for _, tt := range tests {
+		p.Verbose, p.DumpNetwork = tt.verbose, tt.dump
+		p.Logger = nil
+		if tt.logger {
+			p.Logger = &recLogger{}
+		}
+		var got []LogLevel
+		for l := LogDump; l <= LogError; l++ {
+			if p.logEnabled(l) {
+				got = append(got, l)
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("verbose %v dump %v logger %v: %v, want %v", tt.verbose, tt.dump, tt.logger, got, tt.want)
+		}
+	}
+}
+
+func TestLogFields(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	p.Logger = NewTextLogger(&buf, LogInfo)
+	p.Verbose = true
+
+	r := req{p: p, remote: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}}
+	r.encHead.SessionHandle = 0x12
+	r.protd.Service = ReadTag
+	r.class, r.instance = SymbolClass, 3
+	r.log(LogDebug, "filtered by logger")
+	r.log(LogWarn, "unknown service", "status", hexField(ServNotSup), "note", "two words")
+	p.UpdateTag("nope", 0, nil)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("lines = %q", lines)
+	}
+	want := []string{
+		` WARN unknown service remote=10.0.0.1:5000 session=0x12 service=0x4C class=0x6B instance=3 attr=0 status=0x08 note="two words"`,
+		` WARN UpdateTag: no tag tag=nope`,
+	}
+	for i, w := range want {
+		if !strings.HasSuffix(lines[i], w) {
+			t.Errorf("line %d = %q, want suffix %q", i, lines[i], w)
+		}
+	}
+}
@@ -0,0 +1,953 @@
+package plcconnector
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Logic is compiled program in subset of Structured Text:
+//
+//	Motor.Running := Motor.Start AND NOT Motor.Stop;
+//	IF Tank.Level > 90.0 THEN Valve[2] := FALSE; ELSIF Tank.Level < 10 THEN Valve[2] := TRUE; END_IF;
+//
+// Operators: OR XOR AND & NOT = <> < <= > >= + - * / MOD, functions ABS MIN MAX LIMIT SQRT.
+// Numbers may be written with base, e.g. 16#FF. Integer arithmetic is 64-bit and wraps on overflow,
+// as do stores to integer tags; ULINT values above 2^63 compare as negative.
+// Tags are accessed by paths with members, array indices (which may be expressions) and bits.
+// Comments are (* ... *) and // to end of line.
+type Logic struct {
+	stmts []stStmt
+}
+
+type stKind int
+
+const (
+	stBool stKind = iota
+	stInt
+	stReal
+)
+
+// stVal is value of expression: i of BOOL and integers, f of REAL.
+type stVal struct {
+	k stKind
+	i int64
+	f float64
+}
+
+func (v stVal) bool() bool {
+	if v.k == stReal {
+		return v.f != 0
+	}
+	return v.i != 0
+}
+
+func (v stVal) float() float64 {
+	if v.k == stReal {
+		return v.f
+	}
+	return float64(v.i)
+}
+
+// int returns integer value, REAL is rounded.
+func (v stVal) int() int64 {
+	if v.k == stReal {
+		return int64(math.RoundToEven(v.f))
+	}
+	return v.i
+}
+
+func stBoolVal(b bool) stVal {
+	if b {
+		return stVal{k: stBool, i: 1}
+	}
+	return stVal{k: stBool}
+}
+
+func stIntVal(i int64) stVal {
+	return stVal{k: stInt, i: i}
+}
+
+func stRealVal(f float64) stVal {
+	return stVal{k: stReal, f: f}
+}
+
+// stCtx is state of running scan. tMut is locked by statements.
+type stCtx struct {
+	p *PLC
+}
+
+type stExpr interface {
+	eval(c *stCtx) (stVal, error)
+}
+
+type stStmt interface {
+	exec(c *stCtx) error
+}
+
+// lexer
+
+type stToken struct {
+	typ int // stIdent, stNumber, stOp
+	txt string
+	pos int
+}
+
+const (
+	stEOF = iota
+	stIdent
+	stNumber
+	stOp
+)
+
+var stOps = map[string]bool{":=": true, "<>": true, "<=": true, ">=": true, "=": true, "<": true, ">": true,
+	"+": true, "-": true, "*": true, "/": true, "(": true, ")": true, "[": true, "]": true, ",": true, ";": true, ".": true, "&": true}
+
+func stLex(src string) ([]stToken, error) {
+	var toks []stToken
+	rs := []rune(src)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' && i+1 < len(rs) && rs[i+1] == '*':
+			s := i
+			for i += 2; i+1 < len(rs) && !(rs[i] == '*' && rs[i+1] == ')'); i++ {
+			}
+			if i+1 >= len(rs) {
+				return nil, fmt.Errorf("%d: unterminated comment", s)
+			}
+			i += 2
+		case r == '/' && i+1 < len(rs) && rs[i+1] == '/':
+			for i < len(rs) && rs[i] != '\n' {
+				i++
+			}
+		case unicode.IsLetter(r) || r == '_':
+			s := i
+			for i < len(rs) && (unicode.IsLetter(rs[i]) || unicode.IsDigit(rs[i]) || rs[i] == '_' ||
+				rs[i] == ':' && i+1 < len(rs) && (unicode.IsLetter(rs[i+1]) || rs[i+1] == '_')) {
+				i++
+			}
+			toks = append(toks, stToken{stIdent, string(rs[s:i]), s})
+		case unicode.IsDigit(r):
+			s := i
+			for i < len(rs) && unicode.IsDigit(rs[i]) {
+				i++
+			}
+			if i < len(rs) && rs[i] == '#' { // 16#FF
+				for i++; i < len(rs) && (unicode.IsLetter(rs[i]) || unicode.IsDigit(rs[i]) || rs[i] == '_'); i++ {
+				}
+				toks = append(toks, stToken{stNumber, string(rs[s:i]), s})
+				break
+			}
+			if i+1 < len(rs) && rs[i] == '.' && unicode.IsDigit(rs[i+1]) && (len(toks) == 0 || toks[len(toks)-1].txt != ".") {
+				i++
+				for i < len(rs) && unicode.IsDigit(rs[i]) {
+					i++
+				}
+			}
+			if i < len(rs) && (rs[i] == 'e' || rs[i] == 'E') {
+				j := i + 1
+				if j < len(rs) && (rs[j] == '+' || rs[j] == '-') {
+					j++
+				}
+				if j < len(rs) && unicode.IsDigit(rs[j]) {
+					i = j
+					for i < len(rs) && unicode.IsDigit(rs[i]) {
+						i++
+					}
+				}
+			}
+			toks = append(toks, stToken{stNumber, string(rs[s:i]), s})
+		default:
+			op := string(r)
+			if i+1 < len(rs) {
+				switch two := string(rs[i : i+2]); two {
+				case ":=", "<>", "<=", ">=":
+					op = two
+				}
+			}
+			if !stOps[op] {
+				return nil, fmt.Errorf("%d: unexpected %q", i, r)
+			}
+			toks = append(toks, stToken{stOp, op, i})
+			i += len([]rune(op))
+		}
+	}
+	return append(toks, stToken{stEOF, "", len(rs)}), nil
+}
+
+// parser
+
+type stParser struct {
+	toks []stToken
+	i    int
+}
+
+func (ps *stParser) peek() stToken {
+	return ps.toks[ps.i]
+}
+
+func (ps *stParser) next() stToken {
+	t := ps.toks[ps.i]
+	if t.typ != stEOF {
+		ps.i++
+	}
+	return t
+}
+
+// is reports whether next token is operator or keyword s and consumes it.
+func (ps *stParser) is(s string) bool {
+	t := ps.peek()
+	if (t.typ == stOp && t.txt == s) || (t.typ == stIdent && strings.EqualFold(t.txt, s)) {
+		ps.i++
+		return true
+	}
+	return false
+}
+
+func (ps *stParser) expect(s string) error {
+	if !ps.is(s) {
+		return ps.errorf("%s expected", s)
+	}
+	return nil
+}
+
+func (ps *stParser) errorf(format string, a ...interface{}) error {
+	t := ps.peek()
+	got := t.txt
+	if t.typ == stEOF {
+		got = "end"
+	}
+	return fmt.Errorf("%d: %s, got %q", t.pos, fmt.Sprintf(format, a...), got)
+}
+
+var stKeywords = map[string]bool{"IF": true, "THEN": true, "ELSIF": true, "ELSE": true, "END_IF": true,
+	"AND": true, "OR": true, "XOR": true, "NOT": true, "MOD": true, "TRUE": true, "FALSE": true}
+
+// CompileLogic parses Structured Text program src.
+func CompileLogic(src string) (*Logic, error) {
+	toks, err := stLex(src)
+	if err != nil {
+		return nil, err
+	}
+	ps := &stParser{toks: toks}
+	stmts, err := ps.stmts()
+	if err != nil {
+		return nil, err
+	}
+	if ps.peek().typ != stEOF {
+		return nil, ps.errorf("statement expected")
+	}
+	return &Logic{stmts: stmts}, nil
+}
+
+func (ps *stParser) stmts() ([]stStmt, error) {
+	var stmts []stStmt
+	for {
+		t := ps.peek()
+		if t.typ == stEOF || t.typ == stIdent && (strings.EqualFold(t.txt, "ELSIF") || strings.EqualFold(t.txt, "ELSE") || strings.EqualFold(t.txt, "END_IF")) {
+			return stmts, nil
+		}
+		if ps.is(";") {
+			continue
+		}
+		s, err := ps.stmt()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, s)
+	}
+}
+
+func (ps *stParser) stmt() (stStmt, error) {
+	if ps.is("IF") {
+		var s stIf
+		for {
+			cond, err := ps.expr()
+			if err != nil {
+				return nil, err
+			}
+			if err = ps.expect("THEN"); err != nil {
+				return nil, err
+			}
+			body, err := ps.stmts()
+			if err != nil {
+				return nil, err
+			}
+			s.conds = append(s.conds, cond)
+			s.bodies = append(s.bodies, body)
+			if !ps.is("ELSIF") {
+				break
+			}
+		}
+		if ps.is("ELSE") {
+			body, err := ps.stmts()
+			if err != nil {
+				return nil, err
+			}
+			s.els = body
+		}
+		if err := ps.expect("END_IF"); err != nil {
+			return nil, err
+		}
+		return &s, nil
+	}
+	if t := ps.peek(); t.typ != stIdent || stKeywords[strings.ToUpper(t.txt)] {
+		return nil, ps.errorf("statement expected")
+	}
+	target, err := ps.path()
+	if err != nil {
+		return nil, err
+	}
+	if err = ps.expect(":="); err != nil {
+		return nil, err
+	}
+	e, err := ps.expr()
+	if err != nil {
+		return nil, err
+	}
+	if err = ps.expect(";"); err != nil {
+		return nil, err
+	}
+	return &stAssign{target, e}, nil
+}
+
+func (ps *stParser) binary(next func() (stExpr, error), ops ...string) (stExpr, error) {
+	l, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		for _, o := range ops {
+			if ps.is(o) {
+				op = strings.ToUpper(o)
+				break
+			}
+		}
+		if op == "" {
+			return l, nil
+		}
+		r, err := next()
+		if err != nil {
+			return nil, err
+		}
+		l = &stBinary{op, l, r}
+	}
+}
+
+func (ps *stParser) expr() (stExpr, error) {
+	return ps.binary(ps.xor, "OR")
+}
+
+func (ps *stParser) xor() (stExpr, error) {
+	return ps.binary(ps.and, "XOR")
+}
+
+func (ps *stParser) and() (stExpr, error) {
+	return ps.binary(ps.cmp, "AND", "&")
+}
+
+func (ps *stParser) cmp() (stExpr, error) {
+	return ps.binary(ps.add, "=", "<>", "<=", ">=", "<", ">")
+}
+
+func (ps *stParser) add() (stExpr, error) {
+	return ps.binary(ps.mul, "+", "-")
+}
+
+func (ps *stParser) mul() (stExpr, error) {
+	return ps.binary(ps.unary, "*", "/", "MOD")
+}
+
+func (ps *stParser) unary() (stExpr, error) {
+	for _, op := range []string{"NOT", "-"} {
+		if ps.is(op) {
+			e, err := ps.unary()
+			if err != nil {
+				return nil, err
+			}
+			return &stUnary{op, e}, nil
+		}
+	}
+	return ps.primary()
+}
+
+var stFuncs = map[string][2]int{"ABS": {1, 1}, "SQRT": {1, 1}, "MIN": {2, 2}, "MAX": {2, 2}, "LIMIT": {3, 3}}
+
+func (ps *stParser) primary() (stExpr, error) {
+	t := ps.peek()
+	switch {
+	case t.typ == stNumber && strings.Contains(t.txt, "#"):
+		ps.next()
+		n := strings.SplitN(strings.ReplaceAll(t.txt, "_", ""), "#", 2)
+		base, err := strconv.Atoi(n[0])
+		if err != nil || base < 2 || base > 36 {
+			return nil, fmt.Errorf("%d: invalid number %s", t.pos, t.txt)
+		}
+		u, err := strconv.ParseUint(n[1], base, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%d: invalid number %s", t.pos, t.txt)
+		}
+		return stLit{stIntVal(int64(u))}, nil
+	case t.typ == stNumber:
+		ps.next()
+		if !strings.ContainsAny(t.txt, ".eE") {
+			txt := strings.ReplaceAll(t.txt, "_", "")
+			if i, err := strconv.ParseInt(txt, 10, 64); err == nil {
+				return stLit{stIntVal(i)}, nil
+			}
+			if u, err := strconv.ParseUint(txt, 10, 64); err == nil {
+				return stLit{stIntVal(int64(u))}, nil
+			}
+		}
+		f, err := strconv.ParseFloat(t.txt, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%d: invalid number %s", t.pos, t.txt)
+		}
+		return stLit{stRealVal(f)}, nil
+	case ps.is("TRUE"):
+		return stLit{stBoolVal(true)}, nil
+	case ps.is("FALSE"):
+		return stLit{stBoolVal(false)}, nil
+	case ps.is("("):
+		e, err := ps.expr()
+		if err != nil {
+			return nil, err
+		}
+		return e, ps.expect(")")
+	case t.typ == stIdent && !stKeywords[strings.ToUpper(t.txt)]:
+		if n, ok := stFuncs[strings.ToUpper(t.txt)]; ok && ps.toks[ps.i+1].txt == "(" {
+			ps.i += 2
+			call := &stCall{fn: strings.ToUpper(t.txt)}
+			for !ps.is(")") {
+				if len(call.args) > 0 {
+					if err := ps.expect(","); err != nil {
+						return nil, err
+					}
+				}
+				e, err := ps.expr()
+				if err != nil {
+					return nil, err
+				}
+				call.args = append(call.args, e)
+			}
+			if len(call.args) < n[0] || len(call.args) > n[1] {
+				return nil, fmt.Errorf("%d: %s needs %d arguments", t.pos, call.fn, n[0])
+			}
+			return call, nil
+		}
+		return ps.path()
+	}
+	return nil, ps.errorf("expression expected")
+}
+
+// path parses tag path. Paths without index expressions are parsed by parsePath.
+func (ps *stParser) path() (*stPath, error) {
+	var (
+		p     = &stPath{}
+		text  strings.Builder
+		first = ps.next()
+	)
+	text.WriteString(first.txt)
+	static := true
+	p.els = append(p.els, stPathEl{el: pathEl{typ: ansiExtended, txt: first.txt}})
+	for {
+		switch {
+		case ps.is("."):
+			t := ps.next()
+			switch t.typ {
+			case stIdent:
+				p.els = append(p.els, stPathEl{el: pathEl{typ: ansiExtended, txt: t.txt}})
+			case stNumber:
+				b, err := strconv.Atoi(t.txt)
+				if err != nil {
+					return nil, fmt.Errorf("%d: invalid bit %s", t.pos, t.txt)
+				}
+				p.els = append(p.els, stPathEl{el: pathEl{typ: pathBit, val: b}})
+			default:
+				return nil, fmt.Errorf("%d: member expected after .", t.pos)
+			}
+			text.WriteString("." + t.txt)
+		case ps.is("["):
+			text.WriteString("[")
+			for i := 0; ; i++ {
+				e, err := ps.expr()
+				if err != nil {
+					return nil, err
+				}
+				if l, ok := e.(stLit); ok && l.v.k != stReal {
+					p.els = append(p.els, stPathEl{el: pathEl{typ: pathMember, val: int(l.v.i)}})
+					if i > 0 {
+						text.WriteString(",")
+					}
+					text.WriteString(strconv.Itoa(int(l.v.i)))
+				} else {
+					p.els = append(p.els, stPathEl{idx: e})
+					static = false
+				}
+				if ps.is("]") {
+					break
+				}
+				if err = ps.expect(","); err != nil {
+					return nil, err
+				}
+			}
+			text.WriteString("]")
+		default:
+			p.text = text.String()
+			if static {
+				p.static = parsePath(p.text)
+				if p.static == nil {
+					return nil, fmt.Errorf("%d: invalid path %s", first.pos, p.text)
+				}
+			}
+			return p, nil
+		}
+	}
+}
+
+// nodes
+
+type stLit struct {
+	v stVal
+}
+
+func (l stLit) eval(c *stCtx) (stVal, error) {
+	return l.v, nil
+}
+
+type stPathEl struct {
+	el  pathEl
+	idx stExpr // index expression, nil if el is used
+}
+
+type stPath struct {
+	text   string
+	els    []stPathEl
+	static []pathEl
+}
+
+func (sp *stPath) resolve(c *stCtx) (tagRef, error) {
+	pth := sp.static
+	if pth == nil {
+		pth = make([]pathEl, len(sp.els))
+		for i, e := range sp.els {
+			pth[i] = e.el
+			if e.idx != nil {
+				v, err := e.idx.eval(c)
+				if err != nil {
+					return tagRef{}, err
+				}
+				pth[i] = pathEl{typ: pathMember, val: int(v.int())}
+				if v.int() < 0 {
+					return tagRef{}, errors.New("negative index in " + sp.text)
+				}
+			}
+		}
+	}
+	return c.p.resolve(pth)
+}
+
+func (sp *stPath) eval(c *stCtx) (stVal, error) {
+	ref, err := sp.resolve(c)
+	if err != nil {
+		return stVal{}, err
+	}
+	return getNumber(ref.t, ref.data(), ref.bit)
+}
+
+// getNumber reads element t of numeric or BOOL type.
+func getNumber(t Tag, data []uint8, bit int) (stVal, error) {
+	if bit >= 0 {
+		return stBoolVal(data[0]&(1<<uint(bit)) != 0), nil
+	}
+	if t.Dim[0] > 0 || t.Type >= TypeStructHead {
+		return stVal{}, errors.New("number expected, not " + t.TypeString())
+	}
+	switch t.NumType() {
+	case TypeBOOL:
+		return stBoolVal(data[0] != 0), nil
+	case TypeSINT:
+		return stIntVal(int64(int8(data[0]))), nil
+	case TypeINT:
+		return stIntVal(int64(int16(binary.LittleEndian.Uint16(data)))), nil
+	case TypeDINT:
+		return stIntVal(int64(int32(binary.LittleEndian.Uint32(data)))), nil
+	case TypeLINT, TypeULINT:
+		return stIntVal(int64(binary.LittleEndian.Uint64(data))), nil
+	case TypeUSINT:
+		return stIntVal(int64(data[0])), nil
+	case TypeUINT:
+		return stIntVal(int64(binary.LittleEndian.Uint16(data))), nil
+	case TypeUDINT:
+		return stIntVal(int64(binary.LittleEndian.Uint32(data))), nil
+	case TypeREAL:
+		return stRealVal(float64(math.Float32frombits(binary.LittleEndian.Uint32(data)))), nil
+	case TypeLREAL:
+		return stRealVal(math.Float64frombits(binary.LittleEndian.Uint64(data))), nil
+	}
+	return stVal{}, errors.New("unsupported type " + t.TypeString())
+}
+
+// putNumber stores v to element t of numeric or BOOL type. Integers are truncated to the width of t,
+// REAL is rounded and limited to its range by setNumber.
+func putNumber(t Tag, data []uint8, bit int, v stVal) error {
+	if v.k == stReal || bit >= 0 {
+		return setNumber(t, data, bit, v.float())
+	}
+	if t.Dim[0] > 0 || t.Type >= TypeStructHead {
+		return errors.New("number expected, not " + t.TypeString())
+	}
+	switch t.NumType() {
+	case TypeBOOL:
+		data[0] = boolByte(v.i != 0)
+	case TypeSINT, TypeUSINT:
+		data[0] = uint8(v.i)
+	case TypeINT, TypeUINT:
+		binary.LittleEndian.PutUint16(data, uint16(v.i))
+	case TypeDINT, TypeUDINT:
+		binary.LittleEndian.PutUint32(data, uint32(v.i))
+	case TypeLINT, TypeULINT:
+		binary.LittleEndian.PutUint64(data, uint64(v.i))
+	default:
+		return setNumber(t, data, bit, v.float())
+	}
+	return nil
+}
+
+type stUnary struct {
+	op string
+	e  stExpr
+}
+
+func (u *stUnary) eval(c *stCtx) (stVal, error) {
+	v, err := u.e.eval(c)
+	if err != nil {
+		return v, err
+	}
+	if u.op == "-" {
+		if v.k == stReal {
+			return stRealVal(-v.f), nil
+		}
+		return stIntVal(-v.i), nil
+	}
+	if v.k == stBool {
+		return stBoolVal(!v.bool()), nil
+	}
+	return stIntVal(^v.int()), nil
+}
+
+type stBinary struct {
+	op   string
+	l, r stExpr
+}
+
+func (b *stBinary) eval(c *stCtx) (stVal, error) {
+	l, err := b.l.eval(c)
+	if err != nil {
+		return l, err
+	}
+	r, err := b.r.eval(c)
+	if err != nil {
+		return r, err
+	}
+	k := stInt
+	if l.k == stReal || r.k == stReal {
+		k = stReal
+	}
+	switch b.op {
+	case "OR", "XOR", "AND", "&":
+		if l.k == stBool && r.k == stBool {
+			switch b.op {
+			case "OR":
+				return stBoolVal(l.bool() || r.bool()), nil
+			case "XOR":
+				return stBoolVal(l.bool() != r.bool()), nil
+			}
+			return stBoolVal(l.bool() && r.bool()), nil
+		}
+		if k == stReal {
+			return stVal{}, errors.New(b.op + " of REAL")
+		}
+		x, y := l.i, r.i
+		switch b.op {
+		case "OR":
+			return stIntVal(x | y), nil
+		case "XOR":
+			return stIntVal(x ^ y), nil
+		}
+		return stIntVal(x & y), nil
+	case "=", "<>", "<", "<=", ">", ">=":
+		c := 0
+		if k == stReal {
+			x, y := l.float(), r.float()
+			if x != y && !(x < y) && !(x > y) { // NaN
+				return stBoolVal(b.op == "<>"), nil
+			}
+			c = cmpFloat(x, y)
+		} else {
+			c = cmpInt(l.i, r.i)
+		}
+		switch b.op {
+		case "=":
+			return stBoolVal(c == 0), nil
+		case "<>":
+			return stBoolVal(c != 0), nil
+		case "<":
+			return stBoolVal(c < 0), nil
+		case "<=":
+			return stBoolVal(c <= 0), nil
+		case ">":
+			return stBoolVal(c > 0), nil
+		}
+		return stBoolVal(c >= 0), nil
+	}
+	if k == stReal {
+		x, y := l.float(), r.float()
+		switch b.op {
+		case "+":
+			return stRealVal(x + y), nil
+		case "-":
+			return stRealVal(x - y), nil
+		case "*":
+			return stRealVal(x * y), nil
+		case "/":
+			return stRealVal(x / y), nil
+		}
+		return stRealVal(math.Mod(x, y)), nil // MOD
+	}
+	x, y := l.i, r.i
+	switch b.op {
+	case "+":
+		return stIntVal(x + y), nil
+	case "-":
+		return stIntVal(x - y), nil
+	case "*":
+		return stIntVal(x * y), nil
+	}
+	if y == 0 {
+		return stVal{}, errors.New("division by zero")
+	}
+	if b.op == "/" {
+		return stIntVal(x / y), nil
+	}
+	return stIntVal(x % y), nil // MOD
+}
+
+func cmpInt(x, y int64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func cmpFloat(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+type stCall struct {
+	fn   string
+	args []stExpr
+}
+
+func (f *stCall) eval(c *stCtx) (stVal, error) {
+	a := make([]stVal, len(f.args))
+	k := stInt
+	for i, e := range f.args {
+		v, err := e.eval(c)
+		if err != nil {
+			return v, err
+		}
+		a[i] = v
+		if v.k == stReal {
+			k = stReal
+		}
+	}
+	if f.fn == "SQRT" {
+		return stRealVal(math.Sqrt(a[0].float())), nil
+	}
+	if k == stReal {
+		switch f.fn {
+		case "ABS":
+			return stRealVal(math.Abs(a[0].f)), nil
+		case "MIN":
+			return stRealVal(math.Min(a[0].float(), a[1].float())), nil
+		case "MAX":
+			return stRealVal(math.Max(a[0].float(), a[1].float())), nil
+		}
+		return stRealVal(math.Max(a[0].float(), math.Min(a[1].float(), a[2].float()))), nil // LIMIT(MN, IN, MX)
+	}
+	min := func(x, y int64) int64 {
+		if x < y {
+			return x
+		}
+		return y
+	}
+	max := func(x, y int64) int64 {
+		if x > y {
+			return x
+		}
+		return y
+	}
+	switch f.fn {
+	case "ABS":
+		if a[0].i < 0 {
+			return stIntVal(-a[0].i), nil
+		}
+		return stIntVal(a[0].i), nil
+	case "MIN":
+		return stIntVal(min(a[0].i, a[1].i)), nil
+	case "MAX":
+		return stIntVal(max(a[0].i, a[1].i)), nil
+	}
+	return stIntVal(max(a[0].i, min(a[1].i, a[2].i))), nil // LIMIT(MN, IN, MX)
+}
+
+type stAssign struct {
+	target *stPath
+	e      stExpr
+}
+
+func (a *stAssign) exec(c *stCtx) error {
+	c.p.tMut.Lock()
+	defer c.p.tMut.Unlock()
+	v, err := a.e.eval(c)
+	if err != nil {
+		return err
+	}
+	ref, err := a.target.resolve(c)
+	if err != nil {
+		return err
+	}
+	if ref.bit >= 0 || ref.t.NumType() == TypeBOOL && ref.t.Dim[0] == 0 {
+		v = stBoolVal(v.bool())
+	}
+	dst := ref.data()
+	buf := append([]uint8{}, dst...)
+	if err = putNumber(ref.t, buf, ref.bit, v); err != nil {
+		return errors.New(a.target.text + ": " + err.Error())
+	}
+	if string(buf) != string(dst) {
+		copy(dst, buf)
+		c.p.tagWritten(ref.tag, ref.off, buf, "Logic", WriteTag, Tag{Type: ref.t.Type})
+	}
+	return nil
+}
+
+type stIf struct {
+	conds  []stExpr
+	bodies [][]stStmt
+	els    []stStmt
+}
+
+func stExec(c *stCtx, stmts []stStmt) error {
+	for _, s := range stmts {
+		if err := s.exec(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *stIf) exec(c *stCtx) error {
+	for i, cond := range s.conds {
+		c.p.tMut.RLock()
+		v, err := cond.eval(c)
+		c.p.tMut.RUnlock()
+		if err != nil {
+			return err
+		}
+		if v.bool() {
+			return stExec(c, s.bodies[i])
+		}
+	}
+	return stExec(c, s.els)
+}
+
+// scan runs logic once. Tags are locked by each assignment and IF condition, not for the whole scan.
+func (l *Logic) scan(p *PLC) error {
+	return stExec(&stCtx{p: p}, l.stmts)
+}
+
+// RunLogic runs single scan of l. Each statement sees and writes tags atomically.
+func (p *PLC) RunLogic(l *Logic) error {
+	return l.scan(p)
+}
+
+// logicTask is running scan cycle.
+type logicTask struct {
+	m    sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// StartLogic runs programs in order every cycle, replacing previously started ones.
+// Scan stops at the first runtime error, which is logged when it differs from previous one.
+func (p *PLC) StartLogic(cycle time.Duration, programs ...*Logic) error {
+	if cycle <= 0 {
+		return errors.New("logic cycle must be positive")
+	}
+	p.StopLogic()
+	stop, done := make(chan struct{}), make(chan struct{})
+	p.logic.m.Lock()
+	p.logic.stop, p.logic.done = stop, done
+	p.logic.m.Unlock()
+	go func() {
+		defer close(done)
+		t := time.NewTicker(cycle)
+		defer t.Stop()
+		last := ""
+		for {
+			var err error
+			for _, l := range programs {
+				if err = l.scan(p); err != nil {
+					break
+				}
+			}
+			msg := ""
+			if err != nil {
+				msg = err.Error()
+			}
+			if msg != last && msg != "" {
+				p.log(LogWarn, "logic", "err", msg)
+			}
+			last = msg
+			select {
+			case <-t.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// StopLogic stops scan cycle started by StartLogic and waits for the running scan.
+func (p *PLC) StopLogic() {
+	p.logic.m.Lock()
+	stop, done := p.logic.stop, p.logic.done
+	p.logic.stop, p.logic.done = nil, nil
+	p.logic.m.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
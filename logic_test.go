@@ -0,0 +1,195 @@
+package plcconnector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLogic(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.NewUDT("DATATYPE MOTOR BOOL Start; BOOL Stop; BOOL Running; DINT Speed; END_DATATYPE"); err != nil {
+		t.Fatal(err)
+	}
+	if err = p.CreateTag("MOTOR", "Motor"); err != nil {
+		t.Fatal(err)
+	}
+	p.NewTag(float32(50), "Level")
+	p.NewTag(float32(2.5), "Inflow")
+	p.NewTag([]int32{0, 0, 0, 0}, "arr")
+	p.NewTag(int32(0), "i")
+	p.NewTag(int32(0), "n")
+	p.NewTag(uint16(0), "w")
+	p.NewTag(false, "flag")
+	p.NewTag(int64(0), "big")
+	p.NewTag(int16(0), "Program:Main.x")
+
+	num := func(path string) float64 {
+		p.tMut.RLock()
+		defer p.tMut.RUnlock()
+		ref, err := p.resolve(parsePath(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := getNumber(ref.t, ref.data(), ref.bit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v.float()
+	}
+
+	tests := []struct {
+		src  string
+		path string
+		want float64
+	}{
+		{"Motor.Start := TRUE; Motor.Running := Motor.Start AND NOT Motor.Stop;", "Motor.Running", 1},
+		{"Motor.Stop := 1; Motor.Running := Motor.Start & NOT Motor.Stop;", "Motor.Running", 0},
+		{"Level := Level + Inflow*0.1;", "Level", 50.25},
+		{"n := 7 / 2;", "n", 3},
+		{"n := 7 MOD 3 + -2;", "n", -1},
+		{"n := 7.0 / 2;", "n", 4},
+		{"n := (1 + 2) * 3 - 4 / 2;", "n", 7},
+		{"i := 2; arr[i + 1] := 5;", "arr[3]", 5},
+		{"arr[0] := arr[3] * 2;", "arr[0]", 10},
+		{"w := 16#0; w.3 := TRUE;", "w", 8},
+		{"w := 16#F0 + 2#11;", "w", 243},
+		{"w := 6 AND 3 OR 8;", "w", 10},
+		{"w := 6 XOR 3;", "w", 5},
+		{"n := -300; w := n;", "w", 65236},
+		{"n := 2147483647; n := n + 1;", "n", -2147483648},
+		{"big := 9007199254740993; big := big - 9007199254740992;", "big", 1},
+		{"flag := 2 > 1 AND NOT (3 <= 2) AND 1 <> 2 AND 1 = 1.0;", "flag", 1},
+		{"n := LIMIT(0, 150, 100) + MAX(1, 2) + MIN(1, 2) + ABS(-3);", "n", 106},
+		{"IF Level > 90.0 THEN n := 1; ELSIF Level > 50 THEN n := 2; ELSE n := 3; END_IF;", "n", 2},
+		{"IF FALSE THEN n := 1; END_IF; (* comment *) n := n + 1; // comment", "n", 3},
+		{"Program:Main.x := 12;", "Program:Main.x", 12},
+	}
+	for _, tt := range tests {
+		l, err := CompileLogic(tt.src)
+		if err != nil {
+			t.Errorf("%s: %v", tt.src, err)
+			continue
+		}
+		if err = p.RunLogic(l); err != nil {
+			t.Errorf("%s: %v", tt.src, err)
+			continue
+		}
+		if got := num(tt.path); got != tt.want {
+			t.Errorf("%s: %s = %v, want %v", tt.src, tt.path, got, tt.want)
+		}
+	}
+
+	for _, src := range []string{
+		"n := ;",
+		"n := 1",
+		"n = 1;",
+		"IF n THEN n := 1;",
+		"n := ABS(1, 2);",
+		"(* open",
+		"n := 1 ? 2;",
+		"END_IF;",
+		"arr[ := 1;",
+	} {
+		if _, err := CompileLogic(src); err == nil {
+			t.Errorf("%q compiled", src)
+		}
+	}
+	for _, src := range []string{
+		"nope := 1;",
+		"n := nope;",
+		"arr[9] := 1;",
+		"n := 1 / 0;",
+		"n := Motor;",
+	} {
+		l, err := CompileLogic(src)
+		if err != nil {
+			t.Fatal(src, err)
+		}
+		if p.RunLogic(l) == nil {
+			t.Errorf("%q ran", src)
+		}
+	}
+}
+
+func TestLogicScan(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.NewTag(false, "start")
+	p.NewTag(false, "running")
+	p.NewTag(int32(0), "scans")
+	l, err := CompileLogic("running := start; scans := scans + 1;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := p.Subscribe(100)
+	defer sub.Close()
+	if p.StartLogic(0, l) == nil {
+		t.Error("StartLogic with zero cycle")
+	}
+	if err = p.StartLogic(5*time.Millisecond, l); err != nil {
+		t.Fatal(err)
+	}
+	p.UpdateTag("start", 0, []uint8{1})
+
+	timeout := time.After(2 * time.Second)
+	for running := false; !running; {
+		select {
+		case e := <-sub.C:
+			running = e.Tag == "running" && e.Source == "Logic" && e.Data[0] == 0xFF
+		case <-timeout:
+			t.Fatal("running not set")
+		}
+	}
+	p.StopLogic()
+	p.tMut.RLock()
+	n := p.tags["scans"].DataDINT()[0]
+	p.tMut.RUnlock()
+	time.Sleep(20 * time.Millisecond)
+	p.tMut.RLock()
+	if n2 := p.tags["scans"].DataDINT()[0]; n < 1 || n2 != n {
+		t.Errorf("scans %d, %d after stop", n, n2)
+	}
+	p.tMut.RUnlock()
+}
+
+func TestLogicClose(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.NewTag(int32(0), "scans")
+	l, err := CompileLogic("scans := scans + 1;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := freeAddr(t)
+	go p.Serve(addr)
+	var c *Client
+	for i := 0; i < 50; i++ {
+		if c, err = Connect(addr, -1); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if err = p.StartLogic(time.Millisecond, l); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	p.Close()
+
+	p.logic.m.Lock()
+	running := p.logic.stop != nil
+	p.logic.m.Unlock()
+	if running {
+		t.Error("logic running after Close")
+	}
+}
@@ -0,0 +1,224 @@
+package plcconnector
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are upper bounds of request duration histogram in seconds.
+var latencyBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+type serviceStatus struct {
+	service uint8
+	status  uint8
+}
+
+// metrics of EtherNet/IP server.
+type metrics struct {
+	m sync.Mutex
+	counters
+}
+
+type counters struct {
+	sessions     int64
+	connections  int64
+	requests     map[serviceStatus]uint64
+	latency      map[uint8]*histogram
+	bytesIn      uint64
+	bytesOut     uint64
+	listIdentity uint64
+	tagReads     map[string]uint64
+	tagWrites    map[string]uint64
+}
+
+// clone returns deep copy of counters.
+func (c *counters) clone() counters {
+	n := *c
+	n.requests = make(map[serviceStatus]uint64, len(c.requests))
+	for k, v := range c.requests {
+		n.requests[k] = v
+	}
+	n.latency = make(map[uint8]*histogram, len(c.latency))
+	for k, h := range c.latency {
+		hc := *h
+		hc.counts = append([]uint64(nil), h.counts...)
+		n.latency[k] = &hc
+	}
+	n.tagReads = make(map[string]uint64, len(c.tagReads))
+	for k, v := range c.tagReads {
+		n.tagReads[k] = v
+	}
+	n.tagWrites = make(map[string]uint64, len(c.tagWrites))
+	for k, v := range c.tagWrites {
+		n.tagWrites[k] = v
+	}
+	return n
+}
+
+func (m *metrics) session(d int64) {
+	m.m.Lock()
+	m.sessions += d
+	m.m.Unlock()
+}
+
+func (m *metrics) connection(d int64) {
+	m.m.Lock()
+	m.connections += d
+	m.m.Unlock()
+}
+
+func (m *metrics) bytes(in, out int) {
+	m.m.Lock()
+	m.bytesIn += uint64(in)
+	m.bytesOut += uint64(out)
+	m.m.Unlock()
+}
+
+func (m *metrics) udpListIdentity() {
+	m.m.Lock()
+	m.listIdentity++
+	m.m.Unlock()
+}
+
+func (m *metrics) request(service, status uint8, d time.Duration) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	if m.requests == nil {
+		m.requests = make(map[serviceStatus]uint64)
+		m.latency = make(map[uint8]*histogram)
+	}
+	m.requests[serviceStatus{service, status}]++
+	h := m.latency[service]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		m.latency[service] = h
+	}
+	s := d.Seconds()
+	for i, b := range latencyBuckets {
+		if s <= b {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += s
+	h.count++
+}
+
+func (m *metrics) tag(name string, write bool) {
+	m.m.Lock()
+	if m.tagReads == nil {
+		m.tagReads = make(map[string]uint64)
+		m.tagWrites = make(map[string]uint64)
+	}
+	if write {
+		m.tagWrites[name]++
+	} else {
+		m.tagReads[name]++
+	}
+	m.m.Unlock()
+}
+
+// countingReader counts bytes read from the connection.
+type countingReader struct {
+	r io.Reader
+	m *metrics
+}
+
+func (c countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.m.bytes(n, 0)
+	return n, err
+}
+
+func promLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func promHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func sortedKeys(m map[string]uint64) []string {
+	k := make([]string, 0, len(m))
+	for n := range m {
+		k = append(k, n)
+	}
+	sort.Strings(k)
+	return k
+}
+
+// WriteMetrics writes metrics of EtherNet/IP server in Prometheus text format.
+// Counters are copied first, so slow w does not block the server.
+func (p *PLC) WriteMetrics(w io.Writer) {
+	p.metrics.m.Lock()
+	m := p.metrics.clone()
+	p.metrics.m.Unlock()
+
+	promHeader(w, "plcconnector_sessions", "gauge", "Active EtherNet/IP TCP sessions.")
+	fmt.Fprintf(w, "plcconnector_sessions %d\n", m.sessions)
+	promHeader(w, "plcconnector_cip_connections", "gauge", "Open CIP connections.")
+	fmt.Fprintf(w, "plcconnector_cip_connections %d\n", m.connections)
+	promHeader(w, "plcconnector_received_bytes_total", "counter", "Bytes received over TCP.")
+	fmt.Fprintf(w, "plcconnector_received_bytes_total %d\n", m.bytesIn)
+	promHeader(w, "plcconnector_sent_bytes_total", "counter", "Bytes sent over TCP.")
+	fmt.Fprintf(w, "plcconnector_sent_bytes_total %d\n", m.bytesOut)
+	promHeader(w, "plcconnector_udp_list_identity_total", "counter", "ListIdentity requests received over UDP.")
+	fmt.Fprintf(w, "plcconnector_udp_list_identity_total %d\n", m.listIdentity)
+
+	promHeader(w, "plcconnector_requests_total", "counter", "CIP requests by service and status.")
+	reqs := make([]serviceStatus, 0, len(m.requests))
+	for k := range m.requests {
+		reqs = append(reqs, k)
+	}
+	sort.Slice(reqs, func(i, j int) bool {
+		return reqs[i].service < reqs[j].service || (reqs[i].service == reqs[j].service && reqs[i].status < reqs[j].status)
+	})
+	for _, k := range reqs {
+		fmt.Fprintf(w, "plcconnector_requests_total{service=\"0x%02X\",status=\"0x%02X\"} %d\n", k.service, k.status, m.requests[k])
+	}
+
+	promHeader(w, "plcconnector_request_duration_seconds", "histogram", "CIP request processing time by service.")
+	svcs := make([]int, 0, len(m.latency))
+	for s := range m.latency {
+		svcs = append(svcs, int(s))
+	}
+	sort.Ints(svcs)
+	for _, s := range svcs {
+		h := m.latency[uint8(s)]
+		var c uint64
+		for i, b := range latencyBuckets {
+			c += h.counts[i]
+			fmt.Fprintf(w, "plcconnector_request_duration_seconds_bucket{service=\"0x%02X\",le=\"%s\"} %d\n", s, strconv.FormatFloat(b, 'g', -1, 64), c)
+		}
+		fmt.Fprintf(w, "plcconnector_request_duration_seconds_bucket{service=\"0x%02X\",le=\"+Inf\"} %d\n", s, h.count)
+		fmt.Fprintf(w, "plcconnector_request_duration_seconds_sum{service=\"0x%02X\"} %s\n", s, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "plcconnector_request_duration_seconds_count{service=\"0x%02X\"} %d\n", s, h.count)
+	}
+
+	promHeader(w, "plcconnector_tag_reads_total", "counter", "Tag reads by tag.")
+	for _, n := range sortedKeys(m.tagReads) {
+		fmt.Fprintf(w, "plcconnector_tag_reads_total{tag=\"%s\"} %d\n", promLabel(n), m.tagReads[n])
+	}
+	promHeader(w, "plcconnector_tag_writes_total", "counter", "Tag writes by tag.")
+	for _, n := range sortedKeys(m.tagWrites) {
+		fmt.Fprintf(w, "plcconnector_tag_writes_total{tag=\"%s\"} %d\n", promLabel(n), m.tagWrites[n])
+	}
+}
+
+func (p *PLC) metricsHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	p.WriteMetrics(w)
+}
@@ -0,0 +1,109 @@
+package plcconnector
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.NewTag(int16(7), "a")
+	addr := freeAddr(t)
+	go p.Serve(addr)
+	defer p.Close()
+
+	var c *Client
+	for i := 0; i < 50; i++ {
+		if c, err = Connect(addr, -1); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err = c.ReadTag("a", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.ReadTag("nope", 1)
+	p.saveTag(parsePath("a"), TypeINT, 1, []uint8{1, 0}, 0)
+
+	w := httptest.NewRecorder()
+	p.handler(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	for _, want := range []string{
+		"plcconnector_sessions 1\n",
+		"plcconnector_requests_total{service=\"0x4C\",status=\"0x00\"} 2\n",
+		"plcconnector_requests_total{service=\"0x4C\",status=\"0x04\"} 1\n",
+		"plcconnector_request_duration_seconds_bucket{service=\"0x4C\",le=\"+Inf\"} 3\n",
+		"plcconnector_request_duration_seconds_count{service=\"0x4C\"} 3\n",
+		"plcconnector_tag_reads_total{tag=\"a\"} 2\n",
+		"plcconnector_tag_writes_total{tag=\"a\"} 1\n",
+		"# TYPE plcconnector_request_duration_seconds histogram\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "plcconnector_received_bytes_total 0\n") || strings.Contains(body, "plcconnector_sent_bytes_total 0\n") {
+		t.Errorf("bytes not counted\n%s", body)
+	}
+
+	c.Close()
+	for i := 0; i < 50 && strings.Contains(metricsText(p), "plcconnector_sessions 1\n"); i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if !strings.Contains(metricsText(p), "plcconnector_sessions 0\n") {
+		t.Error("session not closed")
+	}
+}
+
+func metricsText(p *PLC) string {
+	var b strings.Builder
+	p.WriteMetrics(&b)
+	return b.String()
+}
+
+// blockedWriter blocks until release is closed.
+type blockedWriter struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (w *blockedWriter) Write(b []byte) (int, error) {
+	select {
+	case w.started <- struct{}{}:
+	default:
+	}
+	<-w.release
+	return len(b), nil
+}
+
+func TestMetricsSlowWriter(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &blockedWriter{started: make(chan struct{}, 1), release: make(chan struct{})}
+	defer close(w.release)
+	go p.WriteMetrics(w)
+	<-w.started
+
+	done := make(chan struct{})
+	go func() {
+		p.metrics.request(ReadTag, Success, time.Millisecond)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("request counter blocked by metrics writer")
+	}
+}
@@ -0,0 +1,359 @@
+package plcconnector
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+// ModbusTag maps tag path to Modbus address.
+// Coil or discrete input is BOOL tag, member or bit, and BOOL array maps its elements to consecutive addresses.
+// Registers span data of tag as 16-bit words, least significant word first; single bit maps to one register of 0 or 1.
+type ModbusTag struct {
+	Address uint16 `json:"address"`
+	Path    string `json:"path"`
+}
+
+// ModbusMap maps tags to Modbus tables. Discrete inputs and input registers are read only.
+type ModbusMap struct {
+	Coils            []ModbusTag `json:"coils"`
+	DiscreteInputs   []ModbusTag `json:"discreteInputs"`
+	HoldingRegisters []ModbusTag `json:"holdingRegisters"`
+	InputRegisters   []ModbusTag `json:"inputRegisters"`
+}
+
+// Modbus function codes.
+const (
+	modbusReadCoils      = 1
+	modbusReadDiscrete   = 2
+	modbusReadHolding    = 3
+	modbusReadInput      = 4
+	modbusWriteCoil      = 5
+	modbusWriteRegister  = 6
+	modbusWriteCoils     = 15
+	modbusWriteRegisters = 16
+)
+
+// Modbus exception codes.
+const (
+	modbusIllegalFunction = 1
+	modbusIllegalAddress  = 2
+	modbusIllegalValue    = 3
+)
+
+const (
+	modbusHeaderLen         = 7 // MBAP header: transaction, protocol, length, unit
+	modbusMaxPDU            = 253
+	modbusException         = 0x80 // added to function code of exception response
+	modbusCoilOn            = 0xFF00
+	modbusMaxReadBits       = 2000
+	modbusMaxReadRegisters  = 125
+	modbusMaxWriteBits      = 1968
+	modbusMaxWriteRegisters = 123
+)
+
+// modbusRef is tag resolved at Modbus address.
+type modbusRef struct {
+	tagRef
+	addr int
+	n    int // number of coils or registers
+}
+
+// ServeModbus serves Modbus TCP on listener l with tags mapped by m until l is closed.
+// Paths are resolved on every request, so tags may be added, removed or reloaded while serving.
+func (p *PLC) ServeModbus(l net.Listener, m ModbusMap) error {
+	for _, tab := range [][]ModbusTag{m.Coils, m.DiscreteInputs, m.HoldingRegisters, m.InputRegisters} {
+		for _, t := range tab {
+			if parsePath(t.Path) == nil {
+				return errors.New("invalid path " + t.Path)
+			}
+		}
+	}
+	var (
+		mut   sync.Mutex
+		conns = make(map[net.Conn]struct{})
+		wg    sync.WaitGroup
+	)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			mut.Lock()
+			for c := range conns {
+				c.Close()
+			}
+			mut.Unlock()
+			wg.Wait()
+			if errors.Is(err, net.ErrClosed) {
+				p.log(LogDebug, "Modbus server shutdown")
+				return nil
+			}
+			return err
+		}
+		mut.Lock()
+		conns[conn] = struct{}{}
+		mut.Unlock()
+		wg.Add(1)
+		go func() {
+			p.handleModbus(conn, &m)
+			mut.Lock()
+			delete(conns, conn)
+			mut.Unlock()
+			wg.Done()
+		}()
+	}
+}
+
+func (p *PLC) handleModbus(conn net.Conn, m *ModbusMap) {
+	defer conn.Close()
+	p.log(LogDebug, "Modbus connection", "remote", conn.RemoteAddr())
+	hdr := make([]uint8, modbusHeaderLen)
+	for {
+		if _, err := io.ReadFull(conn, hdr); err != nil {
+			return
+		}
+		l := int(binary.BigEndian.Uint16(hdr[4:6]))
+		if binary.BigEndian.Uint16(hdr[2:4]) != 0 || l < 2 || l > modbusMaxPDU+1 {
+			p.log(LogWarn, "Modbus invalid header", "remote", conn.RemoteAddr())
+			return
+		}
+		pdu := make([]uint8, l-1)
+		if _, err := io.ReadFull(conn, pdu); err != nil {
+			return
+		}
+		resp := p.modbusRequest(m, pdu)
+		binary.BigEndian.PutUint16(hdr[4:6], uint16(len(resp)+1))
+		if _, err := conn.Write(append(append([]uint8{}, hdr...), resp...)); err != nil {
+			return
+		}
+	}
+}
+
+// modbusRequest returns response PDU to request PDU.
+func (p *PLC) modbusRequest(m *ModbusMap, pdu []uint8) []uint8 {
+	fc := pdu[0]
+	exc := func(code uint8) []uint8 {
+		p.log(LogDebug, "Modbus exception", "function", fc, "code", code)
+		return []uint8{fc | modbusException, code}
+	}
+	if fc < modbusReadCoils || fc > modbusWriteRegister && fc != modbusWriteCoils && fc != modbusWriteRegisters {
+		return exc(modbusIllegalFunction)
+	}
+	if len(pdu) < 5 {
+		return exc(modbusIllegalValue)
+	}
+	start := int(binary.BigEndian.Uint16(pdu[1:3]))
+	qty := int(binary.BigEndian.Uint16(pdu[3:5]))
+
+	switch fc {
+	case modbusReadCoils, modbusReadDiscrete:
+		tab := m.Coils
+		if fc == modbusReadDiscrete {
+			tab = m.DiscreteInputs
+		}
+		if qty < 1 || qty > modbusMaxReadBits {
+			return exc(modbusIllegalValue)
+		}
+		p.tMut.RLock()
+		defer p.tMut.RUnlock()
+		refs := p.modbusRefs(tab, true)
+		resp := make([]uint8, 2+(qty+7)/8)
+		resp[0], resp[1] = fc, uint8(len(resp)-2)
+		for i := 0; i < qty; i++ {
+			r, j, ok := modbusFind(refs, start+i)
+			if !ok {
+				return exc(modbusIllegalAddress)
+			}
+			if r.getBit(j) {
+				resp[2+i/8] |= 1 << uint(i%8)
+			}
+		}
+		return resp
+
+	case modbusReadHolding, modbusReadInput:
+		tab := m.HoldingRegisters
+		if fc == modbusReadInput {
+			tab = m.InputRegisters
+		}
+		if qty < 1 || qty > modbusMaxReadRegisters {
+			return exc(modbusIllegalValue)
+		}
+		p.tMut.RLock()
+		defer p.tMut.RUnlock()
+		refs := p.modbusRefs(tab, false)
+		resp := make([]uint8, 2+2*qty)
+		resp[0], resp[1] = fc, uint8(len(resp)-2)
+		for i := 0; i < qty; i++ {
+			r, j, ok := modbusFind(refs, start+i)
+			if !ok {
+				return exc(modbusIllegalAddress)
+			}
+			binary.BigEndian.PutUint16(resp[2+2*i:], r.getWord(j))
+		}
+		return resp
+
+	case modbusWriteCoil:
+		if qty != 0 && qty != modbusCoilOn {
+			return exc(modbusIllegalValue)
+		}
+		if !p.modbusWrite(m.Coils, true, start, 1, func(int) uint16 { return uint16(qty) }) {
+			return exc(modbusIllegalAddress)
+		}
+		return pdu[:5]
+
+	case modbusWriteRegister:
+		if !p.modbusWrite(m.HoldingRegisters, false, start, 1, func(int) uint16 { return uint16(qty) }) {
+			return exc(modbusIllegalAddress)
+		}
+		return pdu[:5]
+
+	case modbusWriteCoils, modbusWriteRegisters:
+		if len(pdu) < 6 {
+			return exc(modbusIllegalValue)
+		}
+		val := pdu[6:]
+		if fc == modbusWriteCoils {
+			if qty < 1 || qty > modbusMaxWriteBits || int(pdu[5]) != (qty+7)/8 || len(val) != int(pdu[5]) {
+				return exc(modbusIllegalValue)
+			}
+			if !p.modbusWrite(m.Coils, true, start, qty, func(i int) uint16 { return uint16(val[i/8] >> uint(i%8) & 1) }) {
+				return exc(modbusIllegalAddress)
+			}
+		} else {
+			if qty < 1 || qty > modbusMaxWriteRegisters || int(pdu[5]) != 2*qty || len(val) != 2*qty {
+				return exc(modbusIllegalValue)
+			}
+			if !p.modbusWrite(m.HoldingRegisters, false, start, qty, func(i int) uint16 { return binary.BigEndian.Uint16(val[2*i:]) }) {
+				return exc(modbusIllegalAddress)
+			}
+		}
+	}
+	return pdu[:5]
+}
+
+// modbusWrite writes qty coils or registers from start, with value of i-th one returned by v.
+// Nothing is written if any address is not mapped. Must be called with tMut unlocked.
+func (p *PLC) modbusWrite(tab []ModbusTag, coils bool, start int, qty int, v func(i int) uint16) bool {
+	p.tMut.Lock()
+	defer p.tMut.Unlock()
+	refs := p.modbusRefs(tab, coils)
+	written := make(map[int]bool)
+	for i := 0; i < qty; i++ {
+		_, _, ok := modbusFind(refs, start+i)
+		if !ok {
+			return false
+		}
+	}
+	for i := 0; i < qty; i++ {
+		r, j, _ := modbusFind(refs, start+i)
+		if coils {
+			r.setBit(j, v(i) != 0)
+		} else {
+			r.setWord(j, v(i))
+		}
+		written[r.addr] = true
+	}
+	for _, r := range refs {
+		if written[r.addr] {
+			p.tagWritten(r.tag, r.off, r.data(), "Modbus", WriteTag, Tag{Type: r.t.Type})
+		}
+	}
+	return true
+}
+
+// modbusRefs resolves tags of table, skipping ones not found or of type not fitting coils. Must be called with tMut locked.
+func (p *PLC) modbusRefs(tab []ModbusTag, coils bool) []modbusRef {
+	refs := make([]modbusRef, 0, len(tab))
+	for _, mt := range tab {
+		r, err := p.resolve(parsePath(mt.Path))
+		if err != nil {
+			p.log(LogDebug, "Modbus tag", "path", mt.Path, "err", err)
+			continue
+		}
+		mr := modbusRef{tagRef: r, addr: int(mt.Address), n: 1}
+		switch {
+		case mr.single():
+		case coils && r.t.boolArray():
+			mr.n = r.t.Dims()
+		case coils:
+			p.log(LogDebug, "Modbus tag", "path", mt.Path, "err", "BOOL expected")
+			continue
+		default:
+			mr.n = (r.t.dataLen() + 1) / 2
+		}
+		refs = append(refs, mr)
+	}
+	return refs
+}
+
+// modbusFind returns tag mapped at Modbus address a and index of coil or register in it.
+func modbusFind(refs []modbusRef, a int) (modbusRef, int, bool) {
+	for _, r := range refs {
+		if a >= r.addr && a < r.addr+r.n {
+			return r, a - r.addr, true
+		}
+	}
+	return modbusRef{}, 0, false
+}
+
+// single reports whether r is one bit, mapped to one coil or register.
+func (r modbusRef) single() bool {
+	return r.bit >= 0 || r.t.st == nil && r.t.BasicType() == TypeBOOL && r.t.Dim[0] == 0
+}
+
+func (r modbusRef) getBit(i int) bool {
+	d := r.data()
+	switch {
+	case r.bit >= 0:
+		return d[0]&(1<<uint(r.bit)) != 0
+	case r.t.boolArray():
+		return d[i/8]&(1<<uint(i%8)) != 0
+	}
+	return d[0] != 0
+}
+
+func (r modbusRef) setBit(i int, v bool) {
+	d := r.data()
+	switch {
+	case r.bit >= 0:
+		i = r.bit
+	case r.t.boolArray():
+		d = d[i/8:]
+		i %= 8
+	default:
+		d[0] = boolByte(v)
+		return
+	}
+	if v {
+		d[0] |= 1 << uint(i)
+	} else {
+		d[0] &^= 1 << uint(i)
+	}
+}
+
+func (r modbusRef) getWord(i int) uint16 {
+	if r.single() {
+		if r.getBit(0) {
+			return 1
+		}
+		return 0
+	}
+	d := r.data()[2*i:]
+	if len(d) == 1 {
+		return uint16(d[0])
+	}
+	return binary.LittleEndian.Uint16(d)
+}
+
+func (r modbusRef) setWord(i int, v uint16) {
+	if r.single() {
+		r.setBit(0, v != 0)
+		return
+	}
+	d := r.data()[2*i:]
+	d[0] = uint8(v)
+	if len(d) > 1 {
+		d[1] = uint8(v >> 8)
+	}
+}
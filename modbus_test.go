@@ -0,0 +1,103 @@
+package plcconnector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestModbus(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.AddTag(*TagBOOL(false, "b"))
+	p.AddTag(*TagArrayBool([]bool{true, false, true}, 3, "flags"))
+	p.AddTag(*TagDINT(0x12345678, "d"))
+	p.AddTag(*TagArrayINT([]int16{1, -1}, 2, "i"))
+	p.AddTag(*TagINT(5, "n"))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- p.ServeModbus(l, ModbusMap{
+			Coils:            []ModbusTag{{0, "b"}, {1, "n.1"}, {8, "flags"}},
+			DiscreteInputs:   []ModbusTag{{0, "flags"}},
+			HoldingRegisters: []ModbusTag{{0, "d"}, {2, "i"}, {10, "b"}},
+			InputRegisters:   []ModbusTag{{5, "n"}},
+		})
+	}()
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		req, resp string
+	}{
+		{"0300000004", "0308567812340001ffff"},
+		{"0400050001", "04020005"},
+		{"0400060001", "8402"},
+		{"0300000080", "8303"},
+		{"0200000003", "020105"},
+		{"0100080003", "010105"},
+		{"010000000a", "8102"},
+		{"050000ff00", "050000ff00"},
+		{"0500010001", "8503"},
+		{"050001ff00", "050001ff00"},
+		{"0100000002", "010103"},
+		{"0400050001", "04020007"},
+		{"0f000800030102", "0f00080003"},
+		{"0200000003", "020102"},
+		{"10000100020400070008", "1000010002"},
+		{"0300000004", "0308567800070008ffff"},
+		{"0600000000", "0600000000"},
+		{"060001abcd", "060001abcd"},
+		{"0300000002", "03040000abcd"},
+		{"06000a0000", "06000a0000"},
+		{"0100000001", "010100"},
+		{"0600040000", "8602"},
+		{"07", "8701"},
+	}
+	hdr := make([]uint8, 7)
+	for i, tt := range tests {
+		req, _ := hex.DecodeString(tt.req)
+		binary.BigEndian.PutUint16(hdr, uint16(i))
+		binary.BigEndian.PutUint16(hdr[4:], uint16(len(req)+1))
+		hdr[6] = 1
+		if _, err = c.Write(append(hdr, req...)); err != nil {
+			t.Fatal(err)
+		}
+		resp := make([]uint8, 7)
+		if _, err = io.ReadFull(c, resp); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(resp[:4], hdr[:4]) || resp[6] != 1 {
+			t.Errorf("%s: header % x", tt.req, resp)
+		}
+		resp = make([]uint8, binary.BigEndian.Uint16(resp[4:])-1)
+		if _, err = io.ReadFull(c, resp); err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(resp) != tt.resp {
+			t.Errorf("%s: got %x, want %s", tt.req, resp, tt.resp)
+		}
+	}
+	if b := p.tags["b"].data[0]; b != 0 {
+		t.Errorf("b = %#x, want 0 after writing register 0", b)
+	}
+
+	l.Close()
+	if err = <-done; err != nil {
+		t.Error(err)
+	}
+	if _, err = c.Read(hdr); err == nil {
+		t.Error("connection open after listener close")
+	}
+}
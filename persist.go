@@ -0,0 +1,261 @@
+package plcconnector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	journalFile  = "journal.bin"
+	snapshotFile = "snapshot.bin"
+)
+
+type persistence struct {
+	dir     string
+	journal *os.File
+	seq     uint64
+	m       sync.Mutex
+	dirty   chan struct{} // journal has appends not synced to disk
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// persistRec is journal or snapshot record: data written at offset of the tag.
+type persistRec struct {
+	seq    uint64
+	name   string
+	offset int
+	data   []uint8
+}
+
+// Record: UDINT crc32, UDINT length, ULINT seq, UDINT offset, UINT name length, name, data.
+func (r persistRec) encode(buf *bytes.Buffer) {
+	body := make([]byte, 14, 14+len(r.name)+len(r.data))
+	binary.LittleEndian.PutUint64(body[0:], r.seq)
+	binary.LittleEndian.PutUint32(body[8:], uint32(r.offset))
+	binary.LittleEndian.PutUint16(body[12:], uint16(len(r.name)))
+	body = append(body, r.name...)
+	body = append(body, r.data...)
+	var hdr [8]byte
+	binary.LittleEndian.PutUint32(hdr[0:], crc32.ChecksumIEEE(body))
+	binary.LittleEndian.PutUint32(hdr[4:], uint32(len(body)))
+	buf.Write(hdr[:])
+	buf.Write(body)
+}
+
+// readPersist returns valid records and length of the valid part of the file.
+func readPersist(b []byte) ([]persistRec, int) {
+	var recs []persistRec
+	pos := 0
+	for len(b)-pos >= 8 {
+		crc := binary.LittleEndian.Uint32(b[pos:])
+		ln := int(binary.LittleEndian.Uint32(b[pos+4:]))
+		if ln < 14 || ln > len(b)-pos-8 {
+			break
+		}
+		body := b[pos+8 : pos+8+ln]
+		if crc32.ChecksumIEEE(body) != crc {
+			break
+		}
+		nl := int(binary.LittleEndian.Uint16(body[12:]))
+		if 14+nl > ln {
+			break
+		}
+		recs = append(recs, persistRec{
+			seq:    binary.LittleEndian.Uint64(body),
+			offset: int(binary.LittleEndian.Uint32(body[8:])),
+			name:   string(body[14 : 14+nl]),
+			data:   body[14+nl:],
+		})
+		pos += 8 + ln
+	}
+	return recs, pos
+}
+
+// restore applies record to the tag. Records of unknown or changed tags are ignored.
+func (p *PLC) restore(r persistRec) {
+	if r.name == "" {
+		return
+	}
+	t, ok := p.tags[strings.ToLower(r.name)]
+	if !ok || r.offset+len(r.data) > len(t.data) {
+		p.log(LogWarn, "persistence: skipping record", "tag", r.name)
+		return
+	}
+	copy(t.data[r.offset:], r.data)
+}
+
+// EnablePersistence restores tags from snapshot and journal in dir and starts journaling of writes.
+// Journal is compacted into snapshot every interval, if positive. Appends are synced to disk in batches in background.
+// Replay happens only here: call it after all tags are loaded by NewTag, UseL5K, UseL5X or UseSymbols.
+// Saved values of tags added later are not restored and are dropped by the next snapshot.
+func (p *PLC) EnablePersistence(dir string, interval time.Duration) error {
+	if p.persist != nil {
+		return errors.New("persistence already enabled")
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	ps := &persistence{dir: dir, dirty: make(chan struct{}, 1), stop: make(chan struct{}), done: make(chan struct{})}
+
+	p.tMut.Lock()
+	snap, err := os.ReadFile(filepath.Join(dir, snapshotFile))
+	if err != nil && !os.IsNotExist(err) {
+		p.tMut.Unlock()
+		return err
+	}
+	recs, _ := readPersist(snap)
+	for _, r := range recs {
+		p.restore(r)
+		ps.seq = r.seq
+	}
+	jn := filepath.Join(dir, journalFile)
+	jb, err := os.ReadFile(jn)
+	if err != nil && !os.IsNotExist(err) {
+		p.tMut.Unlock()
+		return err
+	}
+	recs, valid := readPersist(jb)
+	for _, r := range recs {
+		if r.seq > ps.seq {
+			p.restore(r)
+			ps.seq = r.seq
+		}
+	}
+	if valid < len(jb) {
+		p.log(LogWarn, "persistence: torn journal record", "offset", valid)
+		err = os.Truncate(jn, int64(valid))
+		if err != nil {
+			p.tMut.Unlock()
+			return err
+		}
+	}
+	ps.journal, err = os.OpenFile(jn, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		p.tMut.Unlock()
+		return err
+	}
+	p.persist = ps
+	p.tMut.Unlock()
+
+	go func() {
+		defer close(ps.done)
+		var tick <-chan time.Time
+		if interval > 0 {
+			t := time.NewTicker(interval)
+			defer t.Stop()
+			tick = t.C
+		}
+		for {
+			select {
+			case <-ps.dirty:
+				err := ps.journal.Sync()
+				if err != nil {
+					p.log(LogError, "persistence", "err", err)
+				}
+			case <-tick:
+				err := p.Snapshot()
+				if err != nil {
+					p.log(LogError, "persistence", "err", err)
+				}
+			case <-ps.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// DisablePersistence writes final snapshot and stops journaling.
+func (p *PLC) DisablePersistence() error {
+	ps := p.persist
+	if ps == nil {
+		return nil
+	}
+	close(ps.stop)
+	<-ps.done
+	err := p.Snapshot()
+	p.tMut.Lock()
+	p.persist = nil
+	p.tMut.Unlock()
+	if e := ps.journal.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// Snapshot writes all tags to snapshot file and truncates journal.
+func (p *PLC) Snapshot() error {
+	p.tMut.RLock()
+	defer p.tMut.RUnlock()
+	ps := p.persist
+	if ps == nil {
+		return errors.New("persistence not enabled")
+	}
+	ps.m.Lock()
+	defer ps.m.Unlock()
+
+	var buf bytes.Buffer
+	persistRec{seq: ps.seq}.encode(&buf) // marker, for empty snapshot
+	for _, t := range p.tags {
+		if t.data != nil {
+			persistRec{seq: ps.seq, name: t.Name, data: t.data}.encode(&buf)
+		}
+	}
+	tmp := filepath.Join(ps.dir, snapshotFile+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, &buf)
+	if err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, filepath.Join(ps.dir, snapshotFile))
+	if err != nil {
+		return err
+	}
+	if d, err := os.Open(ps.dir); err == nil { // make the rename durable
+		d.Sync()
+		d.Close()
+	}
+	return ps.journal.Truncate(0)
+}
+
+// journal appends write of data at offset of tag t, synced to disk later by the goroutine of EnablePersistence.
+// Must be called with tMut locked.
+func (p *PLC) journal(t *Tag, offset int, data []uint8) {
+	ps := p.persist
+	if ps == nil {
+		return
+	}
+	ps.m.Lock()
+	defer ps.m.Unlock()
+	ps.seq++
+	var buf bytes.Buffer
+	persistRec{seq: ps.seq, name: t.Name, offset: offset, data: data}.encode(&buf)
+	_, err := ps.journal.Write(buf.Bytes())
+	if err != nil {
+		p.log(LogError, "persistence", "err", err)
+		return
+	}
+	select {
+	case ps.dirty <- struct{}{}:
+	default: // sync pending, covers this append too
+	}
+}
@@ -0,0 +1,108 @@
+package plcconnector
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newPersistPLC(t *testing.T, dir string) *PLC {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.NewTag([]int32{1, 2, 3}, "dints")
+	p.NewTag([]bool{false, false}, "bools")
+	p.NewTag("abc", "msg")
+	err = p.EnablePersistence(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestPersistence(t *testing.T) {
+	dir := t.TempDir()
+
+	p := newPersistPLC(t, dir)
+	p.saveTag(parsePath("dints[1]"), TypeDINT, 1, []uint8{20, 0, 0, 0}, 0)
+	if err := p.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	p.saveTag(parsePath("bools[1]"), TypeBOOL, 1, []uint8{1}, 0)
+	p.UpdateTag("dints", 2, []uint8{30, 0, 0, 0})
+	p.readModWriteTag(parsePath("dints[0]"), []uint8{0x10, 0, 0, 0}, []uint8{0xFF, 0xFF, 0xFF, 0xFF})
+	if err := p.SetString("msg", "persisted"); err != nil {
+		t.Fatal(err)
+	}
+	p.persist.journal.Close() // crash, journal not compacted
+
+	// torn write at the end of journal
+	f, err := os.OpenFile(filepath.Join(dir, journalFile), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{1, 2, 3, 4, 100, 0, 0, 0, 9})
+	f.Close()
+
+	q := newPersistPLC(t, dir)
+	if got := q.tags["dints"].DataDINT(); !reflect.DeepEqual(got, []int32{0x11, 20, 30}) {
+		t.Errorf("dints = %v", got)
+	}
+	if got := q.tags["bools"].DataBOOL(); !got[1] || got[0] {
+		t.Errorf("bools = %v", got[:2])
+	}
+	if s, _ := q.GetString("msg"); s != "persisted" {
+		t.Errorf("msg = %q", s)
+	}
+
+	q.saveTag(parsePath("dints[2]"), TypeDINT, 1, []uint8{40, 0, 0, 0}, 0)
+	if err := q.DisablePersistence(); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(filepath.Join(dir, journalFile)); err != nil || fi.Size() != 0 {
+		t.Errorf("journal not compacted: %v", err)
+	}
+	r := newPersistPLC(t, dir)
+	if got := r.tags["dints"].DataDINT(); !reflect.DeepEqual(got, []int32{0x11, 20, 40}) {
+		t.Errorf("dints after snapshot = %v", got)
+	}
+	r.DisablePersistence()
+}
+
+func TestPersistenceClose(t *testing.T) {
+	dir := t.TempDir()
+	p := newPersistPLC(t, dir)
+	addr := freeAddr(t)
+	go p.Serve(addr)
+	var (
+		c   *Client
+		err error
+	)
+	for i := 0; i < 50; i++ {
+		if c, err = Connect(addr, -1); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	p.saveTag(parsePath("dints[0]"), TypeDINT, 1, []uint8{7, 0, 0, 0}, 0)
+	p.Close()
+
+	if p.persist != nil {
+		t.Error("persistence enabled after Close")
+	}
+	if fi, err := os.Stat(filepath.Join(dir, journalFile)); err != nil || fi.Size() != 0 {
+		t.Errorf("journal not compacted on Close: %v", err)
+	}
+	q := newPersistPLC(t, dir)
+	if got := q.tags["dints"].DataDINT(); got[0] != 7 {
+		t.Errorf("dints after Close = %v", got)
+	}
+	q.DisablePersistence()
+}
@@ -0,0 +1,332 @@
+package plcconnector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ioPort is default UDP port of class 1 connections.
+const ioPort = 2222
+
+// ProducedTag describes tag produced over class 1 connections, e.g. to controllers consuming it.
+// Consumer opens the connection by Forward Open with Name in the connection path,
+// and receives data of Tag every requested packet interval by UDP until Forward Close,
+// or until its O->T packets stop for the connection timeout. The connection outlives the TCP session.
+type ProducedTag struct {
+	Name         string `json:"name"`                   // name in connection path
+	Tag          string `json:"tag"`                    // produced tag, member or element
+	MaxConsumers int    `json:"maxConsumers,omitempty"` // 0 is unlimited
+}
+
+type producedTag struct {
+	ProducedTag
+	path  []pathEl
+	conns map[*ioConn]struct{}
+}
+
+// ioConn is class 1 connection of consumer.
+type ioConn struct {
+	last    int64 // time of last O->T packet in UnixNano, accessed atomically
+	serial  uint16
+	vendor  uint16
+	orig    uint32
+	otID    uint32
+	timeout time.Duration // 0 is no timeout
+	stop    chan struct{}
+}
+
+// ioRequest is Forward Open of class 1 connection.
+type ioRequest struct {
+	serial  uint16
+	vendor  uint16
+	orig    uint32
+	otID    uint32 // O->T connection ID
+	toID    uint32 // T->O connection ID
+	rpi     uint32 // T->O packet interval in microseconds
+	size    int    // T->O connection size
+	timeout time.Duration
+}
+
+// ioTimeout returns connection timeout of O->T packet interval in microseconds and timeout multiplier.
+func ioTimeout(rpi uint32, mult uint8) time.Duration {
+	if mult > 7 {
+		mult = 7
+	}
+	return time.Duration(rpi) * time.Microsecond * time.Duration(4<<mult)
+}
+
+// AddProducedTag makes tag available to consumers.
+func (p *PLC) AddProducedTag(pt ProducedTag) error {
+	if pt.Name == "" {
+		return errors.New("produced tag needs name")
+	}
+	pth := parsePath(pt.Tag)
+	if pth == nil {
+		return errors.New("invalid produced tag " + pt.Tag)
+	}
+	p.tMut.RLock()
+	r, err := p.resolve(pth)
+	p.tMut.RUnlock()
+	if err != nil {
+		return err
+	}
+	if r.bit >= 0 || len(r.data()) > 500 {
+		return errors.New("produced tag " + pt.Tag + " must be whole bytes, at most 500")
+	}
+	p.prodMut.Lock()
+	defer p.prodMut.Unlock()
+	if p.produced == nil {
+		p.produced = make(map[string]*producedTag)
+	}
+	n := strings.ToLower(pt.Name)
+	if _, ok := p.produced[n]; ok {
+		return errors.New("produced tag " + pt.Name + " already exists")
+	}
+	p.produced[n] = &producedTag{ProducedTag: pt, path: pth, conns: make(map[*ioConn]struct{})}
+	return nil
+}
+
+// ProducedTags returns produced tags sorted by name.
+func (p *PLC) ProducedTags() []ProducedTag {
+	p.prodMut.Lock()
+	defer p.prodMut.Unlock()
+	list := make([]ProducedTag, 0, len(p.produced))
+	for _, pt := range p.produced {
+		list = append(list, pt.ProducedTag)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// ioFail writes unsuccessful Forward Open response of io with extended status ext.
+func (r *req) ioFail(io ioRequest, ext uint16) {
+	r.resp.Status = ConnFailure
+	r.resp.AddStatusSize = 1
+	r.write(r.resp)
+	r.write(ext)
+	r.write(forwardOpenFailResponse{ConnSerialNumber: io.serial, VendorID: io.vendor, OriginatorSerialNumber: io.orig})
+}
+
+// ioTagName returns name in connection path after port segments.
+func (r *req) ioTagName(connPath []uint8) string {
+	i := 0
+	for i < len(connPath) && connPath[i]&0xE0 == 0 { // port segment
+		if connPath[i]&0x10 != 0 && i+1 < len(connPath) {
+			i += 2 + int(connPath[i+1])
+			i += i & 1
+		} else {
+			i += 2
+		}
+	}
+	if i >= len(connPath) {
+		return ""
+	}
+	_, _, _, _, pth, err := r.parsePath(connPath[i:])
+	if err != nil {
+		return ""
+	}
+	for _, e := range pth {
+		if e.typ == ansiExtended {
+			return e.txt
+		}
+	}
+	return ""
+}
+
+// openIO opens class 1 connection producing tag named in connPath. On error it writes the response and returns false.
+func (r *req) openIO(connPath []uint8, io ioRequest) bool {
+	p := r.p
+	p.prodMut.Lock()
+	defer p.prodMut.Unlock()
+	if p.ioAddr == nil {
+		r.log(LogWarn, "class 1 connection without O->T listener")
+		r.ioFail(io, 0x0113)
+		return false
+	}
+	pt, ok := p.produced[strings.ToLower(r.ioTagName(connPath))]
+	if !ok {
+		r.log(LogDebug, "no produced tag in connection path")
+		r.ioFail(io, 0x0315) // invalid segment in connection path
+		return false
+	}
+	if pt.MaxConsumers > 0 && len(pt.conns) >= pt.MaxConsumers {
+		r.ioFail(io, 0x0113) // out of connections
+		return false
+	}
+	p.tMut.RLock()
+	ref, err := p.resolve(pt.path)
+	n := 0
+	if err == nil {
+		n = len(ref.data())
+	}
+	p.tMut.RUnlock()
+	if err != nil {
+		r.log(LogWarn, "produced tag", "tag", pt.Tag, "err", err)
+		r.ioFail(io, 0x0315)
+		return false
+	}
+	if io.size != n+2 { // sequence count and data
+		r.log(LogDebug, "invalid T->O size", "size", io.size, "want", n+2)
+		r.ioFail(io, 0x0128)
+		return false
+	}
+
+	var ip net.IP
+	switch a := r.remote.(type) {
+	case *net.TCPAddr:
+		ip = a.IP
+	case *net.UDPAddr:
+		ip = a.IP
+	}
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: ip, Port: p.IOConsumerPort})
+	if err != nil {
+		r.log(LogWarn, "class 1 connection", "err", err)
+		r.ioFail(io, 0x0113)
+		return false
+	}
+	rpi := time.Duration(io.rpi) * time.Microsecond
+	if rpi < time.Millisecond {
+		rpi = time.Millisecond
+	}
+	c := &ioConn{last: time.Now().UnixNano(), serial: io.serial, vendor: io.vendor, orig: io.orig, otID: io.otID,
+		timeout: io.timeout, stop: make(chan struct{})}
+	pt.conns[c] = struct{}{}
+	if p.ioConns == nil {
+		p.ioConns = make(map[uint32]*ioConn)
+	}
+	p.ioConns[io.otID] = c
+	r.log(LogInfo, "produced tag connected", "name", pt.Name, "consumer", conn.RemoteAddr(), "rpi", rpi, "timeout", io.timeout)
+	go p.produce(pt, c, conn, io.toID, rpi)
+	return true
+}
+
+// closeIO stops class 1 connection, reporting whether it was found.
+func (p *PLC) closeIO(serial uint16, vendor uint16, orig uint32) bool {
+	p.prodMut.Lock()
+	defer p.prodMut.Unlock()
+	for id, c := range p.ioConns {
+		if c.serial == serial && c.vendor == vendor && c.orig == orig {
+			close(c.stop)
+			delete(p.ioConns, id)
+			return true
+		}
+	}
+	return false
+}
+
+// serveIO receives O->T packets of class 1 connections, which keep them from timing out.
+func (p *PLC) serveIO(host string) error {
+	h, _, err := net.SplitHostPort(host)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.ParseIP(h), Port: p.IOPort})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	p.prodMut.Lock()
+	p.ioAddr = conn.LocalAddr().(*net.UDPAddr)
+	p.prodMut.Unlock()
+	defer func() {
+		p.prodMut.Lock()
+		p.ioAddr = nil
+		p.prodMut.Unlock()
+	}()
+
+	buf := make([]byte, 0x1000)
+	for {
+		conn.SetDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFromUDP(buf)
+		if e, ok := err.(net.Error); ok && e.Timeout() {
+			p.closeMut.RLock()
+			endP := p.closeI
+			p.closeMut.RUnlock()
+			if endP {
+				return nil
+			}
+		} else if err != nil {
+			return err
+		} else {
+			p.ioReceived(buf[:n])
+		}
+	}
+}
+
+// ioReceived notes O->T packet: item count, sequenced address item with connection ID, connected data item.
+func (p *PLC) ioReceived(b []byte) {
+	if len(b) < 14 || binary.LittleEndian.Uint16(b) == 0 || binary.LittleEndian.Uint16(b[2:]) != itSeqAddress {
+		return
+	}
+	p.prodMut.Lock()
+	c, ok := p.ioConns[binary.LittleEndian.Uint32(b[6:])]
+	p.prodMut.Unlock()
+	if ok {
+		atomic.StoreInt64(&c.last, time.Now().UnixNano())
+	}
+}
+
+// produce sends data of produced tag every rpi until the connection is closed or times out.
+func (p *PLC) produce(pt *producedTag, c *ioConn, conn *net.UDPConn, id uint32, rpi time.Duration) {
+	tick := time.NewTicker(rpi)
+	defer func() {
+		tick.Stop()
+		conn.Close()
+		p.prodMut.Lock()
+		delete(pt.conns, c)
+		if p.ioConns[c.otID] == c {
+			delete(p.ioConns, c.otID)
+		}
+		p.prodMut.Unlock()
+		p.log(LogInfo, "produced tag disconnected", "name", pt.Name, "consumer", conn.RemoteAddr())
+	}()
+	var (
+		seq uint32
+		buf bytes.Buffer
+	)
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-tick.C:
+		}
+		p.closeMut.RLock()
+		endP := p.closeI
+		p.closeMut.RUnlock()
+		if endP {
+			return
+		}
+		if c.timeout > 0 && time.Since(time.Unix(0, atomic.LoadInt64(&c.last))) > c.timeout {
+			p.log(LogInfo, "class 1 connection timed out", "name", pt.Name, "timeout", c.timeout)
+			return
+		}
+
+		p.tMut.RLock()
+		ref, err := p.resolve(pt.path)
+		if err == nil {
+			seq++
+			buf.Reset()
+			bwrite(&buf, uint16(2)) // ItemCount
+			bwrite(&buf, itemType{Type: itSeqAddress, Length: 8})
+			bwrite(&buf, id)
+			bwrite(&buf, seq)
+			bwrite(&buf, itemType{Type: itConnData, Length: uint16(2 + len(ref.data()))})
+			bwrite(&buf, uint16(seq))
+			buf.Write(ref.data())
+		}
+		p.tMut.RUnlock()
+		if err != nil {
+			p.log(LogWarn, "produced tag", "tag", pt.Tag, "err", err)
+			return
+		}
+		if _, err = conn.Write(buf.Bytes()); err != nil {
+			p.log(LogDebug, "produced tag send", "err", err)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package plcconnector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestProducedTag(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.NewTag(int32(42), "Counter")
+	p.NewTag(int32(0), "Other")
+	for _, tt := range []struct {
+		pt ProducedTag
+		ok bool
+	}{
+		{ProducedTag{Name: "Prod", Tag: "Counter", MaxConsumers: 1}, true},
+		{ProducedTag{Name: "prod", Tag: "Other"}, false},
+		{ProducedTag{Name: "Bit", Tag: "Other.1"}, false},
+		{ProducedTag{Name: "None", Tag: "none"}, false},
+		{ProducedTag{Tag: "Other"}, false},
+	} {
+		if err := p.AddProducedTag(tt.pt); (err == nil) != tt.ok {
+			t.Errorf("AddProducedTag(%+v): %v", tt.pt, err)
+		}
+	}
+
+	consumer, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer consumer.Close()
+	p.IOConsumerPort = consumer.LocalAddr().(*net.UDPAddr).Port
+	p.IOPort = 0
+
+	addr := freeAddr(t)
+	go p.Serve(addr)
+	defer p.Close()
+	var c *Client
+	for i := 0; i < 50; i++ {
+		if c, err = Connect(addr, -1); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.prodMut.Lock()
+	ioAddr := p.ioAddr
+	p.prodMut.Unlock()
+	if ioAddr == nil {
+		t.Fatal("no O->T listener")
+	}
+
+	forwardOpen := func(name string, size int, serial uint16) (int, []uint8) {
+		path := append([]uint8{0x01, 0x00}, constructPath([]pathEl{{typ: ansiExtended, txt: name}})...) // backplane, slot 0
+		c.writeData(forwardOpenData{
+			OTConnectionID:   1,
+			TOConnectionID:   0x1234,
+			ConnSerialNumber: serial,
+			VendorID:         1,
+			ConnTimeoutMult:  2, // 160 ms
+			OTRPI:            10000,
+			OTConnPar:        0x4002,
+			TORPI:            10000,
+			TOConnPar:        0x4000 | uint16(size),
+			TransportType:    0x01,
+			ConnPathSize:     uint8(len(path) / 2),
+		})
+		c.writeData(path)
+		status, d, _ := c.request(pathCIA(ConnManager, 1, -1, -1), ForwardOpen)
+		return status, d
+	}
+	tests := []struct {
+		name   string
+		size   int
+		status int
+		ext    uint16
+	}{
+		{"Other", 6, ConnFailure, 0x0315},
+		{"Prod", 4, ConnFailure, 0x0128},
+		{"Prod", 6, Success, 0},
+		{"Prod", 6, ConnFailure, 0x0113},
+	}
+	var otID uint32
+	for i, tt := range tests {
+		status, d := forwardOpen(tt.name, tt.size, uint16(i))
+		if status != tt.status || tt.ext != 0 && (len(d) != 12 || binary.LittleEndian.Uint16(d) != tt.ext || binary.LittleEndian.Uint16(d[2:]) != uint16(i)) {
+			t.Errorf("ForwardOpen(%s, %d) = 0x%X % X", tt.name, tt.size, status, d)
+		}
+		if status == Success && len(d) >= 4 {
+			otID = binary.LittleEndian.Uint32(d)
+		}
+	}
+
+	heartbeat := make(chan struct{})
+	go func() {
+		o, err := net.DialUDP("udp", nil, ioAddr)
+		if err != nil {
+			return
+		}
+		defer o.Close()
+		var buf bytes.Buffer
+		for seq := uint32(1); ; seq++ {
+			select {
+			case <-heartbeat:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+			buf.Reset()
+			bwrite(&buf, uint16(2))
+			bwrite(&buf, itemType{Type: itSeqAddress, Length: 8})
+			bwrite(&buf, otID)
+			bwrite(&buf, seq)
+			bwrite(&buf, itemType{Type: itConnData, Length: 2})
+			bwrite(&buf, uint16(seq))
+			o.Write(buf.Bytes())
+		}
+	}()
+	conns := func(want int, msg string) {
+		for i := 0; i < 100; i++ {
+			p.prodMut.Lock()
+			n := len(p.produced["prod"].conns)
+			p.prodMut.Unlock()
+			if n == want {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		t.Error(msg)
+	}
+
+	packet := func(want int32) {
+		consumer.SetReadDeadline(time.Now().Add(2 * time.Second))
+		buf := make([]uint8, 100)
+		for {
+			n, _, err := consumer.ReadFromUDP(buf)
+			if err != nil {
+				t.Fatalf("no packet with %d: %v", want, err)
+			}
+			var (
+				count uint16
+				addr  itemType
+				id    uint32
+				seq   uint32
+				data  itemType
+				seq16 uint16
+				v     int32
+			)
+			rd := bytes.NewReader(buf[:n])
+			for _, x := range []interface{}{&count, &addr, &id, &seq, &data, &seq16, &v} {
+				binary.Read(rd, binary.LittleEndian, x)
+			}
+			if count != 2 || addr.Type != itSeqAddress || id != 0x1234 || data.Type != itConnData || data.Length != 6 || uint16(seq) != seq16 {
+				t.Fatalf("packet % X", buf[:n])
+			}
+			if v == want {
+				return
+			}
+		}
+	}
+	packet(42)
+	p.SetValue("Counter", "43")
+	packet(43)
+
+	c.Close() // I/O connection outlives the session while O->T packets arrive
+	time.Sleep(300 * time.Millisecond)
+	p.SetValue("Counter", "44")
+	packet(44)
+	conns(1, "connection closed with session")
+
+	if c, err = Connect(addr, -1); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.writeData(forwardCloseData{ConnSerialNumber: 2, VendorID: 1, ConnPathSize: 0})
+	if _, _, err = c.request(pathCIA(ConnManager, 1, -1, -1), ForwardClose); err != nil {
+		t.Fatal(err)
+	}
+	conns(0, "connection not closed by ForwardClose")
+	close(heartbeat)
+
+	if status, d := forwardOpen("Prod", 6, 5); status != Success {
+		t.Errorf("ForwardOpen after close = 0x%X % X", status, d)
+	}
+	conns(1, "connection not opened")
+	conns(0, "connection without O->T packets not timed out")
+}
+
+func TestIOPortPerPLC(t *testing.T) {
+	for i := 0; i < 2; i++ {
+		p, err := Init(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.IOPort = 0
+		addr := freeAddr(t)
+		go p.Serve(addr)
+		var c *Client
+		for j := 0; j < 50; j++ {
+			if c, err = Connect(addr, -1); err == nil {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Close()
+		for j := 0; ; j++ {
+			p.prodMut.Lock()
+			ioAddr := p.ioAddr
+			p.prodMut.Unlock()
+			if ioAddr != nil {
+				break
+			}
+			if j == 50 {
+				t.Fatalf("PLC %d has no O->T listener", i)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		defer p.Close()
+	}
+}
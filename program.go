@@ -0,0 +1,185 @@
+package plcconnector
+
+import (
+	"errors"
+	"strings"
+)
+
+// TypeProgram is symbol type of Program:Name entries in controller scope.
+const TypeProgram = 0x1068
+
+// program is Logix program with its own tag namespace.
+type program struct {
+	name    string
+	in      *Instance // Program Object instance
+	sym     *Instance // controller scope symbol Program:name
+	symbols *Class    // program scope symbols
+}
+
+func newSymbolClass() *Class {
+	c := NewClass("Symbol", 8)
+	c.inst[0].SetAttrUINT(1, 4)
+	c.inst[0].attr[8] = TagUDINT(0, "Symbol UID")
+	return c
+}
+
+// splitScope splits lower case tag name into program name and name within program. Program is "" for controller scope tags.
+func splitScope(name string) (string, string) {
+	if !strings.HasPrefix(name, "program:") {
+		return "", name
+	}
+	i := strings.IndexByte(name, '.')
+	if i == -1 {
+		return "", name
+	}
+	return name[len("program:"):i], name[i+1:]
+}
+
+// symbolClass returns Symbol Object class holding tag of lower case name, or nil if its program does not exist.
+// Must be called with tMut locked.
+func (p *PLC) symbolClass(name string) *Class {
+	prog, _ := splitScope(name)
+	if prog == "" {
+		return p.symbols
+	}
+	if pr, ok := p.programs[prog]; ok {
+		return pr.symbols
+	}
+	return nil
+}
+
+// newProgram adds program without checking its name. Must be called with tMut locked.
+func (p *PLC) newProgram(name string) *program {
+	pr := &program{name: name, in: NewInstance(1), symbols: newSymbolClass()}
+	pr.in.attr[1] = TagString(name, "Program Name")
+	c := p.Class[ProgramClass]
+	c.SetInstance(c.lastInst+1, pr.in)
+
+	pr.sym = symbolInstance(&Tag{Name: "Program:" + name})
+	pr.sym.attr[2] = TagUINT(TypeProgram, "SymbolType")
+	p.symbols.SetInstance(p.symbols.lastInst+1, pr.sym)
+	p.tagCRC(&Tag{}, "program:"+strings.ToLower(name), 1)
+	p.programs[strings.ToLower(name)] = pr
+	return pr
+}
+
+// AddProgram adds program. Its tags are named Program:name.tag, tags of not existing programs add the program automatically.
+func (p *PLC) AddProgram(name string) error {
+	if name == "" || strings.ContainsAny(name, ".:[] ") {
+		return errors.New("invalid program name " + name)
+	}
+	p.tMut.Lock()
+	defer p.tMut.Unlock()
+	if _, ok := p.programs[strings.ToLower(name)]; ok {
+		return errors.New("program " + name + " already exists")
+	}
+	p.newProgram(name)
+	return nil
+}
+
+// addPrograms adds programs of imported project, skipping existing ones.
+func (p *PLC) addPrograms(names []string) error {
+	for _, n := range names {
+		p.tMut.RLock()
+		_, ok := p.programs[strings.ToLower(n)]
+		p.tMut.RUnlock()
+		if ok {
+			continue
+		}
+		if err := p.AddProgram(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Programs returns names of programs.
+func (p *PLC) Programs() []string {
+	_, ins := p.GetClassInstancesList(ProgramClass, 1, 0)
+	names := make([]string, 0, len(ins))
+	for _, in := range ins {
+		names = append(names, in.attr[1].DataString())
+	}
+	return names
+}
+
+// symbolClasses returns Symbol Object classes of controller and of all programs. Must be called with tMut locked.
+func (p *PLC) symbolClasses() []*Class {
+	cs := []*Class{p.symbols}
+	for _, pr := range p.programs {
+		cs = append(cs, pr.symbols)
+	}
+	return cs
+}
+
+// programName returns name of program in path segment Program:Name, matched case insensitively like tag names.
+func programName(seg string) (string, bool) {
+	const prefix = "Program:"
+	if len(seg) < len(prefix) || !strings.EqualFold(seg[:len(prefix)], prefix) {
+		return "", false
+	}
+	return seg[len(prefix):], true
+}
+
+// tagName returns name of tag addressed by beginning of path, by name or by symbol instance, optionally in program scope,
+// and number of used path elements. Name is "" if there is no such tag. Must be called with tMut locked.
+func (p *PLC) tagName(path []pathEl) (string, int) {
+	symbol := func(c *Class, pth []pathEl) string {
+		if len(pth) < 2 || pth[0].typ != pathClass || pth[0].val != SymbolClass || pth[1].typ != pathInstance {
+			return ""
+		}
+		c.m.RLock()
+		defer c.m.RUnlock()
+		if in, ok := c.inst[pth[1].val]; ok && pth[1].val != 0 {
+			return in.attr[1].DataString()
+		}
+		return ""
+	}
+	if len(path) == 0 {
+		return "", 0
+	}
+	if path[0].typ != ansiExtended {
+		return symbol(p.symbols, path), 2
+	}
+	prog, ok := programName(path[0].txt)
+	if !ok {
+		return path[0].txt, 1
+	}
+	if len(path) > 1 && path[1].typ == ansiExtended {
+		return path[0].txt + "." + path[1].txt, 2
+	}
+	pr, ok := p.programs[strings.ToLower(prog)]
+	if !ok {
+		return "", 0
+	}
+	if n := symbol(pr.symbols, path[1:]); n != "" {
+		return path[0].txt + "." + n, 3
+	}
+	return "", 0
+}
+
+// scopeSymbols returns Symbol Object class addressed by path, controller scope or Program:Name scope, and instance number in it.
+func (p *PLC) scopeSymbols(path []pathEl) (*Class, int) {
+	c := p.symbols
+	if len(path) > 0 && path[0].typ == ansiExtended {
+		prog, ok := programName(path[0].txt)
+		if !ok {
+			return nil, 0
+		}
+		p.tMut.RLock()
+		pr, ok := p.programs[strings.ToLower(prog)]
+		p.tMut.RUnlock()
+		if !ok {
+			return nil, 0
+		}
+		c = pr.symbols
+		path = path[1:]
+	}
+	if len(path) == 0 || path[0].typ != pathClass || path[0].val != SymbolClass {
+		return nil, 0
+	}
+	if len(path) > 1 && path[1].typ == pathInstance {
+		return c, path[1].val
+	}
+	return c, 0
+}
@@ -0,0 +1,97 @@
+package plcconnector
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPrograms(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name string
+		ok   bool
+	}{
+		{"Main", true},
+		{"main", false},
+		{"", false},
+		{"A.B", false},
+	} {
+		if err := p.AddProgram(tt.name); (err == nil) != tt.ok {
+			t.Errorf("AddProgram(%q): %v", tt.name, err)
+		}
+	}
+	p.NewTag(int32(1), "x")
+	p.NewTag(int16(7), "Program:Main.x")
+	p.NewTag(int16(8), "Program:Aux.y")
+	if got := p.Programs(); !reflect.DeepEqual(got, []string{"Main", "Aux"}) {
+		t.Errorf("Programs() = %v", got)
+	}
+	if p.RenameTag("Program:Main.x", "Program:Aux.x") == nil {
+		t.Error("tag moved to another program")
+	}
+	if err = p.RenameTag("Program:Aux.y", "Program:Aux.z"); err != nil {
+		t.Error(err)
+	}
+
+	addr := freeAddr(t)
+	go p.Serve(addr)
+	defer p.Close()
+	var c *Client
+	for i := 0; i < 50; i++ {
+		if c, err = Connect(addr, -1); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	syms, err := c.ListTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := make(map[string]int)
+	for _, s := range syms {
+		types[s.Name] = s.Type
+	}
+	want := map[string]int{"x": TypeDINT, "Program:Main": TypeProgram, "Program:Aux": TypeProgram}
+	if !reflect.DeepEqual(types, want) {
+		t.Errorf("ListTags() = %v, want %v", types, want)
+	}
+
+	tests := []struct {
+		program string
+		name    string
+		value   []uint8
+		prefix  string
+	}{
+		{"Main", "x", []uint8{7, 0}, "Program:"},
+		{"Aux", "z", []uint8{8, 0}, "PROGRAM:"},
+	}
+	for _, tt := range tests {
+		syms, err := c.ListProgramTags(tt.program)
+		if err != nil || len(syms) != 1 || syms[0].Name != tt.name || syms[0].Type != TypeINT {
+			t.Errorf("ListProgramTags(%s) = %+v, %v", tt.program, syms, err)
+			continue
+		}
+		path := constructPath([]pathEl{{typ: ansiExtended, txt: tt.prefix + tt.program}})
+		c.writeData(uint16(1))
+		_, d, err := c.request(append(path, pathCIA(SymbolClass, syms[0].Instance, -1, -1)...), ReadTag)
+		if err != nil || !reflect.DeepEqual(d[2:], tt.value) {
+			t.Errorf("%s: read by instance % X, %v", tt.program, d, err)
+		}
+		tg, err := c.ReadTag(tt.prefix+tt.program+"."+tt.name, 1)
+		if err != nil || !reflect.DeepEqual(tg.DataBytes(), tt.value) {
+			t.Errorf("%s: read by name %v, %v", tt.program, tg, err)
+		}
+	}
+	if _, err = c.ListProgramTags("None"); err == nil {
+		t.Error("listed tags of missing program")
+	}
+}
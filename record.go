@@ -0,0 +1,410 @@
+package plcconnector
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const encHeadSize = 24
+
+// Frame is encapsulation frame of recorded TCP session.
+type Frame struct {
+	Session  int           `json:"session"` // numbered from 1 in order of connecting
+	Time     time.Duration `json:"time"`    // since start of recording
+	Response bool          `json:"response"`
+	Data     []byte        `json:"data"`
+}
+
+// Recorder writes frames of all TCP sessions as JSON lines.
+type Recorder struct {
+	m        sync.Mutex
+	enc      *json.Encoder
+	err      error
+	start    time.Time
+	sessions int
+}
+
+// NewRecorder returns Recorder writing to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w), start: time.Now()}
+}
+
+// Err returns first write error.
+func (rec *Recorder) Err() error {
+	rec.m.Lock()
+	defer rec.m.Unlock()
+	return rec.err
+}
+
+func (rec *Recorder) frame(session int, response bool, data []byte) {
+	rec.m.Lock()
+	defer rec.m.Unlock()
+	if rec.err == nil {
+		rec.err = rec.enc.Encode(Frame{Session: session, Time: time.Since(rec.start), Response: response, Data: data})
+	}
+}
+
+// frameSplitter splits byte stream into encapsulation frames.
+type frameSplitter struct {
+	buf []byte
+}
+
+func (fs *frameSplitter) add(b []byte) [][]byte {
+	var frames [][]byte
+	fs.buf = append(fs.buf, b...)
+	for len(fs.buf) >= encHeadSize {
+		l := encHeadSize + int(binary.LittleEndian.Uint16(fs.buf[2:]))
+		if len(fs.buf) < l {
+			break
+		}
+		frames = append(frames, append([]byte(nil), fs.buf[:l]...))
+		fs.buf = fs.buf[l:]
+	}
+	return frames
+}
+
+// recordConn records frames of the connection.
+type recordConn struct {
+	net.Conn
+	rec     *Recorder
+	session int
+	in, out frameSplitter
+	m       sync.Mutex
+}
+
+func (rec *Recorder) conn(conn net.Conn) *recordConn {
+	rec.m.Lock()
+	rec.sessions++
+	s := rec.sessions
+	rec.m.Unlock()
+	return &recordConn{Conn: conn, rec: rec, session: s}
+}
+
+func (rc *recordConn) Read(b []byte) (int, error) {
+	n, err := rc.Conn.Read(b)
+	rc.m.Lock()
+	for _, f := range rc.in.add(b[:n]) {
+		rc.rec.frame(rc.session, false, f)
+	}
+	rc.m.Unlock()
+	return n, err
+}
+
+func (rc *recordConn) Write(b []byte) (int, error) {
+	n, err := rc.Conn.Write(b)
+	rc.m.Lock()
+	for _, f := range rc.out.add(b[:n]) {
+		rc.rec.frame(rc.session, true, f)
+	}
+	rc.m.Unlock()
+	return n, err
+}
+
+// RecordTo starts recording TCP sessions accepted from now on. Nil rec stops recording.
+func (p *PLC) RecordTo(rec *Recorder) {
+	p.capMut.Lock()
+	p.recorder = rec
+	p.capMut.Unlock()
+}
+
+// ReadFrames reads frames written by Recorder.
+func ReadFrames(r io.Reader) ([]Frame, error) {
+	var frames []Frame
+	dec := json.NewDecoder(r)
+	for {
+		var f Frame
+		err := dec.Decode(&f)
+		if err == io.EOF {
+			return frames, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if len(f.Data) < encHeadSize {
+			return nil, fmt.Errorf("frame %d: too short", len(frames))
+		}
+		frames = append(frames, f)
+	}
+}
+
+// Mismatch is response which differs from recorded one.
+type Mismatch struct {
+	Frame   int // index of recorded response
+	Session int
+	Want    []byte
+	Got     []byte // nil if no response was received
+}
+
+func (m Mismatch) String() string {
+	i := 0
+	for i < len(m.Want) && i < len(m.Got) && m.Want[i] == m.Got[i] {
+		i++
+	}
+	return fmt.Sprintf("frame %d (session %d): differs at byte %d\n want % X\n  got % X", m.Frame, m.Session, i, m.Want, m.Got)
+}
+
+// ServiceReport summarizes replayed requests of one encapsulation command and CIP service.
+type ServiceReport struct {
+	Command    uint16
+	Service    uint8 // CIP service, embedded one for Unconnected Send; 0 for commands without CIP
+	Requests   int
+	Mismatches []Mismatch
+}
+
+// ReplayReport is result of replaying recorded sessions.
+type ReplayReport struct {
+	Services []ServiceReport // sorted by command and service
+}
+
+// Ok reports whether all responses matched.
+func (r *ReplayReport) Ok() bool {
+	for _, s := range r.Services {
+		if len(s.Mismatches) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *ReplayReport) String() string {
+	var b strings.Builder
+	for _, s := range r.Services {
+		fmt.Fprintf(&b, "command 0x%02X service 0x%02X: %d requests, %d mismatches\n", s.Command, s.Service, s.Requests, len(s.Mismatches))
+		for _, m := range s.Mismatches {
+			b.WriteString(m.String())
+			b.WriteRune('\n')
+		}
+	}
+	return b.String()
+}
+
+func (r *ReplayReport) service(cmd uint16, svc uint8) *ServiceReport {
+	for i := range r.Services {
+		if r.Services[i].Command == cmd && r.Services[i].Service == svc {
+			return &r.Services[i]
+		}
+	}
+	r.Services = append(r.Services, ServiceReport{Command: cmd, Service: svc})
+	return &r.Services[len(r.Services)-1]
+}
+
+// cipOffset returns offset of CIP message in SendRRData/SendUnitData frame or -1.
+func cipOffset(f []byte) int {
+	cmd := binary.LittleEndian.Uint16(f)
+	if cmd != ecSendRRData && cmd != ecSendUnitData || len(f) < encHeadSize+8 {
+		return -1
+	}
+	o := encHeadSize + 8
+	for i := 0; i < 2; i++ {
+		if len(f) < o+4 {
+			return -1
+		}
+		typ, l := binary.LittleEndian.Uint16(f[o:]), int(binary.LittleEndian.Uint16(f[o+2:]))
+		o += 4
+		if i == 0 {
+			o += l
+		} else if typ == itConnData {
+			o += 2 // sequence count
+		}
+	}
+	if len(f) < o+2 {
+		return -1
+	}
+	return o
+}
+
+// requestService returns CIP service of request, looking into Unconnected Send.
+func requestService(f []byte) uint8 {
+	o := cipOffset(f)
+	if o < 0 {
+		return 0
+	}
+	svc := f[o]
+	if svc == UnconnectedSend {
+		o += 2 + int(f[o+1])*2 + 4
+		if o < len(f) {
+			svc = f[o]
+		}
+	}
+	return svc
+}
+
+// otConnID returns offset of O->T connection ID in successful Forward Open response or -1.
+func otConnID(f []byte) int {
+	o := cipOffset(f)
+	if o < 0 || len(f) < o+4 || f[o] != ForwardOpen+128 && f[o] != LargeForwOpen+128 || f[o+2] != Success {
+		return -1
+	}
+	o += 4 + int(f[o+3])*2
+	if len(f) < o+4 {
+		return -1
+	}
+	return o
+}
+
+type replaySession struct {
+	conn   net.Conn
+	rd     *bufio.Reader
+	handle uint32
+	connID map[uint32]uint32 // recorded O->T connection ID to replayed one
+}
+
+type replayer struct {
+	frames []Frame
+	pace   bool
+	dial   func() (net.Conn, error)
+	shared bool // sessions go over one registered connection
+	handle uint32
+	rd     *bufio.Reader
+}
+
+func (rp *replayer) run() (*ReplayReport, error) {
+	// index of response to each request
+	resp := make([]int, len(rp.frames))
+	last := make(map[int]int)
+	for i, f := range rp.frames {
+		resp[i] = -1
+		if f.Response {
+			if j, ok := last[f.Session]; ok && resp[j] == -1 {
+				resp[j] = i
+			}
+		} else {
+			last[f.Session] = i
+		}
+	}
+
+	rep := &ReplayReport{}
+	sessions := make(map[int]*replaySession)
+	var shared *replaySession
+	defer func() {
+		if !rp.shared {
+			for _, s := range sessions {
+				s.conn.Close()
+			}
+		}
+	}()
+	start := time.Now()
+	for i, f := range rp.frames {
+		if f.Response {
+			continue
+		}
+		cmd := binary.LittleEndian.Uint16(f.Data)
+		if rp.shared && (cmd == ecRegisterSession || cmd == ecUnRegisterSession) {
+			continue
+		}
+		s := sessions[f.Session]
+		if s == nil {
+			if rp.shared && shared != nil {
+				s = shared
+			} else {
+				conn, err := rp.dial()
+				if err != nil {
+					return nil, err
+				}
+				rd := rp.rd
+				if rd == nil {
+					rd = bufio.NewReader(conn)
+				}
+				s = &replaySession{conn: conn, rd: rd, handle: rp.handle, connID: make(map[uint32]uint32)}
+				shared = s
+			}
+			sessions[f.Session] = s
+		}
+		if rp.pace {
+			time.Sleep(f.Time - time.Since(start))
+		}
+
+		req := append([]byte(nil), f.Data...)
+		if cmd != ecRegisterSession {
+			binary.LittleEndian.PutUint32(req[4:], s.handle)
+		}
+		if cmd == ecSendUnitData && len(req) >= encHeadSize+16 && binary.LittleEndian.Uint16(req[encHeadSize+8:]) == itConnAddress {
+			if id, ok := s.connID[binary.LittleEndian.Uint32(req[encHeadSize+12:])]; ok {
+				binary.LittleEndian.PutUint32(req[encHeadSize+12:], id)
+			}
+		}
+		sr := rep.service(cmd, requestService(req))
+		sr.Requests++
+
+		s.conn.SetDeadline(time.Now().Add(5 * time.Second))
+		_, err := s.conn.Write(req)
+		if err != nil {
+			return nil, err
+		}
+		j := resp[i]
+		if j < 0 {
+			continue
+		}
+		want := append([]byte(nil), rp.frames[j].Data...)
+		got, err := readFrame(s.rd)
+		if err != nil {
+			sr.Mismatches = append(sr.Mismatches, Mismatch{Frame: j, Session: f.Session, Want: rp.frames[j].Data})
+			continue
+		}
+		if cmd == ecRegisterSession {
+			s.handle = binary.LittleEndian.Uint32(got[4:])
+		}
+		// session handle and O->T connection ID are chosen by target
+		for _, b := range [][]byte{want, got} {
+			binary.LittleEndian.PutUint32(b[4:], 0)
+		}
+		if o := otConnID(want); o >= 0 {
+			if g := otConnID(got); g == o {
+				s.connID[binary.LittleEndian.Uint32(want[o:])] = binary.LittleEndian.Uint32(got[o:])
+				binary.LittleEndian.PutUint32(want[o:], 0)
+				binary.LittleEndian.PutUint32(got[o:], 0)
+			}
+		}
+		if !bytes.Equal(want, got) {
+			sr.Mismatches = append(sr.Mismatches, Mismatch{Frame: j, Session: f.Session, Want: rp.frames[j].Data, Got: got})
+		}
+	}
+	sort.Slice(rep.Services, func(i, j int) bool {
+		a, b := rep.Services[i], rep.Services[j]
+		return a.Command < b.Command || a.Command == b.Command && a.Service < b.Service
+	})
+	return rep, nil
+}
+
+func readFrame(rd io.Reader) ([]byte, error) {
+	f := make([]byte, encHeadSize)
+	_, err := io.ReadFull(rd, f)
+	if err != nil {
+		return nil, err
+	}
+	f = append(f, make([]byte, binary.LittleEndian.Uint16(f[2:]))...)
+	_, err = io.ReadFull(rd, f[encHeadSize:])
+	return f, err
+}
+
+// Replay sends recorded requests to p, each session over its own in-memory connection, and compares responses.
+// If pace is set, recorded delays between requests are kept.
+func (p *PLC) Replay(frames []Frame, pace bool) (*ReplayReport, error) {
+	rp := replayer{frames: frames, pace: pace, dial: func() (net.Conn, error) {
+		c, s := net.Pipe()
+		go p.handleRequest(s)
+		return c, nil
+	}}
+	return rp.run()
+}
+
+// Replay sends recorded requests over the connection of c and compares responses.
+// Session registration frames are skipped, all sessions use session of c.
+func (c *Client) Replay(frames []Frame, pace bool) (*ReplayReport, error) {
+	if c.rd.Buffered() > 0 {
+		return nil, errors.New("unread data in connection")
+	}
+	rp := replayer{frames: frames, pace: pace, shared: true, handle: c.handle, rd: c.rd, dial: func() (net.Conn, error) {
+		return c.c, nil
+	}}
+	return rp.run()
+}
@@ -0,0 +1,96 @@
+package plcconnector
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestRecordReplay(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.NewTag(int16(7), "a")
+	p.NewTag([]int32{1, 2, 3}, "b")
+	var buf syncBuffer
+	p.RecordTo(NewRecorder(&buf))
+	addr := freeAddr(t)
+	go p.Serve(addr)
+	defer p.Close()
+
+	var c *Client
+	for i := 0; i < 50; i++ {
+		if c, err = Connect(addr, -1); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.ReadTag("a", 1)
+	c.ReadTag("b", 3)
+	c.ReadTag("nope", 1)
+	c.GetAttributesAll(IdentityClass, 1)
+	c.Close()
+	p.RecordTo(nil)
+
+	var frames []Frame
+	for i := 0; i < 50; i++ {
+		if frames, err = ReadFrames(bytes.NewReader(buf.Bytes())); err == nil && len(frames) == 13 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(frames) != 13 || frames[0].Session != 1 || frames[0].Response || !frames[1].Response {
+		t.Fatalf("frames %+v, %v", frames, err)
+	}
+
+	rep, err := p.Replay(frames, false)
+	if err != nil || !rep.Ok() {
+		t.Fatalf("replay %v\n%s", err, rep)
+	}
+	if s := rep.service(ecSendRRData, ReadTag); s.Requests != 3 {
+		t.Errorf("ReadTag requests %d", s.Requests)
+	}
+
+	p.UpdateTag("b", 1, []uint8{9, 0, 0, 0})
+	rep, err = p.Replay(frames, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range rep.Services {
+		want := 0
+		if s.Command == ecSendRRData && s.Service == ReadTag {
+			want = 1
+		}
+		if len(s.Mismatches) != want {
+			t.Errorf("command 0x%02X service 0x%02X: %d mismatches", s.Command, s.Service, len(s.Mismatches))
+		}
+	}
+
+	if c, err = Connect(addr, -1); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	rep, err = c.Replay(frames, false)
+	if err != nil || len(rep.Services) != 3 || len(rep.Services[2].Mismatches) != 1 {
+		t.Fatalf("client replay %v\n%s", err, rep)
+	}
+	if _, err = c.ReadTag("a", 1); err != nil {
+		t.Error("client unusable after replay:", err)
+	}
+}
+
+func TestOtConnIDTruncated(t *testing.T) {
+	f := make([]byte, encHeadSize+8)
+	f[0] = ecSendRRData
+	f = append(f, 0, 0, 0, 0, 0xB2, 0, 3, 0)   // null address, unconnected data items
+	f = append(f, ForwardOpen+128, 0, Success) // reply cut before additional status size
+	for n := encHeadSize + 8; n <= len(f); n++ {
+		if o := otConnID(f[:n]); o != -1 {
+			t.Errorf("otConnID of %d bytes = %d", n, o)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package plcconnector
+
+import "sort"
+
+// sameLayout reports whether data of tag a can be kept in tag b.
+func sameLayout(a, b *Tag) bool {
+	if a.Type != b.Type || a.Dim != b.Dim || len(a.data) != len(b.data) {
+		return false
+	}
+	return a.st == nil || b.st != nil && a.st.n == b.st.n && a.st.l == b.st.l
+}
+
+// ReloadTags replaces tags and data types of p by those of src, e.g. PLC initialized from changed project.
+// Tags of unchanged name, type and dimensions keep their values and symbol instances, other tags have values from src.
+// TagCRC and UDTCRC attributes of class 0xAC are taken from src, so Logix clients notice the change and browse again,
+// while connected sessions stay up. src must not be used afterwards.
+func (p *PLC) ReloadTags(src *PLC) {
+	src.tMut.RLock()
+	defer src.tMut.RUnlock()
+	p.tMut.Lock()
+	defer p.tMut.Unlock()
+
+	src.template.m.RLock()
+	p.template.setInstances(src.template.inst)
+	src.template.m.RUnlock()
+	p.tids = src.tids
+	p.tidLast = src.tidLast
+
+	order := make(map[*Instance]int) // src instance numbers
+	for _, c := range src.symbolClasses() {
+		c.m.RLock()
+		for no, in := range c.inst {
+			order[in] = no
+		}
+		c.m.RUnlock()
+	}
+
+	progIDs := newInstanceIDs(p.Class[ProgramClass])
+	ctl := newInstanceIDs(p.symbols)
+	scopes := map[string]*instanceIDs{"": ctl}
+	progs := make(map[string]*program, len(src.programs))
+	pnames := make([]string, 0, len(src.programs))
+	for n := range src.programs {
+		pnames = append(pnames, n)
+	}
+	sort.Slice(pnames, func(i, j int) bool { return order[src.programs[pnames[i]].sym] < order[src.programs[pnames[j]].sym] })
+	for _, n := range pnames {
+		pr, ok := p.programs[n]
+		if !ok {
+			pr = src.programs[n]
+			pr.symbols = newSymbolClass()
+			progIDs.add(nil, pr.in)
+			ctl.add(nil, pr.sym)
+		} else {
+			progIDs.add(pr.in, pr.in)
+			ctl.add(pr.sym, pr.sym)
+		}
+		progs[n] = pr
+		scopes[n] = newInstanceIDs(pr.symbols)
+	}
+
+	names := make([]string, 0, len(src.tags))
+	for n := range src.tags {
+		names = append(names, n)
+	}
+	sort.Slice(names, func(i, j int) bool { return order[src.tags[names[i]].in] < order[src.tags[names[j]].in] })
+
+	kept := 0
+	for _, n := range names {
+		t := src.tags[n]
+		prog, _ := splitScope(n)
+		var oldIn *Instance
+		old, ok := p.tags[n]
+		if ok {
+			oldIn = old.in
+		}
+		if scopes[prog].add(oldIn, t.in) && sameLayout(old, t) {
+			copy(t.data, old.data)
+			kept++
+		}
+	}
+	p.Class[ProgramClass].setInstances(progIDs.inst)
+	for n, ids := range scopes {
+		if n == "" {
+			p.symbols.setInstances(ids.inst)
+		} else {
+			progs[n].symbols.setInstances(ids.inst)
+		}
+	}
+	p.programs = progs
+	removed := 0
+	for n := range p.tags {
+		if _, ok := src.tags[n]; !ok {
+			removed++
+		}
+	}
+	p.tags = src.tags
+
+	from, to := src.Class[0xAC].inst[1], p.Class[0xAC].inst[1]
+	from.m.RLock()
+	tagCRC, udtCRC := from.attr[3].DataDINT()[0], from.attr[4].DataDINT()[0]
+	from.m.RUnlock()
+	to.SetAttrDINT(3, tagCRC)
+	to.SetAttrDINT(4, udtCRC)
+	p.symbols.inst[0].SetAttrUDINT(8, uint32(tagCRC))
+
+	p.log(LogInfo, "tags reloaded", "tags", len(names), "kept", kept, "removed", removed, "templates", len(p.tids))
+}
+
+// instanceIDs assigns numbers to instances of class, keeping numbers of already existing instances.
+type instanceIDs struct {
+	ids  map[*Instance]int
+	next int
+	inst map[int]*Instance
+}
+
+func newInstanceIDs(c *Class) *instanceIDs {
+	a := &instanceIDs{ids: make(map[*Instance]int), inst: make(map[int]*Instance)}
+	c.m.RLock()
+	for no, in := range c.inst {
+		if no != 0 {
+			a.ids[in] = no
+		}
+	}
+	a.next = c.lastInst + 1
+	c.m.RUnlock()
+	return a
+}
+
+// add adds instance in, taking number of old if it exists. It reports whether the number was kept.
+func (a *instanceIDs) add(old, in *Instance) bool {
+	if no, ok := a.ids[old]; ok && old != nil {
+		a.inst[no] = in
+		return true
+	}
+	a.inst[a.next] = in
+	a.next++
+	return false
+}
@@ -0,0 +1,138 @@
+package plcconnector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReloadTags(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.NewUDT("DATATYPE MOTOR DINT Speed; END_DATATYPE")
+	p.CreateTag("MOTOR", "m")
+	p.NewTag(int16(5), "a")
+	p.NewTag(int32(6), "b")
+	p.NewTag(int32(7), "gone")
+	p.NewTag(int16(9), "Program:Main.s")
+	p.SetValue("m.Speed", "8")
+	addr := freeAddr(t)
+	go p.Serve(addr)
+	defer p.Close()
+
+	var c *Client
+	for i := 0; i < 50; i++ {
+		if c, err = Connect(addr, -1); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	crc := func() int32 {
+		d, err := c.GetAttributeSingle(0xAC, 1, 3)
+		if err != nil || len(d) != 4 {
+			t.Fatalf("TagCRC %v", err)
+		}
+		return int32(d[0]) | int32(d[1])<<8 | int32(d[2])<<16 | int32(d[3])<<24
+	}
+	symbols := func() map[string]SymbolInfo {
+		syms, err := c.ListTags()
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := make(map[string]SymbolInfo)
+		for _, s := range syms {
+			m[s.Name] = s
+		}
+		return m
+	}
+	before, crc1 := symbols(), crc()
+
+	src, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.NewUDT("DATATYPE MOTOR DINT Speed; REAL Current; END_DATATYPE")
+	src.CreateTag("MOTOR", "m")
+	src.NewTag(int16(0), "a")
+	src.NewTag(float32(1.5), "b")
+	src.NewTag([]int16{1, 2}, "new")
+	src.NewTag(int16(0), "Program:Main.s")
+	p.ReloadTags(src)
+
+	after := symbols()
+	if len(after) != 5 || after["gone"].Name != "" {
+		t.Fatalf("symbols %+v", after)
+	}
+	for _, n := range []string{"a", "b", "m", "Program:Main"} {
+		if after[n].Instance != before[n].Instance {
+			t.Errorf("%s: instance %d, was %d", n, after[n].Instance, before[n].Instance)
+		}
+		if after["new"].Instance <= before[n].Instance {
+			t.Errorf("new tag reuses instance %d", after["new"].Instance)
+		}
+	}
+	if crc() == crc1 {
+		t.Error("TagCRC not changed")
+	}
+
+	tests := []struct {
+		path string
+		typ  int
+		want string
+	}{
+		{"a", TypeINT, "0500"},
+		{"b", TypeREAL, "0000C03F"},
+		{"new", TypeINT, "01000200"},
+		{"m.Speed", TypeDINT, "00000000"},
+		{"Program:Main.s", TypeINT, "0900"},
+	}
+	for _, tt := range tests {
+		n := 1
+		if tt.path == "new" {
+			n = 2
+		}
+		tg, err := c.ReadTag(tt.path, n)
+		if err != nil || tg.Type != tt.typ || hexBytes(tg.DataBytes()) != tt.want {
+			t.Errorf("%s: %+v %v", tt.path, tg, err)
+		}
+	}
+	tp, err := c.ReadTemplate(after["m"].Type & TypeType)
+	if err != nil || len(tp.Members) != 2 || tp.Members[1].Name != "Current" {
+		t.Errorf("template %+v %v", tp, err)
+	}
+}
+
+func hexBytes(b []byte) string {
+	const digits = "0123456789ABCDEF"
+	s := make([]byte, 0, 2*len(b))
+	for _, x := range b {
+		s = append(s, digits[x>>4], digits[x&15])
+	}
+	return string(s)
+}
+
+func TestReloadInstanceNotReused(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.NewTag(int16(5), "a")
+	p.NewTag(int32(7), "gone")
+	gone := p.symbols.instanceNo(p.tags["gone"].in)
+
+	src, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.NewTag(int16(0), "a")
+	p.ReloadTags(src)
+	p.NewTag(int32(1), "later")
+	if in := p.symbols.instanceNo(p.tags["later"].in); in <= gone {
+		t.Errorf("tag added after reload has instance %d of removed tag %d", in, gone)
+	}
+}
@@ -0,0 +1,326 @@
+package plcconnector
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GeneratorKind is waveform of Generator.
+type GeneratorKind string
+
+// Generator kinds.
+const (
+	GenRamp       GeneratorKind = "ramp"       // Offset to Offset+Amplitude during Period, then again
+	GenSine       GeneratorKind = "sine"       // Offset + Amplitude*sin, one cycle per Period
+	GenSquare     GeneratorKind = "square"     // Offset+Amplitude in first half of Period, Offset-Amplitude in second
+	GenRandomWalk GeneratorKind = "randomWalk" // starts at Offset, moves by random step up to Amplitude every Period
+	GenCounter    GeneratorKind = "counter"    // Offset + number of Periods, modulo Amplitude if set
+	GenStates     GeneratorKind = "states"     // steps through States every Period
+)
+
+// Generator drives value of numeric or BOOL tag element. BOOL is set when value >= 0.5.
+type Generator struct {
+	Kind      GeneratorKind `json:"kind"`
+	Period    time.Duration `json:"period"`
+	Amplitude float64       `json:"amplitude,omitempty"`
+	Offset    float64       `json:"offset,omitempty"`
+	States    []float64     `json:"states,omitempty"`
+	Rate      time.Duration `json:"rate,omitempty"` // update interval, default depends on Kind
+}
+
+func (g Generator) rate() time.Duration {
+	if g.Rate > 0 {
+		return g.Rate
+	}
+	switch g.Kind {
+	case GenRamp, GenSine:
+		if g.Period/20 < 100*time.Millisecond {
+			return g.Period / 20
+		}
+		return 100 * time.Millisecond
+	case GenSquare:
+		return g.Period / 2
+	}
+	return g.Period
+}
+
+// at returns value after elapsed time. Random walk keeps its state in v.
+func (g Generator) at(elapsed time.Duration, v *float64) float64 {
+	phase := float64(elapsed%g.Period) / float64(g.Period)
+	n := int64(elapsed / g.Period)
+	switch g.Kind {
+	case GenRamp:
+		return g.Offset + g.Amplitude*phase
+	case GenSine:
+		return g.Offset + g.Amplitude*math.Sin(2*math.Pi*phase)
+	case GenSquare:
+		if phase < 0.5 {
+			return g.Offset + g.Amplitude
+		}
+		return g.Offset - g.Amplitude
+	case GenRandomWalk:
+		if elapsed > 0 {
+			*v += (rand.Float64()*2 - 1) * g.Amplitude
+		} else {
+			*v = g.Offset
+		}
+		return *v
+	case GenCounter:
+		if a := int64(g.Amplitude); a > 0 {
+			n %= a
+		}
+		return g.Offset + float64(n)
+	default:
+		return g.States[n%int64(len(g.States))]
+	}
+}
+
+func (g Generator) check() error {
+	switch g.Kind {
+	case GenRamp, GenSine, GenSquare, GenRandomWalk, GenCounter:
+	case GenStates:
+		if len(g.States) == 0 {
+			return errors.New("no states")
+		}
+	default:
+		return errors.New("unknown generator " + string(g.Kind))
+	}
+	if g.Period <= 0 {
+		return errors.New("period must be positive")
+	}
+	if g.rate() <= 0 {
+		return errors.New("rate must be positive")
+	}
+	return nil
+}
+
+// setNumber stores v in element t of numeric or BOOL type, rounding and clamping integers.
+func setNumber(t Tag, data []uint8, bit int, v float64) error {
+	if bit >= 0 {
+		if v >= 0.5 {
+			data[0] |= 1 << uint(bit)
+		} else {
+			data[0] &^= 1 << uint(bit)
+		}
+		return nil
+	}
+	if t.Dim[0] > 0 || t.Type >= TypeStructHead {
+		return errors.New("generator needs numeric or BOOL element, not " + t.TypeString())
+	}
+	clamp := func(min, max float64) float64 {
+		return math.Max(min, math.Min(max, math.Round(v)))
+	}
+	switch t.NumType() {
+	case TypeBOOL:
+		data[0] = boolByte(v >= 0.5)
+	case TypeSINT:
+		data[0] = uint8(int8(clamp(math.MinInt8, math.MaxInt8)))
+	case TypeINT:
+		binary.LittleEndian.PutUint16(data, uint16(int16(clamp(math.MinInt16, math.MaxInt16))))
+	case TypeDINT:
+		binary.LittleEndian.PutUint32(data, uint32(int32(clamp(math.MinInt32, math.MaxInt32))))
+	case TypeLINT:
+		i := int64(math.MaxInt64)
+		if f := clamp(math.MinInt64, math.MaxInt64); f < math.MaxInt64 {
+			i = int64(f)
+		}
+		binary.LittleEndian.PutUint64(data, uint64(i))
+	case TypeUSINT:
+		data[0] = uint8(clamp(0, math.MaxUint8))
+	case TypeUINT:
+		binary.LittleEndian.PutUint16(data, uint16(clamp(0, math.MaxUint16)))
+	case TypeUDINT:
+		binary.LittleEndian.PutUint32(data, uint32(clamp(0, math.MaxUint32)))
+	case TypeULINT:
+		u := uint64(math.MaxUint64)
+		if f := clamp(0, math.MaxUint64); f < math.MaxUint64 {
+			u = uint64(f)
+		}
+		binary.LittleEndian.PutUint64(data, u)
+	case TypeREAL:
+		binary.LittleEndian.PutUint32(data, math.Float32bits(float32(v)))
+	case TypeLREAL:
+		binary.LittleEndian.PutUint64(data, math.Float64bits(v))
+	default:
+		return errors.New("unsupported type " + t.TypeString())
+	}
+	return nil
+}
+
+type simGen struct {
+	g     Generator
+	path  []pathEl
+	start time.Time
+	next  time.Time
+	v     float64
+}
+
+// simulation schedules generators of PLC.
+type simulation struct {
+	m       sync.Mutex
+	gens    map[string]*simGen
+	wake    chan struct{}
+	running bool
+}
+
+// Simulate drives element at path by generator g, replacing previous generator of the path.
+// Values are written as any other tag update, with source "Simulation".
+func (p *PLC) Simulate(path string, g Generator) error {
+	err := g.check()
+	if err != nil {
+		return err
+	}
+	pth := parsePath(path)
+	p.tMut.RLock()
+	ref, err := p.resolve(pth)
+	if err == nil {
+		err = setNumber(ref.t, make([]uint8, 8), ref.bit, 0)
+	}
+	p.tMut.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	s := &p.sim
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.gens == nil {
+		s.gens = make(map[string]*simGen)
+		s.wake = make(chan struct{}, 1)
+	}
+	now := time.Now()
+	s.gens[strings.ToLower(path)] = &simGen{g: g, path: pth, start: now, next: now}
+	if !s.running {
+		s.running = true
+		go p.simulate()
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// StopSimulation stops generator of path.
+func (p *PLC) StopSimulation(path string) {
+	p.sim.m.Lock()
+	delete(p.sim.gens, strings.ToLower(path))
+	p.sim.m.Unlock()
+}
+
+// rename moves generators of paths starting with tag of lower case name to newName. Must be called with tMut locked.
+func (s *simulation) rename(p *PLC, name string, newName string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	for key, sg := range s.gens {
+		n, i := p.tagName(sg.path)
+		if strings.ToLower(n) != name || sg.path[0].typ != ansiExtended {
+			continue
+		}
+		sg.path = append(parsePath(newName), sg.path[i:]...)
+		if strings.HasPrefix(key, name) {
+			delete(s.gens, key)
+			s.gens[strings.ToLower(newName)+key[len(name):]] = sg
+		}
+	}
+}
+
+// Simulations returns generators by path.
+func (p *PLC) Simulations() map[string]Generator {
+	p.sim.m.Lock()
+	defer p.sim.m.Unlock()
+	m := make(map[string]Generator, len(p.sim.gens))
+	for n, sg := range p.sim.gens {
+		m[n] = sg.g
+	}
+	return m
+}
+
+type simValue struct {
+	path string
+	pth  []pathEl
+	v    float64
+}
+
+// stop wakes simulation to end after Close.
+func (s *simulation) stop() {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.wake != nil {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// simulate runs until there are no generators or the server is closed.
+func (p *PLC) simulate() {
+	s := &p.sim
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		var (
+			due  []simValue
+			next time.Time
+		)
+		p.closeMut.RLock()
+		endP := p.closeI
+		p.closeMut.RUnlock()
+		s.m.Lock()
+		if len(s.gens) == 0 || endP {
+			s.running = false
+			s.m.Unlock()
+			return
+		}
+		now := time.Now()
+		for n, sg := range s.gens {
+			if !now.Before(sg.next) {
+				due = append(due, simValue{n, sg.path, sg.g.at(sg.next.Sub(sg.start), &sg.v)})
+				sg.next = sg.next.Add(sg.g.rate())
+				if sg.next.Before(now) {
+					sg.next = now.Add(sg.g.rate())
+				}
+			}
+			if next.IsZero() || sg.next.Before(next) {
+				next = sg.next
+			}
+		}
+		s.m.Unlock()
+
+		for _, d := range due {
+			p.tMut.Lock()
+			ref, err := p.resolve(d.pth)
+			if err == nil {
+				dst := ref.data()
+				buf := append([]uint8{}, dst...)
+				if err = setNumber(ref.t, buf, ref.bit, d.v); err == nil {
+					copy(dst, buf)
+					p.tagWritten(ref.tag, ref.off, buf, "Simulation", WriteTag, Tag{Type: ref.t.Type})
+				}
+			}
+			p.tMut.Unlock()
+			if err != nil {
+				p.log(LogWarn, "simulation stopped", "path", d.path, "err", err)
+				p.StopSimulation(d.path)
+			}
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-s.wake:
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package plcconnector
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestGenerator(t *testing.T) {
+	s := time.Second
+	tests := []struct {
+		g       Generator
+		elapsed time.Duration
+		want    float64
+	}{
+		{Generator{Kind: GenRamp, Period: s, Amplitude: 10, Offset: 5}, 0, 5},
+		{Generator{Kind: GenRamp, Period: s, Amplitude: 10, Offset: 5}, 2500 * time.Millisecond, 10},
+		{Generator{Kind: GenSine, Period: s, Amplitude: 2}, 250 * time.Millisecond, 2},
+		{Generator{Kind: GenSine, Period: s, Amplitude: 2, Offset: 1}, 750 * time.Millisecond, -1},
+		{Generator{Kind: GenSquare, Period: s, Amplitude: 1}, 100 * time.Millisecond, 1},
+		{Generator{Kind: GenSquare, Period: s, Amplitude: 1}, 600 * time.Millisecond, -1},
+		{Generator{Kind: GenCounter, Period: s, Offset: 100}, 3 * s, 103},
+		{Generator{Kind: GenCounter, Period: s, Amplitude: 3}, 4 * s, 1},
+		{Generator{Kind: GenStates, Period: s, States: []float64{1, 5, 9}}, 2 * s, 9},
+		{Generator{Kind: GenStates, Period: s, States: []float64{1, 5, 9}}, 4 * s, 5},
+		{Generator{Kind: GenRandomWalk, Period: s, Amplitude: 1, Offset: 7}, 0, 7},
+	}
+	for i, tt := range tests {
+		var v float64
+		if got := tt.g.at(tt.elapsed, &v); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%d: %s at %v = %v, want %v", i, tt.g.Kind, tt.elapsed, got, tt.want)
+		}
+	}
+
+	g := Generator{Kind: GenRandomWalk, Period: s, Amplitude: 1, Offset: 7}
+	v := 0.0
+	g.at(0, &v)
+	for i := 1; i < 100; i++ {
+		prev := v
+		if d := g.at(time.Duration(i)*s, &v) - prev; d < -1 || d > 1 {
+			t.Fatalf("random walk step %v", d)
+		}
+	}
+
+	for _, g := range []Generator{{Kind: "bogus", Period: s}, {Kind: GenSine}, {Kind: GenStates, Period: s}} {
+		if g.check() == nil {
+			t.Errorf("%+v accepted", g)
+		}
+	}
+}
+
+func TestSetNumber(t *testing.T) {
+	tests := []struct {
+		typ  int
+		v    float64
+		want []uint8
+	}{
+		{TypeSINT, -200, []uint8{0x80}},
+		{TypeUSINT, 300, []uint8{0xFF}},
+		{TypeINT, 1.6, []uint8{2, 0}},
+		{TypeUINT, -5, []uint8{0, 0}},
+		{TypeDINT, -1, []uint8{0xFF, 0xFF, 0xFF, 0xFF}},
+		{TypeLINT, 1e30, []uint8{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x7F}},
+		{TypeULINT, 1e30, []uint8{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}},
+		{TypeREAL, 1, []uint8{0, 0, 0x80, 0x3F}},
+		{TypeBOOL, 0.7, []uint8{0xFF}},
+	}
+	for _, tt := range tests {
+		data := make([]uint8, len(tt.want))
+		if err := setNumber(Tag{Type: tt.typ}, data, -1, tt.v); err != nil || string(data) != string(tt.want) {
+			t.Errorf("%s %v = % X, %v", typeToString(tt.typ), tt.v, data, err)
+		}
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.NewUDT("DATATYPE SIM INT A; BOOL B; END_DATATYPE"); err != nil {
+		t.Fatal(err)
+	}
+	if err = p.CreateTag("SIM", "s"); err != nil {
+		t.Fatal(err)
+	}
+	offA := p.tags["s"].st.Elem("A").offset
+	p.NewTag(int32(0), "cnt")
+	p.NewTag([]float32{0, 0, 0}, "arr")
+	p.NewTag(int16(0), "w")
+
+	for _, bad := range []string{"nope", "arr", "s", "arr[5]"} {
+		if p.Simulate(bad, Generator{Kind: GenCounter, Period: time.Millisecond}) == nil {
+			t.Errorf("%s accepted", bad)
+		}
+	}
+
+	sub := p.Subscribe(1000)
+	defer sub.Close()
+	ms := 10 * time.Millisecond
+	for path, g := range map[string]Generator{
+		"cnt":    {Kind: GenCounter, Period: ms},
+		"arr[1]": {Kind: GenStates, Period: ms, States: []float64{1.5, 2.5}},
+		"s.A":    {Kind: GenRamp, Period: 10 * ms, Amplitude: 100},
+		"s.B":    {Kind: GenSquare, Period: 2 * ms, Offset: 0.5, Amplitude: 0.5},
+	} {
+		if err := p.Simulate(path, g); err != nil {
+			t.Fatal(path, err)
+		}
+	}
+	if len(p.Simulations()) != 4 {
+		t.Errorf("simulations %v", p.Simulations())
+	}
+
+	seen := map[string]bool{}
+	timeout := time.After(2 * time.Second)
+	for len(seen) < 4 {
+		select {
+		case e := <-sub.C:
+			if e.Source != "Simulation" {
+				t.Fatalf("event %+v", e)
+			}
+			key := e.Tag
+			switch {
+			case e.Tag == "arr" && e.Offset == 4:
+				key = "arr[1]"
+			case e.Tag == "s" && e.Offset == offA:
+				key = "s.A"
+			case e.Tag == "s":
+				key = "s.B"
+			}
+			seen[key] = true
+		case <-timeout:
+			t.Fatalf("events seen %v", seen)
+		}
+	}
+
+	time.Sleep(3 * ms)
+	for path := range p.Simulations() {
+		p.StopSimulation(path)
+	}
+	time.Sleep(3 * ms)
+	p.tMut.RLock()
+	c := p.tags["cnt"].DataDINT()[0]
+	p.tMut.RUnlock()
+	if c < 1 {
+		t.Errorf("counter %d", c)
+	}
+	time.Sleep(3 * ms)
+	p.tMut.RLock()
+	if c2 := p.tags["cnt"].DataDINT()[0]; c2 != c {
+		t.Errorf("counter changed after stop %d -> %d", c, c2)
+	}
+	p.tMut.RUnlock()
+}
+
+func TestSimulateRename(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.NewTag([]int32{0, 0}, "a")
+	sub := p.Subscribe(10)
+	defer sub.Close()
+	if err = p.Simulate("A[1]", Generator{Kind: GenCounter, Period: time.Hour, Offset: 1}); err != nil {
+		t.Fatal(err)
+	}
+	<-sub.C
+	if err = p.RenameTag("a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.Simulations()["b[1]"]; !ok {
+		t.Errorf("simulations %v", p.Simulations())
+	}
+	p.sim.m.Lock()
+	p.sim.gens["b[1]"].next = time.Now()
+	p.sim.m.Unlock()
+	p.sim.stop()
+	select {
+	case e := <-sub.C:
+		if e.Tag != "b" || e.Offset != 4 {
+			t.Errorf("event %+v", e)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("no event after rename")
+	}
+	p.StopSimulation("b[1]")
+}
+
+func TestSimulateClose(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.NewTag(int32(0), "cnt")
+	called := make(chan string, 1)
+	p.Callback(func(service int, status int, tag *Tag) {
+		select {
+		case called <- tag.Name:
+		default:
+		}
+	})
+	addr := freeAddr(t)
+	go p.Serve(addr)
+	var c *Client
+	for i := 0; i < 50; i++ {
+		if c, err = Connect(addr, -1); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if err = p.Simulate("cnt", Generator{Kind: GenCounter, Period: time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case n := <-called:
+		if n != "cnt" {
+			t.Errorf("callback of %s", n)
+		}
+	case <-time.After(time.Second):
+		t.Error("simulated write not reported to callback")
+	}
+
+	p.Close()
+	for i := 0; ; i++ {
+		p.sim.m.Lock()
+		running := p.sim.running
+		p.sim.m.Unlock()
+		if !running {
+			break
+		}
+		if i == 50 {
+			t.Fatal("simulation running after Close")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
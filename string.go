@@ -0,0 +1,119 @@
+package plcconnector
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// Logix predefined STRING structure.
+const (
+	logixStringHandle = 0x0FCE
+	logixStringLen    = 82
+)
+
+func (p *PLC) addStringTypes() {
+	p.newUDT([]udtT{
+		{N: "LEN", T: "DINT", O: 0},
+		{N: "DATA", T: "SINT", C: logixStringLen, O: 4},
+	}, "STRING", logixStringHandle, 88)
+}
+
+// isString reports whether the structure has Logix string layout (DINT LEN; SINT DATA[n]).
+func (st *structData) isString() bool {
+	return st != nil && len(st.d) == 2 &&
+		strings.EqualFold(st.d[0].Name, "LEN") && st.d[0].BasicType() == TypeDINT && st.d[0].Dim[0] == 0 &&
+		strings.EqualFold(st.d[1].Name, "DATA") && st.d[1].BasicType() == TypeSINT && st.d[1].Dim[0] > 0
+}
+
+// maxLen returns capacity of Logix string structure.
+func (st *structData) maxLen() int {
+	return st.d[1].Dim[0]
+}
+
+func (st *structData) getString(data []uint8) string {
+	if len(data) < st.d[0].offset+4 {
+		return ""
+	}
+	ln := int(int32(binary.LittleEndian.Uint32(data[st.d[0].offset:])))
+	if ln < 0 {
+		ln = 0
+	}
+	if ln > st.maxLen() {
+		ln = st.maxLen()
+	}
+	from := st.d[1].offset
+	if from+ln > len(data) {
+		return ""
+	}
+	return string(data[from : from+ln])
+}
+
+func (st *structData) setString(data []uint8, v string) error {
+	if len(v) > st.maxLen() {
+		return errors.New("string too long for " + st.n)
+	}
+	binary.LittleEndian.PutUint32(data[st.d[0].offset:], uint32(len(v)))
+	dt := data[st.d[1].offset : st.d[1].offset+st.maxLen()]
+	copy(dt, v)
+	for i := len(v); i < len(dt); i++ {
+		dt[i] = 0
+	}
+	return nil
+}
+
+// TagLogixString creates tag of Logix STRING type. Value is truncated to 82 characters.
+func (p *PLC) TagLogixString(v string, n string) *Tag {
+	st := p.tids["STRING"]
+	a := &Tag{Name: n, Type: TypeStructHead | int(st.h), st: &st, data: make([]uint8, st.l)}
+	if len(v) > st.maxLen() {
+		v = v[:st.maxLen()]
+	}
+	st.setString(a.data, v)
+	return a
+}
+
+// stringAt returns tag, string structure and its offset in tag data of string at path. Must be called with tMut locked.
+func (p *PLC) stringAt(path string) (*Tag, *structData, int, error) {
+	pth := parsePath(path)
+	if pth == nil {
+		return nil, nil, 0, errors.New("path parse error")
+	}
+	r, err := p.resolve(pth)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if r.bit >= 0 || r.t.Dim[0] > 0 || !r.t.st.isString() {
+		return nil, nil, 0, errors.New(path + " is not a string")
+	}
+	return r.tag, r.t.st, r.off, nil
+}
+
+// SetString sets value of Logix STRING (or custom string type) tag or member.
+func (p *PLC) SetString(path string, v string) error {
+	p.tMut.Lock()
+	defer p.tMut.Unlock()
+
+	tg, st, from, err := p.stringAt(path)
+	if err != nil {
+		return err
+	}
+	err = st.setString(tg.data[from:], v)
+	if err != nil {
+		return err
+	}
+	p.tagWritten(tg, from, tg.data[from:from+st.l], "SetString", WriteTag, Tag{Type: TypeStructHead | int(st.h)})
+	return nil
+}
+
+// GetString returns value of Logix STRING (or custom string type) tag or member.
+func (p *PLC) GetString(path string) (string, error) {
+	p.tMut.RLock()
+	defer p.tMut.RUnlock()
+
+	tg, st, from, err := p.stringAt(path)
+	if err != nil {
+		return "", err
+	}
+	return st.getString(tg.data[from:]), nil
+}
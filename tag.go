@@ -3,7 +3,6 @@ package plcconnector
 import (
 	"encoding/binary"
 	"errors"
-	"fmt"
 	"math"
 	"reflect"
 	"strconv"
@@ -29,7 +28,9 @@ type Tag struct {
 	data   []uint8
 	st     *structData
 	in     *Instance
+	alias  []pathEl // target of alias tag, which has no data
 	offset int
+	bit    int // bit number of BOOL struct member
 	prot   uint8
 	write  bool // TODO mutex
 	getter func() []uint8
@@ -72,15 +73,25 @@ func (t Tag) NumType() int {
 
 // Dims .
 func (t Tag) Dims() int {
-	if t.BasicType() == TypeBOOL {
-		return 1
-	}
 	return one(t.Dim[0]) * one(t.Dim[1]) * one(t.Dim[2])
 }
 
+// boolArray reports whether t is a Logix BOOL array packed into DWORDs.
+func (t Tag) boolArray() bool {
+	return t.BasicType() == TypeBOOL && t.Dim[0] > 0
+}
+
+// dataLen returns length of the tag data in bytes.
+func (t Tag) dataLen() int {
+	if t.boolArray() {
+		return 4 * ((t.Dim[0] + 31) / 32)
+	}
+	return t.ElemLen() * t.Dims()
+}
+
 // DimString .
 func (t Tag) DimString() string {
-	if t.Dim[0] == 0 || t.BasicType() == TypeBOOL {
+	if t.Dim[0] == 0 {
 		return ""
 	}
 
@@ -130,6 +141,9 @@ func (t Tag) Len() int {
 	if t.Type >= TypeStructHead {
 		return t.st.l
 	}
+	if t.boolArray() {
+		return 4
+	}
 	switch t.BasicType() {
 	case TypeSTRING, TypeSTRING2, TypeSTRINGI, TypeSTRINGN, TypeSHORTSTRING:
 		return len(t.data)
@@ -143,6 +157,9 @@ func (t Tag) ElemLen() int {
 	if t.Type >= TypeStructHead {
 		return t.st.l
 	}
+	if t.boolArray() {
+		return 4
+	}
 	return int(typeLen(uint16(t.Type)))
 }
 
@@ -154,32 +171,41 @@ func (t Tag) TypeString() string {
 	return typeToString(t.Type)
 }
 
+// boolByte returns BOOL value as stored in tag data, 0xFF for true like Logix.
+func boolByte(v bool) uint8 {
+	if v {
+		return 0xFF
+	}
+	return 0
+}
+
 // TagBOOL .
 func TagBOOL(v bool, n string) *Tag {
 	var a Tag
 	a.Name = n
 	a.Type = TypeBOOL
-	if v {
-		a.data = []byte{0xFF}
-	} else {
-		a.data = []byte{0}
-	}
+	a.data = []byte{boolByte(v)}
 	return &a
 }
 
-// TagArrayBool .
+// TagArrayBool creates Logix BOOL array. Elements are packed into DWORDs, c is rounded up to multiple of 32.
 func TagArrayBool(v []bool, c int, n string) *Tag {
 	var a Tag
 	a.Name = n
-	a.Dim[0] = c
+	a.Dim[0] = (c + 31) &^ 31
 	a.Type = TypeBOOL
-	a.data = make([]byte, c)
+	a.data = packBOOL(v, a.Dim[0])
+	return &a
+}
+
+func packBOOL(v []bool, c int) []byte {
+	r := make([]byte, 4*((c+31)/32))
 	for i, x := range v {
-		if x {
-			a.data[i] = 0xFF
+		if x && i < c {
+			r[i/8] |= 1 << (i % 8)
 		}
 	}
-	return &a
+	return r
 }
 
 // TagSINT .
@@ -556,7 +582,7 @@ func (p *PLC) NewTag(i interface{}, n string) {
 			panic("unsupported embedded type " + e.String())
 		}
 	case reflect.String:
-		a = TagString(v.String(), n)
+		a = p.TagLogixString(v.String(), n)
 	case reflect.Struct:
 		a = new(Tag)
 		a.Name = n
@@ -613,12 +639,11 @@ func valueToByte(v reflect.Value) []byte {
 		c := v.Len()
 		switch e.Kind() {
 		case reflect.Bool:
-			r = make([]byte, c)
+			bools := make([]bool, c)
 			for i := 0; i < c; i++ {
-				if v.Index(i).Bool() {
-					r[i] = 0xFF
-				}
+				bools[i] = v.Index(i).Bool()
 			}
+			r = packBOOL(bools, c)
 		case reflect.Int8:
 			r = make([]byte, c)
 			for i := 0; i < c; i++ {
@@ -738,6 +763,12 @@ func (t *Tag) DataBytes() []byte {
 // DataBOOL returns array of BOOL.
 func (t *Tag) DataBOOL() []bool {
 	ret := make([]bool, 0, t.Dims())
+	if t.boolArray() {
+		for i := 0; i < t.Dim[0] && i/8 < len(t.data); i++ {
+			ret = append(ret, (t.data[i/8]>>(i%8))&1 == 1)
+		}
+		return ret
+	}
 	for i := 0; i < len(t.data); i++ {
 		tmp := false
 		if t.data[i] != 0 {
@@ -818,13 +849,14 @@ func (t *Tag) DataLINT() []int64 {
 
 // DataString returns string.
 func (t *Tag) DataString() string {
+	if t.Type >= TypeStructHead && t.st.isString() {
+		return t.st.getString(t.data)
+	}
 	switch t.BasicType() {
 	case TypeSTRING:
 		return string(t.data[2:])
 	case TypeSHORTSTRING:
 		return string(t.data[1:])
-	default:
-		fmt.Println("DataString error", t.Type)
 	}
 	return "error string"
 }
@@ -847,116 +879,65 @@ func (p *PLC) CreateTag(typ string, name string) error {
 			name = n
 		}
 		t.Type = p.stringToType(udt[0].T)
+		if t.Type == 0 {
+			return errors.New("unknown type " + udt[0].T)
+		}
+		if t.Type >= TypeStructHead {
+			st := p.tids[udt[0].T]
+			t.st = &st
+		}
 		t.Dim[0] = udt[0].C
 		t.Dim[1] = udt[0].C2
 		t.Dim[2] = udt[0].C3
-		t.data = make([]uint8, t.Dims()*t.Len())
+		t.data = make([]uint8, t.dataLen())
 	}
 	t.Name = name
 	p.AddTag(t)
 	return nil
 }
 
+// tagWritten reports write of data at offset of tag t to journal, history, subscribers and callback.
+// Callback gets service and written value v named as t, with data if v has none. Must be called with tMut locked.
+func (p *PLC) tagWritten(t *Tag, offset int, data []uint8, source string, service int, v Tag) {
+	p.journal(t, offset, data)
+	p.addHistory(t, source)
+	p.notify(t, offset, data, source)
+	v.Name = t.Name
+	if v.data == nil {
+		v.data = data
+	}
+	p.tagError(service, Success, &v)
+}
+
 func (p *PLC) tagError(service int, status int, tag *Tag) {
 	if p.callback != nil {
 		go p.callback(service, status, tag)
 	}
 }
 
+// parsePathEl returns base tag, type, length of element or bit number, offset in tag data and last array index of path.
 func (p *PLC) parsePathEl(path []pathEl) (*Tag, uint32, int, int, int, error) {
-	var (
-		copyFrom int
-		index    int
-		memb     string
-		pi       = 1
-		tag      string
-		tgtyp    uint32
-		tl       int
-		arri     = 0
-	)
-
-	if len(path) == 0 {
-		return nil, 0, 0, 0, 0, errors.New("path length 0")
-	}
-
-	if path[0].typ == ansiExtended {
-		if strings.HasPrefix(path[0].txt, "Program:") {
-			if len(path) > 1 && path[1].typ == ansiExtended {
-				tag = path[0].txt + "." + path[1].txt
-				pi = 2
-			} else if len(path) > 2 && path[1].typ == pathClass && path[1].val == SymbolClass && path[2].typ == pathInstance {
-				pi = 3
-				inst, ok := p.symbols.inst[path[2].val]
-				if !ok {
-					return nil, 0, 0, 0, 0, errors.New("path no tag")
-				}
-				tag = inst.attr[1].DataString()
-			}
-		} else {
-			tag = path[0].txt
-		}
-	} else if len(path) > 1 && path[0].typ == pathClass && path[0].val == SymbolClass && path[1].typ == pathInstance {
-		pi = 2
-		inst, ok := p.symbols.inst[path[1].val]
-		if !ok {
-			return nil, 0, 0, 0, 0, errors.New("path no tag")
-		}
-		tag = inst.attr[1].DataString()
-	}
-
-	tg, ok := p.tags[strings.ToLower(tag)]
-
-	if !ok {
-		return nil, 0, 0, 0, 0, errors.New("path no tag")
+	r, err := p.resolve(path)
+	if err != nil {
+		return nil, 0, 0, 0, 0, err
 	}
-
-	tl = tg.Len()
-	tgtyp = uint32(tg.Type)
-
-	tgc := tg
-	for i := pi; i < len(path); i++ {
-		switch path[i].typ {
-		case pathMember:
-			index = path[i].val
-			if arri > 2 || index > tgc.Dim[arri] {
-				return nil, 0, 0, 0, 0, errors.New("path index too big")
-			}
-			switch arri {
-			case 0:
-				copyFrom += index * one(tgc.Dim[1]) * one(tgc.Dim[2]) * tl
-			case 1:
-				copyFrom += index * one(tgc.Dim[2]) * tl
-			case 2:
-				copyFrom += index * tl
-			}
-			arri++
-		case ansiExtended:
-			if tgc.st == nil {
-				return nil, 0, 0, 0, 0, errors.New("path tag is not a struct")
-			}
-			memb = path[i].txt
-			el := tgc.st.Elem(memb)
-			if el == nil {
-				fmt.Println("no member", memb, "in struct", tgc.Name)
-				return nil, 0, 0, 0, 0, errors.New("path no member in struct")
-			}
-			tl = el.Len()
-			copyFrom += el.offset
-			tgtyp = uint32(el.Type)
-			if tgtyp == TypeBOOL {
-				tl = el.Dim[0]
-			}
-			tgc = el
-			arri = 0
-		}
+	tgtyp := uint32(r.t.Type)
+	tl := r.t.Len()
+	if r.bit >= 0 {
+		tgtyp, tl = TypeBOOL, r.bit
+	} else if r.t.boolArray() {
+		tgtyp = TypeDWORD
 	}
-
-	if tgc.st == nil {
+	if r.t.st == nil {
 		tgtyp &= TypeType
 	}
-	p.debug(tgc.TypeString())
+	p.log(LogDebug, "tag path", "tag", r.tag.Name, "type", r.t.TypeString())
+	return r.tag, tgtyp, tl, r.off, r.index, nil
+}
 
-	return tg, tgtyp, tl, copyFrom, index, nil
+// bitAccess reports whether BOOL element returned by parsePathEl is a bit in data of tag tg, with bit number instead of length.
+func bitAccess(tg *Tag, tgtyp uint32) bool {
+	return tgtyp == TypeBOOL && (tg.st != nil || tg.boolArray() || tg.BasicType() != TypeBOOL)
 }
 
 func (p *PLC) readTag(path []pathEl, count uint16) ([]uint8, uint32, int, bool) {
@@ -969,26 +950,32 @@ func (p *PLC) readTag(path []pathEl, count uint16) ([]uint8, uint32, int, bool)
 		return nil, 0, 0, false
 	}
 
+	bit := bitAccess(tg, tgtyp)
+	if bit && tl >= 8 {
+		p.tagError(ReadTag, PathSegmentError, nil)
+		return nil, 0, 0, false
+	}
 	copyLen := int(count) * tl
+	if bit {
+		copyLen = 1
+	}
 	tgdata := make([]uint8, copyLen)
 	if copyFrom+copyLen > len(tg.data) {
 		p.tagError(ReadTag, PathSegmentError, nil)
 		return nil, 0, 0, false
 	}
-	if tg.st != nil && tgtyp == TypeBOOL {
-		if tl >= 8 {
-			panic("tl >= 8")
-		}
-		tgdata = make([]uint8, 1)
+	if bit {
 		if ((tg.data[copyFrom] >> tl) & 1) > 0 {
 			tgdata[0] = 0xFF
 		} else {
 			tgdata[0] = 0
 		}
+		tl = 1
 	} else {
 		copy(tgdata, tg.data[copyFrom:])
 	}
 
+	p.metrics.tag(tg.Name, false)
 	p.tagError(ReadTag, Success, &Tag{Name: tg.Name, Type: int(tgtyp), Index: index, data: tgdata})
 	return tgdata, tgtyp, tl, true
 }
@@ -1014,8 +1001,8 @@ func (p *PLC) readModWriteTag(path []pathEl, orMask, andMask []uint8) bool {
 	for i, and := range andMask {
 		tg.data[copyFrom+i] &= and
 	}
-
-	p.tagError(ReadModifyWrite, Success, &Tag{Name: tg.Name, Type: int(tgtyp), Index: index, data: tg.data[copyFrom : copyFrom+len(orMask)]})
+	p.metrics.tag(tg.Name, true)
+	p.tagWritten(tg, copyFrom, tg.data[copyFrom:copyFrom+len(orMask)], "ReadModifyWrite", ReadModifyWrite, Tag{Type: int(tgtyp), Index: index})
 	return true
 }
 
@@ -1033,30 +1020,34 @@ func (p *PLC) saveTag(path []pathEl, typ uint16, count int, data []uint8, offset
 		p.tagError(WriteTag, TooMuchData, nil)
 		return false
 	}
-	if tg.st != nil && tgtyp == TypeBOOL {
-		if tl >= 8 {
-			panic("tl >= 8")
+	if bitAccess(tg, tgtyp) {
+		if tl >= 8 || len(data) == 0 {
+			p.tagError(WriteTag, PathSegmentError, nil)
+			return false
 		}
 		if data[0] == 0 {
 			tg.data[copyFrom+offset] &^= 1 << tl
 		} else {
 			tg.data[copyFrom+offset] |= 1 << tl
 		}
-	} else {
-		copy(tg.data[copyFrom+offset:], data)
+		p.metrics.tag(tg.Name, true)
+		p.tagWritten(tg, copyFrom+offset, tg.data[copyFrom+offset:copyFrom+offset+1], "WriteTag", WriteTag, Tag{Type: int(tgtyp), Index: index, data: data})
+		return true
 	}
-
-	p.tagError(WriteTag, Success, &Tag{Name: tg.Name, Type: int(tgtyp), Index: index, data: data})
+	copy(tg.data[copyFrom+offset:], data)
+	p.metrics.tag(tg.Name, true)
+	p.tagWritten(tg, copyFrom+offset, data, "WriteTag", WriteTag, Tag{Type: int(tgtyp), Index: index})
 	return true
 }
 
-func (p *PLC) addTag(t Tag, instance int) {
-	if t.data == nil {
-		t.data = make([]uint8, t.ElemLen()*t.Dims())
-	}
+// symbolInstance returns Symbol Object instance describing tag t.
+func symbolInstance(t *Tag) *Instance {
 	in := NewInstance(11)
 	in.attr[1] = TagString(t.Name, "SymbolName")
 	typ := uint16(t.Type)
+	if t.boolArray() {
+		typ = TypeDWORD
+	}
 	if t.Dim[2] > 0 {
 		typ |= TypeArray3D
 	} else if t.Dim[1] > 0 {
@@ -1081,23 +1072,38 @@ func (p *PLC) addTag(t Tag, instance int) {
 	in.attr[9] = TagBOOL(false, "SafetyFlag")
 	in.attr[10] = TagUSINT(t.prot, "PPDControl")      // 0: full access, 1: reserved, 2: read only, 3: no access
 	in.attr[11] = TagUSINT(0, "ConstantTagIndicator") // 0: normal, 1: constant
+	return in
+}
 
+// addTag adds tag with symbol instance, or the next free one if -1. Tags named Program:name.tag belong to program name.
+func (p *PLC) addTag(t Tag, instance int) {
+	if t.boolArray() {
+		t.Dim[0] = (t.Dim[0] + 31) &^ 31
+	}
+	if t.data == nil && t.alias == nil {
+		t.data = make([]uint8, t.dataLen())
+	}
+	in := symbolInstance(&t)
 	name := strings.ToLower(t.Name)
+	prog, local := splitScope(name)
+	if prog != "" {
+		in.attr[1] = TagString(t.Name[len(t.Name)-len(local):], "SymbolName")
+	}
 	t.in = in
 
 	p.tMut.Lock()
+	c := p.symbolClass(name)
+	if c == nil {
+		c = p.newProgram(t.Name[len("Program:") : len("Program:")+len(prog)]).symbols
+	}
 	if instance == -1 {
-		p.symbols.SetInstance(p.symbols.lastInst+1, in)
+		c.SetInstance(c.lastInst+1, in)
 	} else {
-		p.symbols.SetInstance(instance, in)
+		c.SetInstance(instance, in)
 	}
 	p.tags[name] = &t
+	p.tagCRC(&t, name, 1)
 	p.tMut.Unlock()
-
-	in = p.Class[0xAC].inst[1]
-	crc := in.attr[3].DataDINT()[0] + int32(crc16([]byte(name))) + int32(t.Type+t.Dims())
-	in.SetAttrDINT(3, crc)
-	p.Class[SymbolClass].inst[0].SetAttrUDINT(8, uint32(crc))
 }
 
 // AddTag adds tag.
@@ -1105,23 +1111,224 @@ func (p *PLC) AddTag(t Tag) {
 	p.addTag(t, -1)
 }
 
+// tagCRC adds CRC of tag t named name to TagCRC attribute, sign is 1 for added and -1 for removed tag. Must be called with tMut locked.
+func (p *PLC) tagCRC(t *Tag, name string, sign int32) {
+	in := p.Class[0xAC].inst[1]
+	crc := in.attr[3].DataDINT()[0] + sign*(int32(crc16([]byte(name)))+int32(t.Type+t.Dims()))
+	in.SetAttrDINT(3, crc)
+	p.symbols.inst[0].SetAttrUDINT(8, uint32(crc))
+}
+
+// RemoveTag removes tag with its symbol instance. Instances of other tags are unchanged.
+// Tag used by aliases is not removed.
+func (p *PLC) RemoveTag(name string) error {
+	name = strings.ToLower(name)
+	p.tMut.Lock()
+	defer p.tMut.Unlock()
+	t, ok := p.tags[name]
+	if !ok {
+		return errors.New("no tag " + name)
+	}
+	if a := p.aliasesOf(name); len(a) > 0 {
+		return errors.New("tag " + t.Name + " is used by alias " + a[0].Name)
+	}
+	delete(p.tags, name)
+	delete(p.hist, name)
+	if c := p.symbolClass(name); c != nil {
+		if no := c.instanceNo(t.in); no != 0 {
+			c.removeInstance(no)
+		}
+	}
+	p.tagCRC(t, name, -1)
+	p.log(LogInfo, "tag removed", "tag", t.Name)
+	return nil
+}
+
+// RenameTag changes name of tag, keeping its symbol instance and data.
+// Aliases, simulation generators and WebSocket subscriptions of the tag follow the new name.
+func (p *PLC) RenameTag(name string, newName string) error {
+	from, to := strings.ToLower(name), strings.ToLower(newName)
+	p.tMut.Lock()
+	defer p.tMut.Unlock()
+	t, ok := p.tags[from]
+	if !ok {
+		return errors.New("no tag " + name)
+	}
+	prog, _ := splitScope(from)
+	progTo, local := splitScope(to)
+	if local == "" || strings.ContainsAny(local, ".:[] ") {
+		return errors.New("invalid tag name " + newName)
+	}
+	if progTo != prog {
+		return errors.New("tag " + name + " cannot be moved to another program")
+	}
+	if _, ok := p.tags[to]; ok && to != from {
+		return errors.New("tag " + newName + " already exists")
+	}
+	for _, a := range p.aliasesOf(from) {
+		_, n := p.tagName(a.alias)
+		a.alias = append(parsePath(newName), a.alias[n:]...)
+	}
+	p.sim.rename(p, from, newName)
+	p.tagCRC(t, from, -1)
+	delete(p.tags, from)
+	t.Name = newName
+	t.in.SetAttr(1, TagString(newName[len(newName)-len(local):], "SymbolName"))
+	p.tags[to] = t
+	if h, ok := p.hist[from]; ok {
+		delete(p.hist, from)
+		p.hist[to] = h
+	}
+	p.tagCRC(t, to, 1)
+	p.log(LogInfo, "tag renamed", "tag", name, "name", newName)
+	return nil
+}
+
 // UpdateTag sets data to the tag
 func (p *PLC) UpdateTag(name string, offset int, data []uint8) bool {
 	p.tMut.Lock()
 	defer p.tMut.Unlock()
 	t, ok := p.tags[strings.ToLower(name)]
 	if !ok {
-		fmt.Println("plcconnector UpdateTag: no tag named ", name)
+		p.log(LogWarn, "UpdateTag: no tag", "tag", name)
 		return false
 	}
 	offset *= t.ElemLen()
 	to := offset + len(data)
 	if to > len(t.data) {
-		fmt.Println("plcconnector UpdateTag: to large data ", name)
+		p.log(LogWarn, "UpdateTag: too large data", "tag", name, "offset", offset, "length", len(data))
 		return false
 	}
 	for i := offset; i < to; i++ {
 		t.data[i] = data[i-offset]
 	}
+	p.tagWritten(t, offset, data, "UpdateTag", WriteTag, Tag{Type: t.Type, Index: offset / t.ElemLen()})
 	return true
 }
+
+// tagRef is resolved path to tag, structure member, array element or bit.
+type tagRef struct {
+	tag   *Tag // base tag
+	t     Tag  // referenced element
+	off   int  // offset in tag data
+	bit   int  // bit number of BOOL member or element, -1 otherwise
+	index int  // last array index of path
+}
+
+// data returns referenced part of tag data.
+func (r tagRef) data() []uint8 {
+	if r.bit >= 0 {
+		return r.tag.data[r.off : r.off+1]
+	}
+	return r.tag.data[r.off : r.off+r.t.dataLen()]
+}
+
+// resolve resolves path of tag, also by symbol instance, following aliases. Must be called with tMut locked.
+func (p *PLC) resolve(path []pathEl) (tagRef, error) {
+	return p.resolveAlias(path, 0)
+}
+
+// maxAliasDepth limits aliases of aliases, which may form a loop after tags are renamed.
+const maxAliasDepth = 16
+
+func (p *PLC) resolveAlias(path []pathEl, depth int) (tagRef, error) {
+	var (
+		r   = tagRef{bit: -1}
+		idx []int
+	)
+	name, pi := p.tagName(path)
+	if name == "" {
+		return r, errors.New("invalid path")
+	}
+	tg, ok := p.tags[strings.ToLower(name)]
+	if !ok {
+		return r, errors.New("no tag " + name)
+	}
+	if tg.alias != nil {
+		if depth == maxAliasDepth {
+			return r, errors.New("too deep alias " + name)
+		}
+		return p.resolveAlias(append(append([]pathEl{}, tg.alias...), path[pi:]...), depth+1)
+	}
+	r.tag = tg
+	r.t = *tg
+
+	index := func() error {
+		if len(idx) == 0 {
+			return nil
+		}
+		t := &r.t
+		if t.Dim[0] == 0 || len(idx) > 3 || (len(idx) > 1 && t.Dim[len(idx)-1] == 0) {
+			return errors.New(t.Name + " is not an array of such dimension")
+		}
+		var d [3]int
+		for i := range idx {
+			if idx[i] >= t.Dim[i] {
+				return errors.New("index out of range for " + t.Name)
+			}
+			d[i] = idx[i]
+		}
+		n := (d[0]*one(t.Dim[1])+d[1])*one(t.Dim[2]) + d[2]
+		if t.boolArray() {
+			r.off += n / 8
+			r.bit = n % 8
+		} else {
+			r.off += n * t.ElemLen()
+		}
+		t.Dim = [3]int{}
+		if t.Type < TypeStructHead {
+			t.Type &^= TypeArray3D
+		}
+		idx = nil
+		return nil
+	}
+
+	for i := pi; i < len(path); i++ {
+		if r.bit >= 0 {
+			return r, errors.New("path continues after bit")
+		}
+		switch path[i].typ {
+		case pathMember:
+			idx = append(idx, path[i].val)
+			r.index = path[i].val
+		case ansiExtended:
+			if err := index(); err != nil {
+				return r, err
+			}
+			if r.t.st == nil || r.t.Dim[0] > 0 {
+				return r, errors.New(r.t.Name + " is not a structure")
+			}
+			el := r.t.st.Elem(path[i].txt)
+			if el == nil {
+				return r, errors.New("no member " + path[i].txt + " in " + r.t.st.n)
+			}
+			r.off += el.offset
+			if el.BasicType() == TypeBOOL && el.Dim[0] == 0 {
+				r.bit = el.bit
+			}
+			r.t = *el
+			r.t.offset = 0
+			r.t.bit = 0
+		case pathBit:
+			if err := index(); err != nil {
+				return r, err
+			}
+			l := r.t.ElemLen()
+			if r.t.Type >= TypeStructHead || r.t.Dim[0] > 0 || r.t.BasicType() == TypeBOOL || r.t.BasicType() == TypeREAL || r.t.BasicType() == TypeLREAL || path[i].val >= 8*l {
+				return r, errors.New("invalid bit " + strconv.Itoa(path[i].val) + " of " + r.t.Name)
+			}
+			r.off += path[i].val / 8
+			r.bit = path[i].val % 8
+			r.t = Tag{Name: r.t.Name, Type: TypeBOOL}
+		default:
+			return r, errors.New("invalid path")
+		}
+	}
+	if err := index(); err != nil {
+		return r, err
+	}
+	if r.bit >= 0 {
+		r.t = Tag{Name: r.t.Name, Type: TypeBOOL}
+	}
+	return r, nil
+}
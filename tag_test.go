@@ -0,0 +1,205 @@
+package plcconnector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBoolArray(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.NewTag([]bool{true, false, true}, "bools")
+
+	tg := p.tags["bools"]
+	if tg.Dim[0] != 32 || len(tg.data) != 4 {
+		t.Fatalf("BOOL[3] = BOOL[%d] %d bytes, want BOOL[32] 4 bytes", tg.Dim[0], len(tg.data))
+	}
+
+	err = p.CreateTag("BOOL[64]", "alarms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.saveTag(parsePath("alarms[37]"), TypeBOOL, 1, []uint8{1}, 0) {
+		t.Fatal("saveTag alarms[37] failed")
+	}
+
+	data, typ, _, ok := p.readTag(parsePath("alarms"), 2)
+	if !ok || typ != TypeDWORD || !reflect.DeepEqual(data, []uint8{0, 0, 0, 0, 0x20, 0, 0, 0}) {
+		t.Errorf("readTag(alarms) = %v, 0x%X, want DWORD data with bit 37", data, typ)
+	}
+
+	data, typ, _, ok = p.readTag(parsePath("alarms[37]"), 1)
+	if !ok || typ != TypeBOOL || !reflect.DeepEqual(data, []uint8{0xFF}) {
+		t.Errorf("readTag(alarms[37]) = %v, 0x%X, want BOOL 0xFF", data, typ)
+	}
+
+	data, _, _, ok = p.readTag(parsePath("alarms[36]"), 1)
+	if !ok || !reflect.DeepEqual(data, []uint8{0}) {
+		t.Errorf("readTag(alarms[36]) = %v, want 0", data)
+	}
+
+	if _, _, _, ok = p.readTag(parsePath("alarms[64]"), 1); ok {
+		t.Error("readTag(alarms[64]) should fail")
+	}
+
+	sym := p.tags["alarms"].in.attr[2].DataBytes()
+	if !reflect.DeepEqual(sym, []uint8{0xD3, 0x20}) {
+		t.Errorf("SymbolType = %v, want 0x20D3", sym)
+	}
+}
+
+func TestReadTagPath(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.NewUDT("DATATYPE PT DINT X; BOOL On; END_DATATYPE")
+	p.CreateTag("PT[2]", "pts")
+	p.NewTag([]int32{1, 2, 3}, "arr")
+	p.NewTag(int16(8), "n")
+	p.NewTag(true, "b")
+	p.saveTag(parsePath("pts[1].On"), TypeBOOL, 1, []uint8{1}, 0)
+
+	tests := []struct {
+		path string
+		typ  uint32
+		data []uint8
+	}{
+		{"arr[2]", TypeDINT, []uint8{3, 0, 0, 0}},
+		{"arr[3]", 0, nil},
+		{"n.3", TypeBOOL, []uint8{0xFF}},
+		{"n.2", TypeBOOL, []uint8{0}},
+		{"n.16", 0, nil},
+		{"b.0", 0, nil},
+		{"pts[1].On", TypeBOOL, []uint8{0xFF}},
+		{"pts[2].On", 0, nil},
+		{"arr[1].X", 0, nil},
+	}
+	for _, tt := range tests {
+		data, typ, _, ok := p.readTag(parsePath(tt.path), 1)
+		if ok != (tt.data != nil) || typ != tt.typ || !reflect.DeepEqual(data, tt.data) {
+			t.Errorf("readTag(%s) = %v, 0x%X, %v", tt.path, data, typ, ok)
+		}
+	}
+}
+
+func TestLogixString(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.NewTag("Hello", "Msg")
+	err = p.NewUDT("DATATYPE STRING20 (FamilyType := StringFamily) DINT LEN; SINT DATA[20]; END_DATATYPE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.CreateTag("STRING20", "Short")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, typ, _, ok := p.readTag(parsePath("Msg"), 1)
+	if !ok || typ != TypeStructHead|logixStringHandle || len(data) != 88 {
+		t.Fatalf("readTag(Msg) = 0x%X, %d bytes, want STRING struct of 88 bytes", typ, len(data))
+	}
+	if s, err := p.GetString("Msg"); err != nil || s != "Hello" {
+		t.Errorf("GetString(Msg) = %q, %v", s, err)
+	}
+
+	if err = p.SetString("Short", "twenty characters..."); err != nil {
+		t.Error(err)
+	}
+	if err = p.SetString("Short", "twenty one characters"); err == nil {
+		t.Error("SetString should enforce max length")
+	}
+	if s, _ := p.GetString("Short"); s != "twenty characters..." {
+		t.Errorf("GetString(Short) = %q", s)
+	}
+	if err = p.SetString("Short.LEN", "x"); err == nil {
+		t.Error("SetString on DINT should fail")
+	}
+
+	// structure with colliding handle must not be taken for the string type
+	if err = p.NewUDT("DATATYPE PAIR DINT A; DINT B; END_DATATYPE"); err != nil {
+		t.Fatal(err)
+	}
+	st := p.tids["PAIR"]
+	st.h = p.tids["STRING20"].h
+	p.tids["PAIR"] = st
+	for i := 0; i < 10; i++ {
+		if s, err := p.GetString("Short"); err != nil || s != "twenty characters..." {
+			t.Fatalf("GetString(Short) with handle collision = %q, %v", s, err)
+		}
+	}
+}
+
+func TestRemoveRenameTag(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.NewTag(int32(1), "a")
+	p.NewTag(int32(2), "b")
+	p.NewTag(int32(3), "c")
+	crc := func() int32 { return p.Class[0xAC].inst[1].attr[3].DataDINT()[0] }
+	attr := func(no int) int {
+		return int(uint16(p.symbols.inst[0].attr[no].DataINT()[0]))
+	}
+	inst := func(name string) int {
+		t := p.tags[name]
+		if t == nil {
+			return 0
+		}
+		return p.symbols.instanceNo(t.in)
+	}
+	crc3 := crc()
+	ia, ib := inst("a"), inst("b")
+
+	if err = p.RemoveTag("C"); err != nil {
+		t.Fatal(err)
+	}
+	if p.RemoveTag("c") == nil {
+		t.Error("removed tag twice")
+	}
+	if attr(2) != ib || attr(3) != 2 {
+		t.Errorf("MaxInstance %d NumInstances %d", attr(2), attr(3))
+	}
+	p.NewTag(int32(3), "c")
+	if crc() != crc3 {
+		t.Errorf("TagCRC %d, want %d", crc(), crc3)
+	}
+	if inst("c") <= ib+1 {
+		t.Errorf("instance %d of removed tag reused", inst("c"))
+	}
+
+	tests := []struct {
+		from, to string
+		ok       bool
+	}{
+		{"a", "x", true},
+		{"x", "b", false},
+		{"none", "y", false},
+		{"x", "", false},
+		{"x", "y.z", false},
+		{"x", "y[1]", false},
+		{"x", "y:z", false},
+		{"x", "y z", false},
+		{"x", "X", true},
+	}
+	for _, tt := range tests {
+		if err := p.RenameTag(tt.from, tt.to); (err == nil) != tt.ok {
+			t.Errorf("RenameTag(%s, %s): %v", tt.from, tt.to, err)
+		}
+	}
+	if inst("x") != ia || inst("a") != 0 || inst("b") != ib {
+		t.Errorf("instances x %d a %d b %d", inst("x"), inst("a"), inst("b"))
+	}
+	if n := p.symbols.inst[ia].attr[1].DataString(); n != "X" {
+		t.Errorf("SymbolName %q", n)
+	}
+	if v := p.tags["x"].DataDINT()[0]; v != 1 {
+		t.Errorf("value %d", v)
+	}
+}
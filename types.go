@@ -94,6 +94,7 @@ const (
 // Status codes
 const (
 	Success          = 0x00
+	ConnFailure      = 0x01
 	PathSegmentError = 0x04
 	PathUnknown      = 0x05
 	PartialTransfer  = 0x06
@@ -259,6 +260,14 @@ type forwardCloseResponse struct {
 	_                      uint8
 }
 
+type forwardOpenFailResponse struct {
+	ConnSerialNumber       uint16
+	VendorID               uint16
+	OriginatorSerialNumber uint32
+	RemainingPathSize      uint8
+	_                      uint8
+}
+
 type initUploadResponse struct {
 	FileSize     uint32
 	TransferSize uint8
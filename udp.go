@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
-	"fmt"
 	"net"
 	"time"
 )
@@ -12,7 +11,12 @@ import (
 func (p *PLC) handleUDPRequest(conn *net.UDPConn, dt []byte, n int, addr *net.UDPAddr) {
 	r := req{lenRem: -1}
 	r.p = p
+	r.remote = addr
 	r.readBuf = bufio.NewReader(bytes.NewReader(dt))
+	c := p.capturer()
+	if c != nil {
+		c.udp(addr, conn.LocalAddr(), dt[:n])
+	}
 	r.writeBuf = new(bytes.Buffer)
 
 	_, err := r.read(&r.encHead)
@@ -23,6 +27,7 @@ func (p *PLC) handleUDPRequest(conn *net.UDPConn, dt []byte, n int, addr *net.UD
 
 	switch r.encHead.Command {
 	case ecListIdentity:
+		p.metrics.udpListIdentity()
 		if r.eipListIdentity() != nil {
 			return
 		}
@@ -36,7 +41,7 @@ func (p *PLC) handleUDPRequest(conn *net.UDPConn, dt []byte, n int, addr *net.UD
 		r.write(uint16(0)) // ItemCount
 
 	default:
-		p.debug("UDP unknown command:", r.encHead.Command)
+		r.log(LogWarn, "UDP unknown command", "command", hexField(r.encHead.Command))
 
 		data := make([]uint8, r.encHead.Length)
 		_, err = r.read(&data)
@@ -50,7 +55,7 @@ func (p *PLC) handleUDPRequest(conn *net.UDPConn, dt []byte, n int, addr *net.UD
 
 	err = conn.SetWriteDeadline(time.Now().Add(time.Second))
 	if err != nil {
-		fmt.Println(err)
+		r.log(LogError, "set deadline", "err", err)
 		return
 	}
 
@@ -59,14 +64,16 @@ func (p *PLC) handleUDPRequest(conn *net.UDPConn, dt []byte, n int, addr *net.UD
 
 	err = binary.Write(&buf, binary.LittleEndian, r.encHead)
 	if err != nil {
-		fmt.Println(err)
+		r.log(LogError, "write", "err", err)
 		return
 	}
 	buf.Write(r.writeBuf.Bytes())
 
 	_, err = conn.WriteToUDP(buf.Bytes(), addr)
 	if err != nil {
-		fmt.Println(err)
+		r.log(LogWarn, "send", "err", err)
+	} else if c != nil {
+		c.udp(conn.LocalAddr(), addr, buf.Bytes())
 	}
 }
 
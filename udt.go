@@ -7,7 +7,6 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
-	"unicode"
 )
 
 type udtT struct {
@@ -17,6 +16,7 @@ type udtT struct {
 	C2 int    // Count 2D
 	C3 int    // Count 3D
 	O  int    // Offset
+	H  string // Host member of BIT, if empty bit C is counted from offset O
 }
 
 // NewUDT .
@@ -25,11 +25,82 @@ func (p *PLC) NewUDT(udt string) error {
 	if err != nil {
 		return err
 	}
-	p.newUDT(u, n, 0, 0)
-	return nil
+	return p.newUDT(u, n, 0, 0)
+}
+
+// addPredefinedTypes adds Logix predefined structures.
+func (p *PLC) addPredefinedTypes() {
+	p.addStringTypes()
+	p.newUDT([]udtT{
+		{N: "ZZZZZZZZZZTIMER0", T: "DINT", O: -1},
+		{N: "PRE", T: "DINT", O: -1},
+		{N: "ACC", T: "DINT", O: -1},
+		{N: "EN", T: "BIT", C: 31, H: "ZZZZZZZZZZTIMER0"},
+		{N: "TT", T: "BIT", C: 30, H: "ZZZZZZZZZZTIMER0"},
+		{N: "DN", T: "BIT", C: 29, H: "ZZZZZZZZZZTIMER0"},
+	}, "TIMER", 0, 0)
+	p.newUDT([]udtT{
+		{N: "ZZZZZZZZZZCOUNTER0", T: "DINT", O: -1},
+		{N: "PRE", T: "DINT", O: -1},
+		{N: "ACC", T: "DINT", O: -1},
+		{N: "CU", T: "BIT", C: 31, H: "ZZZZZZZZZZCOUNTER0"},
+		{N: "CD", T: "BIT", C: 30, H: "ZZZZZZZZZZCOUNTER0"},
+		{N: "DN", T: "BIT", C: 29, H: "ZZZZZZZZZZCOUNTER0"},
+		{N: "OV", T: "BIT", C: 28, H: "ZZZZZZZZZZCOUNTER0"},
+		{N: "UN", T: "BIT", C: 27, H: "ZZZZZZZZZZCOUNTER0"},
+	}, "COUNTER", 0, 0)
+	p.newUDT([]udtT{
+		{N: "ZZZZZZZZZZCONTROL0", T: "DINT", O: -1},
+		{N: "LEN", T: "DINT", O: -1},
+		{N: "POS", T: "DINT", O: -1},
+		{N: "EN", T: "BIT", C: 31, H: "ZZZZZZZZZZCONTROL0"},
+		{N: "EU", T: "BIT", C: 30, H: "ZZZZZZZZZZCONTROL0"},
+		{N: "DN", T: "BIT", C: 29, H: "ZZZZZZZZZZCONTROL0"},
+		{N: "EM", T: "BIT", C: 28, H: "ZZZZZZZZZZCONTROL0"},
+		{N: "ER", T: "BIT", C: 27, H: "ZZZZZZZZZZCONTROL0"},
+		{N: "UL", T: "BIT", C: 26, H: "ZZZZZZZZZZCONTROL0"},
+		{N: "IN", T: "BIT", C: 25, H: "ZZZZZZZZZZCONTROL0"},
+		{N: "FD", T: "BIT", C: 24, H: "ZZZZZZZZZZCONTROL0"},
+	}, "CONTROL", 0, 0)
+}
+
+func alignUp(x, a int) int {
+	return (x + a - 1) &^ (a - 1)
+}
+
+// align returns Logix alignment of the struct member.
+func (t Tag) align() int {
+	a := t.ElemLen()
+	if t.Type >= TypeStructHead {
+		a = t.st.align()
+	} else if t.Dim[0] > 0 && a < 4 {
+		a = 4 // arrays start on 32-bit boundary
+	}
+	if a > 8 {
+		a = 8
+	}
+	return a
 }
 
+// align returns Logix alignment of the struct.
+func (st *structData) align() int {
+	a := 4
+	for i := range st.d {
+		if st.d[i].align() == 8 {
+			a = 8
+		}
+	}
+	return a
+}
+
+// newUDT adds data type. Members without offset get Logix layout: aligned to their size,
+// arrays and structures to 4 bytes, or 8 with 64-bit members, and the size is padded likewise.
 func (p *PLC) newUDT(udt []udtT, name string, handle int, size int) error {
+	return p.newUDTAt(udt, name, handle, size, 0)
+}
+
+// newUDTAt adds data type with template instance inst, or the next free instance if 0.
+func (p *PLC) newUDTAt(udt []udtT, name string, handle int, size int, inst int) error {
 	var typencstr bytes.Buffer
 	st := new(structData)
 	st.o = make(map[string]int)
@@ -37,53 +108,109 @@ func (p *PLC) newUDT(udt []udtT, name string, handle int, size int) error {
 	typencstr.WriteString(name)
 	typencstr.WriteRune(',')
 
-	st.d = make([]Tag, len(udt))
+	st.d = make([]Tag, 0, len(udt))
+	host := -1 // hidden SINT holding packed BOOL members
+	bits := 0
 	for i := 0; i < len(udt); i++ {
-		st.d[i].Name = udt[i].N
-		st.o[udt[i].N] = i
-		st.d[i].Dim[0] = udt[i].C
-		st.d[i].Dim[1] = udt[i].C2
-		st.d[i].Dim[2] = udt[i].C3
-		st.d[i].Type = p.stringToType(udt[i].T)
-		if st.d[i].Type == 0 {
-			panic("!" + udt[i].T)
+		var m Tag
+		m.Name = udt[i].N
+		m.Dim[0] = udt[i].C
+		m.Dim[1] = udt[i].C2
+		m.Dim[2] = udt[i].C3
+		if udt[i].T == "BIT" {
+			base := udt[i].O
+			if udt[i].H != "" || base < 0 {
+				h, ok := st.o[udt[i].H]
+				if !ok {
+					return errors.New("no host member " + udt[i].H + " for " + udt[i].N)
+				}
+				base = st.d[h].offset
+			}
+			m.Type = TypeBOOL
+			m.Dim[0] = 0
+			m.offset = base + udt[i].C/8
+			m.bit = udt[i].C % 8
+			if m.offset >= st.l {
+				st.l = m.offset + 1
+			}
+			st.o[m.Name] = len(st.d)
+			st.d = append(st.d, m)
+			typencstr.WriteString("BOOL")
+			if i < len(udt)-1 {
+				typencstr.WriteRune(',')
+			}
+			continue
+		}
+		m.Type = p.stringToType(udt[i].T)
+		if m.Type == 0 {
+			return errors.New("unknown type " + udt[i].T)
 		}
-		if st.d[i].Type >= TypeStructHead {
+		if udt[i].T == "BOOL" && udt[i].O == -1 && udt[i].C == 0 {
+			if host == -1 || bits == 8 {
+				host = len(st.d)
+				h := Tag{Name: "ZZZZZZZZZZ" + name + strconv.Itoa(host), Type: TypeSINT, offset: st.l}
+				st.o[h.Name] = host
+				st.d = append(st.d, h)
+				st.l++
+				bits = 0
+				typencstr.WriteString("SINT,")
+			}
+			m.offset = st.d[host].offset
+			m.bit = bits
+			bits++
+			st.o[m.Name] = len(st.d)
+			st.d = append(st.d, m)
+			typencstr.WriteString(udt[i].T)
+			if i < len(udt)-1 {
+				typencstr.WriteRune(',')
+			}
+			continue
+		}
+		host = -1
+		if m.Type >= TypeStructHead {
 			ste, ok := p.tids[udt[i].T]
-			if ok {
-				st.d[i].st = &ste
-			} else {
-				panic("!" + udt[i].T)
+			if !ok {
+				return errors.New("unknown type " + udt[i].T)
 			}
-		} else if st.d[i].Dim[2] > 0 {
-			st.d[i].Type |= TypeArray3D
-		} else if st.d[i].Dim[1] > 0 {
-			st.d[i].Type |= TypeArray2D
-		} else if st.d[i].Dim[0] > 0 && udt[i].T != "BOOL" {
-			st.d[i].Type |= TypeArray1D
+			m.st = &ste
+		} else if m.Dim[2] > 0 {
+			m.Type |= TypeArray3D
+		} else if m.Dim[1] > 0 {
+			m.Type |= TypeArray2D
+		} else if m.Dim[0] > 0 {
+			m.Type |= TypeArray1D
 		}
-		// fmt.Println(udt[i].T, st.d[i].Type)
+		// fmt.Println(udt[i].T, m.Type)
 		typencstr.WriteString(udt[i].T)
-		if st.d[i].Type&TypeArray3D > 0 {
-			typencstr.WriteString(st.d[i].DimString())
+		if m.Type&TypeArray3D > 0 {
+			typencstr.WriteString(m.DimString())
 		}
 		if i < len(udt)-1 {
 			typencstr.WriteRune(',')
 		}
+		if m.boolArray() {
+			m.Dim[0] = (m.Dim[0] + 31) &^ 31
+		}
 		if udt[i].O == -1 {
-			st.d[i].offset = st.l
-			st.l += st.d[i].ElemLen() * st.d[i].Dims()
+			m.offset = alignUp(st.l, m.align())
+			st.l = m.offset + m.dataLen()
 		} else {
-			st.d[i].offset = udt[i].O
-			st.l = udt[i].O + st.d[i].ElemLen()
+			m.offset = udt[i].O
+			if l := udt[i].O + m.dataLen(); l > st.l {
+				st.l = l
+			}
 		}
+		st.o[m.Name] = len(st.d)
+		st.d = append(st.d, m)
 	}
 	if handle == 0 {
 		st.h = crc16(typencstr.Bytes())
+		st.l = alignUp(st.l, st.align())
 	} else {
 		st.h = uint16(handle)
 		st.l = size
 	}
+	st.i = inst
 	p.addUDT(st)
 
 	in := p.Class[0xAC].inst[1]
@@ -94,6 +221,91 @@ func (p *PLC) newUDT(udt []udtT, name string, handle int, size int) error {
 	return nil
 }
 
+// RemoveUDT removes data type with its template. Data type used by a tag or another data type is not removed.
+func (p *PLC) RemoveUDT(name string) error {
+	p.tMut.Lock()
+	defer p.tMut.Unlock()
+	st, ok := p.tids[name]
+	if !ok {
+		return errors.New("no data type " + name)
+	}
+	for _, t := range p.tags {
+		if t.st != nil && t.st.n == name {
+			return errors.New("data type " + name + " used by tag " + t.Name)
+		}
+	}
+	for n, u := range p.tids {
+		for _, m := range u.d {
+			if m.st != nil && m.st.n == name {
+				return errors.New("data type " + name + " used by " + n)
+			}
+		}
+	}
+	delete(p.tids, name)
+	p.template.m.RLock()
+	tp := p.template.inst[st.i]
+	byHandle := p.template.inst[int(st.h)] == tp
+	p.template.m.RUnlock()
+	p.template.removeInstance(st.i)
+	if byHandle {
+		p.template.removeInstance(int(st.h))
+	}
+
+	in := p.Class[0xAC].inst[1]
+	crc := in.attr[4].DataDINT()[0] - int32(crc16([]byte(name))+st.h)
+	in.SetAttrDINT(4, crc)
+	p.log(LogInfo, "data type removed", "type", name)
+	return nil
+}
+
+type udtDef struct {
+	n    string // name
+	u    []udtT
+	h    int // handle
+	l    int // size
+	i    int // template instance
+	line int // source line
+}
+
+// newUDTs adds data types in order of their dependencies. On error it returns the failed type.
+func (p *PLC) newUDTs(defs []udtDef) (udtDef, error) {
+	known := make(map[string]bool)
+	for _, d := range defs {
+		known[d.n] = true
+	}
+	for len(defs) > 0 {
+		var rest []udtDef
+		for _, d := range defs {
+			if _, ok := p.tids[d.n]; ok {
+				continue
+			}
+			ready := true
+			for _, m := range d.u {
+				if m.T != "BIT" && p.stringToType(m.T) == 0 {
+					if !known[m.T] {
+						return d, errors.New("unknown type " + m.T)
+					}
+					ready = false
+					break
+				}
+			}
+			if !ready {
+				rest = append(rest, d)
+				continue
+			}
+			err := p.newUDTAt(d.u, d.n, d.h, d.l, d.i)
+			if err != nil {
+				return d, err
+			}
+		}
+		if len(rest) == len(defs) {
+			return defs[0], errors.New("circular type definition")
+		}
+		defs = rest
+	}
+	return udtDef{}, nil
+}
+
 func (p *PLC) addUDT(st *structData) int {
 	p.tMut.Lock()
 	ste, ok := p.tids[st.n]
@@ -101,16 +313,32 @@ func (p *PLC) addUDT(st *structData) int {
 		p.tMut.Unlock()
 		return ste.i
 	}
-	st.i = p.tidLast
+	p.template.m.RLock()
+	if st.i <= 0 || p.template.inst[st.i] != nil {
+		st.i = p.tidLast
+	}
+	p.template.m.RUnlock()
 	p.tids[st.n] = *st
-	p.tidLast++
+	if st.i >= p.tidLast {
+		p.tidLast = st.i + 1
+	}
 	p.tMut.Unlock()
 
 	var tp *Instance
 	var buf bytes.Buffer
 
 	for _, x := range st.d {
-		bwrite(&buf, uint16(x.Dim[0]))
+		if x.boolArray() {
+			bwrite(&buf, uint16(x.dataLen()/4))
+			bwrite(&buf, uint16(TypeArray1D|TypeDWORD))
+			bwrite(&buf, uint32(x.offset))
+			continue
+		}
+		if x.BasicType() == TypeBOOL {
+			bwrite(&buf, uint16(x.bit)) // bit number
+		} else {
+			bwrite(&buf, uint16(x.Dim[0]))
+		}
 		if x.Type >= TypeStructHead {
 			bwrite(&buf, uint16(x.st.i|TypeStruct))
 		} else {
@@ -168,7 +396,7 @@ func (p *PLC) structHelper(a *Tag, t reflect.Type, fs int, ln int) {
 			typencstr.WriteRune(',')
 		}
 		a.st.d[i].offset = a.st.l
-		a.st.l += a.st.d[i].ElemLen() * a.st.d[i].Dims()
+		a.st.l += a.st.d[i].dataLen()
 	}
 	a.st.h = crc16(typencstr.Bytes())
 	a.Type = TypeStructHead | int(a.st.h)
@@ -187,7 +415,7 @@ func udtFromString(udt string) ([]udtT, string, error) {
 	if !strings.HasPrefix(udt, "DATATYPE") {
 		sb := udtr.FindStringSubmatch(udt)
 		if len(sb) < 5 {
-			return nil, "", errors.New("udt error 1")
+			return nil, "", errors.New("invalid type " + udt)
 		}
 		tn := udtT{}
 		tn.T = sb[1]
@@ -207,64 +435,14 @@ func udtFromString(udt string) ([]udtT, string, error) {
 		t = append(t, tn)
 		return t, "", nil
 	}
-	u := strings.FieldsFunc(udt, func(r rune) bool {
-		if unicode.IsSpace(r) || r == ';' || r == '(' || r == ')' {
-			return true
-		}
-		return false
-	})
-	if len(u) < 2 {
-		return nil, "", errors.New("udt error 2")
+	st, err := scanL5K(udt)
+	if err != nil {
+		return nil, "", err
 	}
-	name := u[1]
-	u = u[2:]
-	booli := 0
-	for i := 0; i < len(u); i += 2 {
-		if u[i] == "END_DATATYPE" {
-			break
-		}
-		if u[i] == "FamilyType" || u[i] == "Radix" {
-			i++
-			continue
-		}
-		if strings.HasPrefix(u[i], "FamilyType") || strings.HasPrefix(u[i], "Radix") || strings.HasPrefix(u[i], ":=") {
-			i--
-			continue
-		}
-
-		if len(u) < i+2 {
-			return nil, "", errors.New("udt error 3")
-		}
-		str := u[i] + " " + u[i+1]
-
-		sb := udtr.FindStringSubmatch(str)
-		if len(sb) < 5 {
-			return nil, "", errors.New("udt error 4")
-		}
-		tn := udtT{}
-		tn.N = sb[2]
-		tn.T = sb[1]
-		if tn.T == "BOOL" {
-			tn.C = booli
-			booli++ // FIXME > 8
-		} else {
-			tn.O = -1
-		}
-		i, err := strconv.Atoi(sb[3])
-		if err == nil {
-			tn.C = i
-		}
-		i, err = strconv.Atoi(sb[4])
-		if err == nil {
-			tn.C2 = i
-		}
-		i, err = strconv.Atoi(sb[5])
-		if err == nil {
-			tn.C3 = i
-		}
-
-		t = append(t, tn)
+	r := l5kReader{st: st}
+	err = r.datatype()
+	if err != nil {
+		return nil, "", err
 	}
-
-	return t, name, nil
+	return r.types[0].u, r.types[0].n, nil
 }
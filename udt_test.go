@@ -1,7 +1,9 @@
 package plcconnector
 
 import (
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -70,7 +72,7 @@ var testsUDT = []struct {
 	{"01", t2b, []udtT{{N: "sprites", T: "POSITION", C: 8, O: -1}, {N: "money", T: "LINT", O: -1}}, "HMM"},
 	{"01", t3, []udtT{{N: "x", T: "DINT", O: -1}, {N: "y", T: "DINT", O: -1}, {N: "z", T: "DINT", O: -1}}, "POSITION3D"},
 	{"01", t4, []udtT{{N: "objects", T: "POSITION3D", C: 2, O: -1}, {N: "lives", T: "SINT", O: -1}}, "MHH"},
-	{"01", t5, []udtT{{N: "In", T: "BOOL", C: 0, O: 0}, {N: "Out", T: "BOOL", C: 1, O: 0}}, "BOOLS"},
+	{"01", t5, []udtT{{N: "In", T: "BOOL", O: -1}, {N: "Out", T: "BOOL", O: -1}}, "BOOLS"},
 	{"01", t6, []udtT{{N: "int", T: "INT", O: -1}, {N: "struct", T: "BOOLS", O: -1}}, "STRINSTR"},
 	{"01", t7, []udtT{{N: "U2A", T: "DINT", O: -1}, {N: "U2B", T: "SINT", C: 3, O: -1}, {N: "U2C", T: "UDT3", O: -1}, {N: "U2D", T: "UDT3", C: 2, O: -1}}, "UDT2"},
 	{"01", t8, []udtT{{N: "A", T: "SINT", C: 3, O: -1}, {N: "B", T: "SINT", C: 3, C2: 3, O: -1}, {N: "C", T: "SINT", C: 3, C2: 3, C3: 3, O: -1}}, "MULTI"},
@@ -95,3 +97,140 @@ func FuzzUDT(f *testing.F) {
 		udtFromString(args)
 	})
 }
+
+func TestUDTBoolHosts(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	b.WriteString("DATATYPE ALARMS ")
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(&b, "BOOL A%d; ", i)
+	}
+	b.WriteString("DINT Count; BOOL B0; END_DATATYPE")
+	err = p.NewUDT(b.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st := p.tids["ALARMS"]
+	want := []struct {
+		name   string
+		offset int
+		bit    int
+	}{
+		{"ZZZZZZZZZZALARMS0", 0, 0}, {"A0", 0, 0}, {"A7", 0, 7},
+		{"ZZZZZZZZZZALARMS9", 1, 0}, {"A8", 1, 0}, {"A9", 1, 1},
+		{"Count", 4, 0}, {"ZZZZZZZZZZALARMS13", 8, 0}, {"B0", 8, 0},
+	}
+	for _, w := range want {
+		m := st.Elem(w.name)
+		if m == nil {
+			t.Errorf("no member %s", w.name)
+			continue
+		}
+		if m.offset != w.offset || m.bit != w.bit {
+			t.Errorf("%s: offset %d bit %d, want offset %d bit %d", w.name, m.offset, m.bit, w.offset, w.bit)
+		}
+	}
+	if st.l != 12 {
+		t.Errorf("size %d, want 12", st.l)
+	}
+
+	err = p.CreateTag("ALARMS", "al")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.saveTag(parsePath("al.A9"), TypeBOOL, 1, []uint8{1}, 0) {
+		t.Fatal("saveTag al.A9 failed")
+	}
+	data, _, _, ok := p.readTag(parsePath("al.A9"), 1)
+	if !ok || data[0] != 0xFF {
+		t.Errorf("readTag(al.A9) = %v, want 0xFF", data)
+	}
+	data, _, _, ok = p.readTag(parsePath("al.A8"), 1)
+	if !ok || data[0] != 0 {
+		t.Errorf("readTag(al.A8) = %v, want 0", data)
+	}
+}
+
+func TestRemoveUDT(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crc := func() int32 { return p.Class[0xAC].inst[1].attr[4].DataDINT()[0] }
+	crc0 := crc()
+	p.NewUDT("DATATYPE INNER DINT X; END_DATATYPE")
+	p.NewUDT("DATATYPE OUTER INNER In; END_DATATYPE")
+	p.CreateTag("OUTER", "o")
+	inner := p.tids["INNER"]
+
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"INNER", false}, // used by OUTER
+		{"OUTER", false}, // used by tag o
+		{"NONE", false},
+	}
+	for _, tt := range tests {
+		if err := p.RemoveUDT(tt.name); (err == nil) != tt.ok {
+			t.Errorf("RemoveUDT(%s): %v", tt.name, err)
+		}
+	}
+	if err = p.RemoveTag("o"); err != nil {
+		t.Fatal(err)
+	}
+	if err = p.RemoveUDT("OUTER"); err != nil {
+		t.Fatal(err)
+	}
+	if err = p.RemoveUDT("INNER"); err != nil {
+		t.Fatal(err)
+	}
+	if crc() != crc0 {
+		t.Errorf("UDTCRC %d, want %d", crc(), crc0)
+	}
+	if p.GetClassInstance(TemplateClass, inner.i) != nil || p.GetClassInstance(TemplateClass, int(inner.h)) != nil {
+		t.Error("template not removed")
+	}
+	if p.CreateTag("INNER", "i") == nil {
+		t.Error("tag of removed type created")
+	}
+}
+
+func TestUDTLayout(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.NewUDT("DATATYPE SMALL SINT S; END_DATATYPE")
+	tests := []struct {
+		udt     string
+		offsets []int
+		size    int
+	}{
+		{"DATATYPE L1 SINT A; INT B; END_DATATYPE", []int{0, 2}, 4},
+		{"DATATYPE L2 BOOL A; DINT B; END_DATATYPE", []int{0, 4}, 8},
+		{"DATATYPE L3 SINT A; LREAL B; SINT C; END_DATATYPE", []int{0, 8, 16}, 24},
+		{"DATATYPE L4 SINT A; SINT B[3]; INT C; END_DATATYPE", []int{0, 4, 8}, 12},
+		{"DATATYPE L5 SINT A; SMALL B; END_DATATYPE", []int{0, 4}, 8},
+	}
+	for _, tt := range tests {
+		if err := p.NewUDT(tt.udt); err != nil {
+			t.Fatal(err)
+		}
+		name := strings.Fields(tt.udt)[1]
+		st := p.tids[name]
+		var offsets []int
+		for _, m := range st.d {
+			if !strings.HasPrefix(m.Name, "ZZZZZZZZZZ") {
+				offsets = append(offsets, m.offset)
+			}
+		}
+		if !reflect.DeepEqual(offsets, tt.offsets) || st.l != tt.size {
+			t.Errorf("%s: offsets %v size %d, want %v %d", name, offsets, st.l, tt.offsets, tt.size)
+		}
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"compress/gzip"
 	"encoding/binary"
-	"fmt"
 	"io"
 	"net"
 	"strconv"
@@ -26,18 +25,11 @@ func iif(x bool, a string, b string) string {
 }
 
 func bread(rd io.Reader, data interface{}) error {
-	err := binary.Read(rd, binary.LittleEndian, data)
-	if err != nil {
-		fmt.Println(err)
-	}
-	return err
+	return binary.Read(rd, binary.LittleEndian, data)
 }
 
 func bwrite(buf io.Writer, data interface{}) {
-	err := binary.Write(buf, binary.LittleEndian, data)
-	if err != nil {
-		fmt.Println(err)
-	}
+	binary.Write(buf, binary.LittleEndian, data) // bytes.Buffer, fails only for invalid types
 }
 
 func htons(v uint16) uint16 {
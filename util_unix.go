@@ -2,17 +2,14 @@
 
 package plcconnector
 
-import (
-	"fmt"
-	"syscall"
-)
+import "syscall"
 
-func sockControl(network, address string, c syscall.RawConn) error {
+// sockControl sets SO_REUSEADDR. Failure to set it is only logged.
+func (p *PLC) sockControl(network, address string, c syscall.RawConn) error {
 	return c.Control(func(fd uintptr) {
 		err := syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
 		if err != nil {
-			fmt.Println("SO_REUSEADDR:", err)
-			return
+			p.log(LogWarn, "SO_REUSEADDR", "addr", address, "err", err)
 		}
 	})
 }
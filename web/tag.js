@@ -1,61 +1,32 @@
 async function setTag(tag, value) {
-  const response = await fetch('/.tagSet', {
-    method: 'POST',
+  const response = await fetch('/api/v1/tags/' + encodeURIComponent(tag), {
+    method: 'PUT',
     cache: 'no-cache',
     headers: {
-      'Content-Type': 'text/plain'
+      'Content-Type': 'application/json'
     },
-    body: tag + " = " + value
+    body: JSON.stringify({value: value})
   });
-  return response;
-}
-
-function n2b(n, s) {
-  const r = [];
-  for (let i = 0; i < s; i++) {
-    if (i * 8 >= 32) {
-      r.push(Number(Math.floor(n / Math.pow(2, i * 8))));
-    } else {
-      r.push((n >>> (i * 8)) & 0xFF);
-    }
+  if (!response.ok) {
+    const err = await response.json();
+    alert(err.error);
+    location.reload();
   }
-  return r;
-}
-
-function to_float32(x) {
-  let buf = new ArrayBuffer(4);
-  let num = new Float32Array(buf);
-  num[0] = parseFloat(x);
-  x = new Uint8Array(buf);
-  return [x[0], x[1], x[2], x[3]];
-}
-
-function to_float64(x) {
-  let buf = new ArrayBuffer(8);
-  let num = new Float64Array(buf);
-  num[0] = parseFloat(x);
-  x = new Uint8Array(buf);
-  return [x[0], x[1], x[2], x[3], x[4], x[5], x[6], x[7]];
-}
-
-function r2b(n, s) {
-  return s == 4 ? to_float32(n) : to_float64(n);
+  return response;
 }
 
 function clicBOOL(ev) {
   const tc = ev.target.textContent === "1" ? "0" : "1";
   ev.target.textContent = tc;
-  setTag(ev.target.attributes[2].textContent, tc);
+  setTag(ev.target.attributes[2].textContent, tc === "1");
 }
 
 function clicINT(ev) {
   let tc = ev.target.textContent;
   tc = prompt("Podaj liczbę", tc);
   if (tc !== null) {
-    const size = parseInt(ev.target.attributes[3].textContent, 10);
     ev.target.textContent = tc;
-    tc = n2b(tc, size);
-    setTag(ev.target.attributes[2].textContent, tc);
+    setTag(ev.target.attributes[2].textContent, Number(tc));
   }
 }
 
@@ -63,9 +34,39 @@ function clicREAL(ev) {
   let tc = ev.target.textContent;
   tc = prompt("Podaj liczbę", tc);
   if (tc !== null) {
-    const size = parseInt(ev.target.attributes[3].textContent, 10);
     ev.target.textContent = tc;
-    tc = r2b(tc, size);
-    setTag(ev.target.attributes[2].textContent, tc);
+    setTag(ev.target.attributes[2].textContent, Number(tc));
+  }
+}
+
+function liveUpdate() {
+  const cells = {};
+  document.querySelectorAll('[tag]').forEach(el => {
+    const p = el.getAttribute('tag');
+    (cells[p] = cells[p] || []).push(el);
+  });
+  const paths = Object.keys(cells);
+  if (paths.length === 0) {
+    return;
   }
+  const ws = new WebSocket((location.protocol === 'https:' ? 'wss://' : 'ws://') + location.host + '/api/v1/events');
+  ws.onopen = () => ws.send(JSON.stringify({subscribe: paths}));
+  ws.onmessage = ev => {
+    const m = JSON.parse(ev.data);
+    if (m.value === undefined || !cells[m.path]) {
+      return;
+    }
+    const v = typeof m.value === 'boolean' ? (m.value ? '1' : '0') : String(m.value);
+    cells[m.path].forEach(el => {
+      if (el.textContent !== v) {
+        el.textContent = v;
+        el.classList.remove('chg');
+        void el.offsetWidth;
+        el.classList.add('chg');
+      }
+    });
+  };
+  ws.onclose = () => setTimeout(liveUpdate, 5000);
 }
+
+window.addEventListener('load', liveUpdate);
@@ -0,0 +1,317 @@
+package plcconnector
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	wsGUID     = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	wsMaxFrame = 1 << 20
+
+	wsText  = 1
+	wsClose = 8
+	wsPing  = 9
+	wsPong  = 10
+)
+
+// wsConn is server side of WebSocket connection (RFC 6455).
+type wsConn struct {
+	c  net.Conn
+	br *bufio.Reader
+	m  sync.Mutex // writes
+}
+
+func headerHas(h http.Header, key, val string) bool {
+	for _, v := range h.Values(key) {
+		for _, s := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), val) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wsUpgrade performs WebSocket handshake. On error the HTTP response is already sent.
+func wsUpgrade(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || !headerHas(r.Header, "Connection", "upgrade") || !headerHas(r.Header, "Upgrade", "websocket") ||
+		r.Header.Get("Sec-WebSocket-Version") != "13" || key == "" {
+		http.Error(w, "websocket expected", http.StatusBadRequest)
+		return nil, errors.New("not a websocket handshake")
+	}
+	if o := r.Header.Get("Origin"); o != "" {
+		u, err := url.Parse(o)
+		if err != nil || !strings.EqualFold(u.Host, r.Host) {
+			http.Error(w, "cross origin", http.StatusForbidden)
+			return nil, errors.New("cross origin websocket " + o)
+		}
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return nil, errors.New("hijacking not supported")
+	}
+	c, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	h := sha1.Sum([]byte(key + wsGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(h[:]) + "\r\n\r\n")
+	if err = rw.Flush(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return &wsConn{c: c, br: rw.Reader}, nil
+}
+
+func (ws *wsConn) write(op uint8, data []uint8) error {
+	hdr := []uint8{0x80 | op}
+	switch {
+	case len(data) < 126:
+		hdr = append(hdr, uint8(len(data)))
+	case len(data) <= 0xFFFF:
+		hdr = append(hdr, 126, uint8(len(data)>>8), uint8(len(data)))
+	default:
+		hdr = append(hdr, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(hdr[2:], uint64(len(data)))
+	}
+	ws.m.Lock()
+	defer ws.m.Unlock()
+	ws.c.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := ws.c.Write(append(hdr, data...))
+	return err
+}
+
+// read returns next text or binary message. Control frames are handled internally.
+func (ws *wsConn) read() ([]uint8, error) {
+	var msg []uint8
+	for {
+		var hdr [2]uint8
+		if _, err := io.ReadFull(ws.br, hdr[:]); err != nil {
+			return nil, err
+		}
+		fin, op := hdr[0]&0x80 != 0, hdr[0]&0x0F
+		if hdr[1]&0x80 == 0 {
+			return nil, errors.New("unmasked client frame")
+		}
+		ln := uint64(hdr[1] & 0x7F)
+		switch ln {
+		case 126:
+			var b [2]uint8
+			if _, err := io.ReadFull(ws.br, b[:]); err != nil {
+				return nil, err
+			}
+			ln = uint64(binary.BigEndian.Uint16(b[:]))
+		case 127:
+			var b [8]uint8
+			if _, err := io.ReadFull(ws.br, b[:]); err != nil {
+				return nil, err
+			}
+			ln = binary.BigEndian.Uint64(b[:])
+		}
+		if ln > wsMaxFrame || uint64(len(msg))+ln > wsMaxFrame {
+			ws.write(wsClose, []uint8{0x03, 0xF1}) // 1009 message too big
+			return nil, errors.New("websocket message too big")
+		}
+		var mask [4]uint8
+		if _, err := io.ReadFull(ws.br, mask[:]); err != nil {
+			return nil, err
+		}
+		data := make([]uint8, ln)
+		if _, err := io.ReadFull(ws.br, data); err != nil {
+			return nil, err
+		}
+		for i := range data {
+			data[i] ^= mask[i%4]
+		}
+		switch op {
+		case wsClose:
+			ws.write(wsClose, data)
+			return nil, io.EOF
+		case wsPing:
+			ws.write(wsPong, data)
+			continue
+		case wsPong:
+			continue
+		}
+		msg = append(msg, data...)
+		if fin {
+			return msg, nil
+		}
+	}
+}
+
+func (ws *wsConn) Close() error {
+	return ws.c.Close()
+}
+
+// wsRequest is message from client.
+type wsRequest struct {
+	Subscribe   []string `json:"subscribe,omitempty"`
+	Unsubscribe []string `json:"unsubscribe,omitempty"`
+}
+
+// wsEvent is value of subscribed path sent to client.
+type wsEvent struct {
+	Path   string      `json:"path"`
+	Value  interface{} `json:"value,omitempty"`
+	Source string      `json:"source,omitempty"`
+	Time   *time.Time  `json:"time,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// wsPath is subscribed path with location of its data. Path is rest of path after tag head,
+// so that the subscription follows head and base tag when they are renamed.
+type wsPath struct {
+	head    *Tag
+	path    []pathEl
+	tag     *Tag
+	off, ln int
+}
+
+// eventsHTTP streams values of subscribed tag paths over WebSocket.
+// Client sends {"subscribe": [paths]} or {"unsubscribe": [paths]}; server sends current value of each
+// subscribed path and then {"path", "value", "source", "time"} after every change.
+func (p *PLC) eventsHTTP(w http.ResponseWriter, r *http.Request) {
+	ws, err := wsUpgrade(w, r)
+	if err != nil {
+		p.log(LogDebug, "websocket", "remote", r.RemoteAddr, "err", err)
+		return
+	}
+	p.httpMut.Lock()
+	if p.wsConns == nil {
+		p.wsConns = make(map[*wsConn]struct{})
+	}
+	p.wsConns[ws] = struct{}{}
+	p.httpMut.Unlock()
+	defer func() {
+		p.httpMut.Lock()
+		delete(p.wsConns, ws)
+		p.httpMut.Unlock()
+		ws.Close()
+	}()
+
+	sub := p.Subscribe(256)
+	defer sub.Close()
+
+	var (
+		m     sync.Mutex
+		paths = make(map[string]wsPath)
+		done  = make(chan struct{})
+	)
+
+	send := func(ev wsEvent) bool {
+		b, err := json.Marshal(ev)
+		if err != nil {
+			b, _ = json.Marshal(wsEvent{Path: ev.Path, Error: err.Error()})
+		}
+		return ws.write(wsText, b) == nil
+	}
+	// value returns current value of path, ok is false if path is not affected by event e.
+	value := func(name string, e *TagEvent) (wsEvent, bool) {
+		ev := wsEvent{Path: name}
+		m.Lock()
+		wp, ok := paths[name]
+		m.Unlock()
+		if !ok {
+			return ev, false
+		}
+		p.tMut.RLock()
+		defer p.tMut.RUnlock()
+		if e != nil && (!strings.EqualFold(e.Tag, wp.tag.Name) || e.Offset >= wp.off+wp.ln || e.Offset+len(e.Data) <= wp.off) {
+			return ev, false
+		}
+		ref, err := p.resolve(append(parsePath(wp.head.Name), wp.path...))
+		if err != nil {
+			ev.Error = err.Error()
+		} else {
+			ev.Value = encodeValue(ref.t, ref.data(), ref.bit)
+		}
+		if e != nil {
+			ev.Source = e.Source
+			ev.Time = &e.Time
+		}
+		return ev, true
+	}
+
+	go func() {
+		defer close(done)
+		for {
+			msg, err := ws.read()
+			if err != nil {
+				return
+			}
+			var req wsRequest
+			if err = json.Unmarshal(msg, &req); err != nil {
+				send(wsEvent{Error: err.Error()})
+				continue
+			}
+			for _, name := range req.Unsubscribe {
+				m.Lock()
+				delete(paths, name)
+				m.Unlock()
+			}
+			for _, name := range req.Subscribe {
+				pth := parsePath(name)
+				if pth == nil {
+					send(wsEvent{Path: name, Error: "invalid path " + name})
+					continue
+				}
+				p.tMut.RLock()
+				ref, err := p.resolve(pth)
+				n, i := p.tagName(pth)
+				wp := wsPath{head: p.tags[strings.ToLower(n)], path: pth[i:], tag: ref.tag, off: ref.off}
+				p.tMut.RUnlock()
+				if err == nil && !p.allowed(r, ref.tag, false) {
+					err = errors.New("read of " + ref.tag.Name + " not allowed")
+				}
+				if err != nil {
+					send(wsEvent{Path: name, Error: err.Error()})
+					continue
+				}
+				m.Lock()
+				wp.ln = len(ref.data())
+				paths[name] = wp
+				m.Unlock()
+				if ev, ok := value(name, nil); ok && !send(ev) {
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			m.Lock()
+			names := make([]string, 0, len(paths))
+			for n := range paths {
+				names = append(names, n)
+			}
+			m.Unlock()
+			for _, n := range names {
+				if ev, ok := value(n, &e); ok && !send(ev) {
+					return
+				}
+			}
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package plcconnector
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func wsClientSend(t *testing.T, c net.Conn, msg string) {
+	mask := []uint8{1, 2, 3, 4}
+	f := []uint8{0x80 | wsText, 0x80 | uint8(len(msg))}
+	f = append(f, mask...)
+	for i := 0; i < len(msg); i++ {
+		f = append(f, msg[i]^mask[i%4])
+	}
+	if _, err := c.Write(f); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func wsClientRead(t *testing.T, br *bufio.Reader) wsEvent {
+	var hdr [2]uint8
+	if _, err := io.ReadFull(br, hdr[:]); err != nil {
+		t.Fatal(err)
+	}
+	ln := int(hdr[1])
+	if ln == 126 {
+		var b [2]uint8
+		io.ReadFull(br, b[:])
+		ln = int(b[0])<<8 | int(b[1])
+	}
+	data := make([]uint8, ln)
+	if _, err := io.ReadFull(br, data); err != nil {
+		t.Fatal(err)
+	}
+	var ev wsEvent
+	if err := json.Unmarshal(data, &ev); err != nil {
+		t.Fatal(err)
+	}
+	return ev
+}
+
+func TestWebSocket(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.NewTag([]int16{1, 2, 3}, "a")
+	p.NewTag(int32(0), "b")
+	p.NewTag(float32(0), "r")
+
+	srv := httptest.NewServer(http.HandlerFunc(p.handler))
+	defer srv.Close()
+	c, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+
+	io.WriteString(c, "GET /api/v1/events HTTP/1.1\r\nHost: x\r\nConnection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+	br := bufio.NewReader(c)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("handshake: %s %v", resp.Status, resp.Header)
+	}
+
+	wsClientSend(t, c, `{"subscribe": ["a[1]", "b", "nope"]}`)
+	want := []string{`a[1] 2`, `b 0`, `nope no tag nope`}
+	for _, w := range want {
+		ev := wsClientRead(t, br)
+		if got := strings.TrimSpace(ev.Path + " " + ev.Error + jsonString(ev.Value)); got != w {
+			t.Errorf("initial = %q, want %q", got, w)
+		}
+	}
+
+	p.UpdateTag("a", 0, []uint8{9, 0}) // a[0] is not subscribed
+	p.UpdateTag("a", 1, []uint8{7, 0}) // a[1]
+	p.saveTag(parsePath("b"), TypeDINT, 1, []uint8{5, 0, 0, 0}, 0)
+	for _, w := range []string{`a[1] UpdateTag 7`, `b WriteTag 5`} {
+		ev := wsClientRead(t, br)
+		if got := ev.Path + " " + ev.Source + " " + jsonString(ev.Value); got != w || ev.Time == nil {
+			t.Errorf("event = %q, want %q", got, w)
+		}
+	}
+
+	wsClientSend(t, c, `{"subscribe": ["r"]}`)
+	wsClientRead(t, br)
+	if err = p.SetValue("r", `"NaN"`); err != nil {
+		t.Fatal(err)
+	}
+	if ev := wsClientRead(t, br); ev.Value != "NaN" {
+		t.Errorf("NaN event = %+v", ev)
+	}
+
+	if err = p.RenameTag("b", "b2"); err != nil {
+		t.Fatal(err)
+	}
+	p.UpdateTag("b2", 0, []uint8{6})
+	if ev := wsClientRead(t, br); ev.Path != "b" || jsonString(ev.Value) != "6" {
+		t.Errorf("event after rename = %+v", ev)
+	}
+
+	p.CloseHTTP()
+	if _, err = br.ReadByte(); err == nil {
+		t.Error("connection open after CloseHTTP")
+	}
+}
+
+func jsonString(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func TestSubscribe(t *testing.T) {
+	p, err := Init(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.NewTag(int16(1), "a")
+	called := make(chan *Tag, 1)
+	p.Callback(func(service int, status int, tag *Tag) {
+		if service == WriteTag && status == Success {
+			select {
+			case called <- tag:
+			default:
+			}
+		}
+	})
+	s := p.Subscribe(1)
+	p.UpdateTag("a", 0, []uint8{2, 0})
+	p.UpdateTag("a", 0, []uint8{3, 0}) // dropped, buffer full
+	e := <-s.C
+	if e.Tag != "a" || e.Source != "UpdateTag" || e.Data[0] != 2 {
+		t.Errorf("event = %+v", e)
+	}
+	select {
+	case tag := <-called:
+		if tag.Name != "a" {
+			t.Errorf("callback tag %+v", tag)
+		}
+	case <-time.After(time.Second):
+		t.Error("callback not called")
+	}
+	s.Close()
+	if _, ok := <-s.C; ok {
+		t.Error("channel not closed")
+	}
+	s.Close()
+}